@@ -0,0 +1,459 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	API_KEY_COLLECTION = "api_keys"
+	// API_KEY_USAGE_COLLECTION holds when each key was last used, by key hash.
+	// It is apart from the key records so recording a use never writes a key
+	// back after it was revoked.
+	API_KEY_USAGE_COLLECTION = "api_key_usage"
+	// API_KEY_PREFIX starts every issued key, so keys are easy to recognize
+	API_KEY_PREFIX = "lgc_"
+
+	// authKeyContext holds the caller's *APIKey on the gin context
+	authKeyContext = "apiKey"
+	// apiKeyTouchInterval bounds how often a key's lastUsedAt is written
+	apiKeyTouchInterval = time.Hour
+
+	// Roles, each allowed everything the previous one is: viewers read stats
+	// and counts, SDRs work with leads and generate emails, admins also delete
+	// leads, revert exports, edit prompt templates and manage keys.
+	ROLE_VIEWER = "viewer"
+	ROLE_SDR    = "sdr"
+	ROLE_ADMIN  = "admin"
+)
+
+// roleRanks orders the roles from least to most privileged.
+var roleRanks = map[string]int{ROLE_VIEWER: 1, ROLE_SDR: 2, ROLE_ADMIN: 3}
+
+// publicPaths stay reachable without a key, for load balancers and uptime checks.
+var publicPaths = map[string]bool{"/health": true, "/ping": true}
+
+// APIKey is an issued API key and the user it acts as. Only the SHA-256 hash of
+// the key is stored, as the record id; the key itself is shown once, when it is
+// created.
+type APIKey struct {
+	ID   string `json:"id"`
+	Name string `json:"name,omitempty"`
+	User string `json:"user"`
+	// Role is viewer, sdr or admin
+	Role string `json:"role"`
+	// LegacyAdmin is set on keys created before roles, which had only an admin flag
+	LegacyAdmin bool `json:"admin,omitempty"`
+	// Workspace is the only workspace the key can reach; empty is the default one
+	Workspace string `json:"workspace,omitempty"`
+	// Hint is the start of the key, to tell keys apart
+	Hint       string `json:"hint"`
+	Hash       string `json:"hash,omitempty"`
+	CreatedBy  string `json:"createdBy,omitempty"`
+	CreatedAt  int64  `json:"createdAt"`
+	LastUsedAt int64  `json:"lastUsedAt,omitempty"`
+}
+
+// apiKeyUsage is the API_KEY_USAGE_COLLECTION record of a key.
+type apiKeyUsage struct {
+	LastUsedAt int64 `json:"lastUsedAt"`
+}
+
+// bootstrapAPIKey is the caller of requests made with auth.bootstrapKey.
+var bootstrapAPIKey = &APIKey{ID: "bootstrap", User: "bootstrap", Role: ROLE_ADMIN, Hint: "bootstrap"}
+
+type CreateAPIKeyRequest struct {
+	User string `json:"user" binding:"required"`
+	Name string `json:"name"`
+	// Role defaults to sdr
+	Role string `json:"role"`
+}
+
+type APIKeyResponse struct {
+	Success bool      `json:"success"`
+	Key     *APIKey   `json:"key,omitempty"`
+	Keys    []*APIKey `json:"keys,omitempty"`
+	// Secret is the new key; it cannot be read again
+	Secret string `json:"secret,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// public drops the hash from a key shown to clients.
+func (k *APIKey) public() *APIKey {
+	out := *k
+	out.Hash = ""
+	out.Role = k.role()
+	out.LegacyAdmin = false
+	out.Workspace = k.workspace()
+	return &out
+}
+
+// workspace is the key's workspace; keys from before workspaces are in the default one.
+func (k *APIKey) workspace() string {
+	if k.Workspace != "" {
+		return k.Workspace
+	}
+	return DEFAULT_WORKSPACE
+}
+
+// role is the key's role; keys from before roles are admins or SDRs.
+func (k *APIKey) role() string {
+	if k.Role != "" {
+		return k.Role
+	}
+	if k.LegacyAdmin {
+		return ROLE_ADMIN
+	}
+	return ROLE_SDR
+}
+
+// normalizeRole checks a requested role, defaulting to sdr.
+func normalizeRole(role string) (string, error) {
+	role = strings.ToLower(strings.TrimSpace(role))
+	if role == "" {
+		return ROLE_SDR, nil
+	}
+	if _, ok := roleRanks[role]; !ok {
+		return "", fmt.Errorf("unknown role %q (use %s, %s or %s)", role, ROLE_VIEWER, ROLE_SDR, ROLE_ADMIN)
+	}
+	return role, nil
+}
+
+func hashAPIKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// issueAPIKey creates a key for user with role in workspace and returns it
+// with its secret. Keys of every workspace are kept in the default one's store.
+func issueAPIKey(ctx context.Context, store LeadStore, user, name, role, workspace string, createdBy string) (*APIKey, string, error) {
+	user = strings.TrimSpace(user)
+	if user == "" {
+		return nil, "", fmt.Errorf("user is required")
+	}
+	role, err := normalizeRole(role)
+	if err != nil {
+		return nil, "", err
+	}
+	if workspace == "" {
+		workspace = DEFAULT_WORKSPACE
+	}
+	if !validWorkspaceName(workspace) {
+		return nil, "", fmt.Errorf("invalid workspace %q: %s", workspace, workspaceNameRule)
+	}
+	if len(user) > maxLeadFieldLength || len(name) > maxLeadFieldLength {
+		return nil, "", fmt.Errorf("user and name must be at most %d characters", maxLeadFieldLength)
+	}
+
+	random := make([]byte, 24)
+	if _, err := rand.Read(random); err != nil {
+		return nil, "", err
+	}
+	secret := API_KEY_PREFIX + hex.EncodeToString(random)
+	key := &APIKey{
+		ID:        newID("key"),
+		Name:      strings.TrimSpace(name),
+		User:      user,
+		Role:      role,
+		Workspace: workspace,
+		Hint:      secret[:len(API_KEY_PREFIX)+6],
+		Hash:      hashAPIKey(secret),
+		CreatedBy: createdBy,
+		CreatedAt: time.Now().UnixMilli(),
+	}
+	if err := putRecordJSON(ctx, store, API_KEY_COLLECTION, key.Hash, key); err != nil {
+		return nil, "", err
+	}
+	return key, secret, nil
+}
+
+// listAPIKeys returns the keys of workspace, or of every workspace when it is
+// empty, oldest first.
+func listAPIKeys(ctx context.Context, store LeadStore, workspace string) ([]*APIKey, error) {
+	records, err := store.ListRecords(ctx, API_KEY_COLLECTION)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]*APIKey, 0, len(records))
+	for _, raw := range records {
+		var key APIKey
+		if err := json.Unmarshal(raw, &key); err != nil {
+			continue
+		}
+		if workspace != "" && key.workspace() != workspace {
+			continue
+		}
+		// Keys used before usage records were split out still carry lastUsedAt
+		var usage apiKeyUsage
+		if err := getRecordJSON(ctx, store, API_KEY_USAGE_COLLECTION, key.Hash, &usage); err == nil && usage.LastUsedAt > key.LastUsedAt {
+			key.LastUsedAt = usage.LastUsedAt
+		}
+		keys = append(keys, &key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt < keys[j].CreatedAt })
+	return keys, nil
+}
+
+// revokeAPIKey deletes the key with the given id in workspace (any workspace
+// when empty); ErrNotFound when there is none.
+func revokeAPIKey(ctx context.Context, store LeadStore, id, workspace string) (*APIKey, error) {
+	keys, err := listAPIKeys(ctx, store, workspace)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		if key.ID != id {
+			continue
+		}
+		if _, err := store.DeleteRecord(ctx, API_KEY_COLLECTION, key.Hash); err != nil {
+			return nil, err
+		}
+		if _, err := store.DeleteRecord(ctx, API_KEY_USAGE_COLLECTION, key.Hash); err != nil {
+			log.Printf("⚠️ Failed to delete usage of revoked API key %s: %v", key.ID, err)
+		}
+		return key, nil
+	}
+	return nil, ErrNotFound
+}
+
+// apiKeyFromRequest reads the key from X-API-Key or an Authorization bearer token.
+func apiKeyFromRequest(c *gin.Context) string {
+	if key := strings.TrimSpace(c.GetHeader("X-API-Key")); key != "" {
+		return key
+	}
+	scheme, token, ok := strings.Cut(strings.TrimSpace(c.GetHeader("Authorization")), " ")
+	if ok && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
+
+// authenticate rejects requests without a valid API key when auth.enabled is
+// set, and leaves the caller's key on the context for requestUser. The
+// auth.bootstrapKey, when configured, acts as an admin of the default workspace.
+func (s *CacheServer) authenticate(c *gin.Context) {
+	if !s.config.Auth.Enabled || publicPaths[c.Request.URL.Path] {
+		c.Next()
+		return
+	}
+
+	reject := func(reason string) {
+		log.Printf("🔒 Rejected %s %s from %s: %s", c.Request.Method, c.Request.URL.Path, c.ClientIP(), reason)
+		c.Header("WWW-Authenticate", `Bearer realm="lead-generator-cache"`)
+		c.AbortWithStatusJSON(http.StatusUnauthorized, CacheResponse{
+			Success: false,
+			Error:   "A valid API key is required (Authorization: Bearer <key>)",
+		})
+	}
+
+	secret := apiKeyFromRequest(c)
+	if secret == "" {
+		reject("no API key")
+		return
+	}
+	if bootstrap := s.config.Auth.BootstrapKey; bootstrap != "" && subtle.ConstantTimeCompare([]byte(secret), []byte(bootstrap)) == 1 {
+		c.Set(authKeyContext, bootstrapAPIKey)
+		c.Next()
+		return
+	}
+	var key APIKey
+	if err := getRecordJSON(c.Request.Context(), s.store, API_KEY_COLLECTION, hashAPIKey(secret), &key); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			reject("unknown API key")
+			return
+		}
+		log.Printf("Error looking up API key: %v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, CacheResponse{
+			Success: false,
+			Error:   "Failed to check API key",
+		})
+		return
+	}
+
+	s.touchAPIKey(&key)
+	c.Set(authKeyContext, &key)
+	c.Next()
+}
+
+// touchAPIKey records that key was used, at most once per apiKeyTouchInterval.
+// Only the usage record is written, never the key record.
+func (s *CacheServer) touchAPIKey(key *APIKey) {
+	var usage apiKeyUsage
+	if err := getRecordJSON(s.ctx, s.store, API_KEY_USAGE_COLLECTION, key.Hash, &usage); err != nil && !errors.Is(err, ErrNotFound) {
+		log.Printf("⚠️ Failed to read use of API key %s: %v", key.ID, err)
+		return
+	}
+	now := time.Now()
+	if now.Sub(time.UnixMilli(usage.LastUsedAt)) <= apiKeyTouchInterval {
+		return
+	}
+	usage.LastUsedAt = now.UnixMilli()
+	if err := putRecordJSON(s.ctx, s.store, API_KEY_USAGE_COLLECTION, key.Hash, &usage); err != nil {
+		log.Printf("⚠️ Failed to record use of API key %s: %v", key.ID, err)
+	}
+}
+
+// requireRole only lets keys with role or a more privileged one through.
+// Without auth.enabled there are no roles and every caller is let through.
+func (s *CacheServer) requireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !s.config.Auth.Enabled {
+			c.Next()
+			return
+		}
+		key := authenticatedKey(c)
+		if key == nil || roleRanks[key.role()] < roleRanks[role] {
+			keyRole := "none"
+			if key != nil {
+				keyRole = key.role()
+			}
+			log.Printf("🚫 Forbidden: %s (%s) tried %s %s, which requires %s", requestUser(c), keyRole, c.Request.Method, c.Request.URL.Path, role)
+			c.AbortWithStatusJSON(http.StatusForbidden, CacheResponse{
+				Success: false,
+				Error:   fmt.Sprintf("This requires the %s role", role),
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// authenticatedKey is the key the request was made with, nil without auth.
+func authenticatedKey(c *gin.Context) *APIKey {
+	value, ok := c.Get(authKeyContext)
+	if !ok {
+		return nil
+	}
+	key, _ := value.(*APIKey)
+	return key
+}
+
+// The key handlers are not scoped: keys live in the default workspace's store,
+// and admins only see and manage those of their own workspace.
+func (s *CacheServer) listAPIKeysHandler(c *gin.Context) {
+	keys, err := listAPIKeys(s.ctx, s.store, requestWorkspace(c))
+	if err != nil {
+		log.Printf("Error listing API keys: %v", err)
+		c.JSON(http.StatusInternalServerError, APIKeyResponse{
+			Success: false,
+			Error:   "Failed to list API keys",
+		})
+		return
+	}
+	for i, key := range keys {
+		keys[i] = key.public()
+	}
+	c.JSON(http.StatusOK, APIKeyResponse{
+		Success: true,
+		Keys:    keys,
+	})
+}
+
+func (s *CacheServer) createAPIKeyHandler(c *gin.Context) {
+	var request CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, APIKeyResponse{
+			Success: false,
+			Error:   "Invalid JSON in request body (user is required)",
+		})
+		return
+	}
+
+	key, secret, err := issueAPIKey(s.ctx, s.store, request.User, request.Name, request.Role, requestWorkspace(c), requestUser(c))
+	if err != nil {
+		log.Printf("Error creating API key for %s: %v", request.User, err)
+		c.JSON(http.StatusBadRequest, APIKeyResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	log.Printf("🔑 %s created %s API key %s for %s in workspace %s", requestUser(c), key.Role, key.ID, key.User, key.Workspace)
+	c.JSON(http.StatusCreated, APIKeyResponse{
+		Success: true,
+		Key:     key.public(),
+		Secret:  secret,
+	})
+}
+
+func (s *CacheServer) revokeAPIKeyHandler(c *gin.Context) {
+	key, err := revokeAPIKey(s.ctx, s.store, c.Param("id"), requestWorkspace(c))
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			c.JSON(http.StatusNotFound, APIKeyResponse{
+				Success: false,
+				Error:   "API key not found",
+			})
+			return
+		}
+		log.Printf("Error revoking API key %s: %v", c.Param("id"), err)
+		c.JSON(http.StatusInternalServerError, APIKeyResponse{
+			Success: false,
+			Error:   "Failed to revoke API key",
+		})
+		return
+	}
+
+	log.Printf("🔑 %s revoked API key %s of %s", requestUser(c), key.ID, key.User)
+	c.JSON(http.StatusOK, APIKeyResponse{
+		Success: true,
+		Key:     key.public(),
+	})
+}
+
+// runKeyCommand carries out the key management flags of the binary against
+// the configured store: create prints the new key once, list prints every key
+// of every workspace.
+func runKeyCommand(cfg *Config, create, name, role, workspace string, list bool, revoke string) error {
+	if cfg.Store.Backend == STORE_BACKEND_MEMORY {
+		return fmt.Errorf("keys in the memory store would be lost when this command exits; set auth.bootstrapKey (AUTH_BOOTSTRAP_KEY) and use POST /auth/keys instead")
+	}
+	ctx := context.Background()
+	store, err := NewLeadStore(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("failed to open %s store: %v", cfg.Store.Backend, err)
+	}
+	defer store.Close()
+
+	switch {
+	case create != "":
+		key, secret, err := issueAPIKey(ctx, store, create, name, role, workspace, "cli")
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Created %s API key %s for %s in workspace %s. It is shown only once:\n%s\n", key.Role, key.ID, key.User, key.Workspace, secret)
+	case revoke != "":
+		key, err := revokeAPIKey(ctx, store, revoke, "")
+		if err != nil {
+			return fmt.Errorf("failed to revoke %s: %v", revoke, err)
+		}
+		fmt.Printf("Revoked API key %s of %s\n", key.ID, key.User)
+	case list:
+		keys, err := listAPIKeys(ctx, store, "")
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			lastUsed := "never"
+			if key.LastUsedAt > 0 {
+				lastUsed = time.UnixMilli(key.LastUsedAt).Format(time.RFC3339)
+			}
+			fmt.Printf("%s\t%s...\t%s\t%s\t%s\t%s\tlast used %s\n", key.ID, key.Hint, key.workspace(), key.User, key.role(), key.Name, lastUsed)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testBootstrapKey = "bootstrap-key-for-tests-0123456789abcdef"
+
+func newTestAuthServer(t *testing.T) *CacheServer {
+	t.Helper()
+	cfg := DefaultConfig()
+	cfg.Store.Backend = STORE_BACKEND_MEMORY
+	cfg.Verification.Provider = VERIFIER_FAKE
+	cfg.Generation.Provider = "stub"
+	cfg.Auth.BootstrapKey = testBootstrapKey
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	return NewCacheServer(cfg)
+}
+
+func serveWithKey(s *CacheServer, method, path, key, body string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, path, strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	if key != "" {
+		request.Header.Set("Authorization", "Bearer "+key)
+	}
+	recorder := httptest.NewRecorder()
+	s.router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestDefaultConfigRequiresAuth(t *testing.T) {
+	cfg := DefaultConfig()
+	if !cfg.Auth.Enabled {
+		t.Fatal("auth.enabled defaults to false")
+	}
+	if containsString(cfg.CORS.AllowedOrigins, "*") {
+		t.Fatalf("cors.allowedOrigins defaults to %v", cfg.CORS.AllowedOrigins)
+	}
+
+	cfg.Store.Backend = STORE_BACKEND_MEMORY
+	cfg.Verification.Provider = VERIFIER_FAKE
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "auth.bootstrapKey") {
+		t.Fatalf("Validate with memory backend and no bootstrap key = %v, want an auth.bootstrapKey error", err)
+	}
+	cfg.Auth.BootstrapKey = "short"
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "at least") {
+		t.Fatalf("Validate with a short bootstrap key = %v, want a length error", err)
+	}
+}
+
+func TestBootstrapKeyIssuesFirstKey(t *testing.T) {
+	s := newTestAuthServer(t)
+
+	if got := serveWithKey(s, http.MethodGet, "/stats", "", ""); got.Code != http.StatusUnauthorized {
+		t.Fatalf("GET /stats without a key = %d, want 401", got.Code)
+	}
+
+	created := serveWithKey(s, http.MethodPost, "/auth/keys", testBootstrapKey, `{"user":"jane@example.com","role":"admin"}`)
+	if created.Code != http.StatusCreated {
+		t.Fatalf("POST /auth/keys with the bootstrap key = %d: %s", created.Code, created.Body)
+	}
+	var response APIKeyResponse
+	if err := json.Unmarshal(created.Body.Bytes(), &response); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if response.Key.CreatedBy != "bootstrap" || response.Key.Workspace != DEFAULT_WORKSPACE {
+		t.Fatalf("created key = %+v", response.Key)
+	}
+
+	if got := serveWithKey(s, http.MethodGet, "/stats", response.Secret, ""); got.Code != http.StatusOK {
+		t.Fatalf("GET /stats with the new key = %d: %s", got.Code, got.Body)
+	}
+}
+
+func TestRevokedKeyStaysRevoked(t *testing.T) {
+	s := newTestAuthServer(t)
+
+	key, secret, err := issueAPIKey(s.ctx, s.store, "sam@example.com", "", ROLE_SDR, "", "test")
+	if err != nil {
+		t.Fatalf("issueAPIKey: %v", err)
+	}
+	if got := serveWithKey(s, http.MethodGet, "/stats", secret, ""); got.Code != http.StatusOK {
+		t.Fatalf("GET /stats = %d: %s", got.Code, got.Body)
+	}
+
+	keys, err := listAPIKeys(s.ctx, s.store, "")
+	if err != nil || len(keys) != 1 || keys[0].LastUsedAt == 0 {
+		t.Fatalf("listAPIKeys = %+v, %v; want one key with lastUsedAt", keys, err)
+	}
+
+	if _, err := revokeAPIKey(s.ctx, s.store, key.ID, ""); err != nil {
+		t.Fatalf("revokeAPIKey: %v", err)
+	}
+	// A use recorded by a request that passed the lookup before the revoke
+	// must not bring the key back
+	if _, err := s.store.DeleteRecord(s.ctx, API_KEY_USAGE_COLLECTION, key.Hash); err != nil {
+		t.Fatalf("DeleteRecord: %v", err)
+	}
+	s.touchAPIKey(key)
+
+	if got := serveWithKey(s, http.MethodGet, "/stats", secret, ""); got.Code != http.StatusUnauthorized {
+		t.Fatalf("GET /stats with a revoked key = %d, want 401", got.Code)
+	}
+	if keys, err := listAPIKeys(s.ctx, s.store, ""); err != nil || len(keys) != 0 {
+		t.Fatalf("listAPIKeys after revoke = %+v, %v", keys, err)
+	}
+}
+
+func TestDeleteLeadRequiresAdmin(t *testing.T) {
+	s := newTestAuthServer(t)
+
+	_, sdr, err := issueAPIKey(s.ctx, s.store, "sam@example.com", "", ROLE_SDR, "", "test")
+	if err != nil {
+		t.Fatalf("issueAPIKey: %v", err)
+	}
+	if got := serveWithKey(s, http.MethodDelete, "/cache/jane@example.com", sdr, ""); got.Code != http.StatusForbidden {
+		t.Fatalf("DELETE /cache/:email as sdr = %d, want 403", got.Code)
+	}
+	if got := serveWithKey(s, http.MethodDelete, "/cache/jane@example.com", testBootstrapKey, ""); got.Code == http.StatusForbidden || got.Code == http.StatusUnauthorized {
+		t.Fatalf("DELETE /cache/:email as admin = %d", got.Code)
+	}
+}
+
+func TestUnknownWorkspaceRefused(t *testing.T) {
+	s := newTestAuthServer(t)
+	s.config.Auth.Enabled = false
+	s.config.Workspaces = map[string]WorkspaceConfig{"emea": {}}
+	if _, _, err := issueAPIKey(s.ctx, s.store, "lena@example.com", "", ROLE_SDR, "apac", "test"); err != nil {
+		t.Fatalf("issueAPIKey: %v", err)
+	}
+
+	for workspace, want := range map[string]int{
+		"":         http.StatusOK,
+		"emea":     http.StatusOK,
+		"apac":     http.StatusOK,
+		"emae":     http.StatusNotFound,
+		"Bad Name": http.StatusBadRequest,
+	} {
+		request := httptest.NewRequest(http.MethodGet, "/stats", nil)
+		request.Header.Set("X-Workspace", workspace)
+		recorder := httptest.NewRecorder()
+		s.router.ServeHTTP(recorder, request)
+		if recorder.Code != want {
+			t.Errorf("X-Workspace %q = %d, want %d", workspace, recorder.Code, want)
+		}
+	}
+
+	s.workspaces.mu.Lock()
+	defer s.workspaces.mu.Unlock()
+	if _, opened := s.workspaces.servers["emae"]; opened {
+		t.Fatal("unknown workspace was opened")
+	}
+}
@@ -0,0 +1,376 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/html"
+)
+
+const (
+	COMPANY_PROFILE_COLLECTION = "company_profiles"
+
+	COMPANY_PROFILE_SOURCE_WEBSITE = "website"
+	COMPANY_PROFILE_SOURCE_MANUAL  = "manual"
+
+	// failedProfileRetry is how long a homepage that could not be read is left
+	// alone, so generation does not wait on a dead site every time.
+	failedProfileRetry = 24 * time.Hour
+	// maxProfilePageSize bounds how much of a homepage is read.
+	maxProfilePageSize = 1 << 20
+)
+
+// freeMailDomains say nothing about a lead's employer.
+var freeMailDomains = map[string]bool{
+	"gmail.com": true, "googlemail.com": true, "yahoo.com": true, "outlook.com": true,
+	"hotmail.com": true, "live.com": true, "icloud.com": true, "me.com": true,
+	"aol.com": true, "proton.me": true, "protonmail.com": true, "gmx.com": true,
+}
+
+// CompanyProfile is what is known about the company behind a domain. Profiles
+// are read from the homepage, or saved by hand through PUT /domains/:domain/profile.
+type CompanyProfile struct {
+	Domain      string `json:"domain"`
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+	Industry    string `json:"industry,omitempty"`
+	Size        string `json:"size,omitempty"`
+	Location    string `json:"location,omitempty"`
+	Notes       string `json:"notes,omitempty"`
+	// Source is website or manual
+	Source string `json:"source"`
+	// FetchError is set when the homepage could not be read
+	FetchError string `json:"fetchError,omitempty"`
+	UpdatedAt  int64  `json:"updatedAt"`
+}
+
+type CompanyProfileResponse struct {
+	Success bool            `json:"success"`
+	Profile *CompanyProfile `json:"profile,omitempty"`
+	Error   string          `json:"error,omitempty"`
+}
+
+// profileClient only connects to public addresses. The check runs on the
+// resolved IP of every connection, including those made for redirects, so
+// neither a domain resolving to an internal host nor a redirect can reach one.
+var profileClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy: nil,
+		DialContext: (&net.Dialer{
+			Timeout: 10 * time.Second,
+			Control: func(network, address string, _ syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+					return fmt.Errorf("refusing to connect to non-public address %s", host)
+				}
+				return nil
+			},
+		}).DialContext,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 10 * time.Second,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       90 * time.Second,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 5 {
+			return errors.New("too many redirects")
+		}
+		if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+			return fmt.Errorf("redirect to unsupported scheme %q", req.URL.Scheme)
+		}
+		return nil
+	},
+}
+
+// sharedAddressSpace is the carrier-grade NAT range (RFC 6598), which the net
+// package does not count as private.
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// publicIP reports whether ip is a routable public address: not loopback,
+// private, link-local, multicast or unspecified.
+func publicIP(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+		if ip4[0] == 0 || sharedAddressSpace.Contains(ip4) {
+			return false
+		}
+	}
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() && !ip.IsMulticast() && !ip.IsUnspecified()
+}
+
+func (p *CompanyProfile) empty() bool {
+	return p.Name == "" && p.Description == "" && p.Industry == "" && p.Size == "" && p.Location == "" && p.Notes == ""
+}
+
+// stale reports whether a fetched profile should be read again.
+func (p *CompanyProfile) stale(ttl time.Duration) bool {
+	if p.Source == COMPANY_PROFILE_SOURCE_MANUAL {
+		return false
+	}
+	if p.FetchError != "" && ttl > failedProfileRetry {
+		ttl = failedProfileRetry
+	}
+	return time.Since(time.UnixMilli(p.UpdatedAt)) > ttl
+}
+
+// normalizeDomain lower-cases a company domain and rejects anything that is
+// not a public DNS name: IP literals, single-label hosts such as localhost,
+// and names under suffixes reserved for local networks.
+func normalizeDomain(domain string) (string, error) {
+	domain = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(domain), "@")))
+	domain = strings.TrimSuffix(domain, ".")
+	if domain == "" || validateEmailAddress("x@"+domain) != nil {
+		return "", fmt.Errorf("Invalid domain %q", domain)
+	}
+	if net.ParseIP(strings.Trim(domain, "[]")) != nil {
+		return "", fmt.Errorf("Invalid domain %q: IP addresses are not allowed", domain)
+	}
+	dot := strings.LastIndex(domain, ".")
+	if dot < 0 {
+		return "", fmt.Errorf("Invalid domain %q: a public domain name is required", domain)
+	}
+	tld := domain[dot+1:]
+	if _, err := strconv.Atoi(tld); err == nil || localDomainSuffixes[tld] {
+		return "", fmt.Errorf("Invalid domain %q: a public domain name is required", domain)
+	}
+	return domain, nil
+}
+
+// localDomainSuffixes only ever name hosts on a private network.
+var localDomainSuffixes = map[string]bool{
+	"localhost": true, "local": true, "localdomain": true, "internal": true,
+	"intranet": true, "lan": true, "home": true, "corp": true, "arpa": true,
+}
+
+// companyProfile returns the cached profile of a domain, reading the homepage
+// when none is cached or the cached one is stale and fetching is enabled. It
+// returns nil for free-mail domains and when nothing is known.
+func (s *CacheServer) companyProfile(ctx context.Context, domain string) (*CompanyProfile, error) {
+	if domain == "" || freeMailDomains[domain] {
+		return nil, nil
+	}
+	cfg := s.config.Generation.CompanyProfiles
+
+	var cached CompanyProfile
+	err := getRecordJSON(ctx, s.store, COMPANY_PROFILE_COLLECTION, domain, &cached)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+	found := err == nil
+	if found && (!cfg.Fetch || !cached.stale(time.Duration(cfg.TTL))) {
+		if cached.empty() {
+			return nil, nil
+		}
+		return &cached, nil
+	}
+	if !cfg.Fetch {
+		return nil, nil
+	}
+
+	fetchCtx, cancel := context.WithTimeout(ctx, time.Duration(cfg.Timeout))
+	defer cancel()
+	profile, err := fetchCompanyProfile(fetchCtx, domain)
+	if err != nil {
+		log.Printf("⚠️ Could not read the homepage of %s: %v", domain, err)
+		profile = &CompanyProfile{Domain: domain, Source: COMPANY_PROFILE_SOURCE_WEBSITE, FetchError: err.Error()}
+		if found && !cached.empty() {
+			// Keep what was read before, but wait before trying again
+			profile = &cached
+			profile.FetchError = err.Error()
+		}
+	} else {
+		log.Printf("🏢 Read company profile of %s: %s", domain, profile.Name)
+	}
+	profile.UpdatedAt = time.Now().UnixMilli()
+	if err := putRecordJSON(ctx, s.store, COMPANY_PROFILE_COLLECTION, domain, profile); err != nil {
+		log.Printf("⚠️ Failed to cache company profile of %s: %v", domain, err)
+	}
+	if profile.empty() {
+		return nil, nil
+	}
+	return profile, nil
+}
+
+// fetchCompanyProfile reads the name and description a company's homepage
+// declares in its title and meta tags.
+func fetchCompanyProfile(ctx context.Context, domain string) (*CompanyProfile, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://"+domain+"/", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (compatible; lead-generator-cache/"+SERVER_VERSION+")")
+	req.Header.Set("Accept", "text/html")
+
+	resp, err := profileClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("homepage returned %d", resp.StatusCode)
+	}
+
+	profile := &CompanyProfile{Domain: domain, Source: COMPANY_PROFILE_SOURCE_WEBSITE}
+	var title string
+	z := html.NewTokenizer(io.LimitReader(resp.Body, maxProfilePageSize))
+	// Everything of interest is in the head
+	for inHead := true; inHead; {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+			continue
+		}
+		tok := z.Token()
+		switch tok.Data {
+		case "title":
+			if title == "" && z.Next() == html.TextToken {
+				title = strings.TrimSpace(string(z.Text()))
+			}
+		case "meta":
+			var key, content string
+			for _, attr := range tok.Attr {
+				switch attr.Key {
+				case "name", "property":
+					key = strings.ToLower(attr.Val)
+				case "content":
+					content = strings.Join(strings.Fields(attr.Val), " ")
+				}
+			}
+			switch key {
+			case "og:site_name":
+				profile.Name = content
+			case "description":
+				profile.Description = content
+			case "og:description":
+				if profile.Description == "" {
+					profile.Description = content
+				}
+			}
+		case "body":
+			inHead = false
+		}
+	}
+	if profile.Name == "" {
+		profile.Name = title
+	}
+	if profile.empty() {
+		return nil, fmt.Errorf("homepage has no title or description")
+	}
+	return profile, nil
+}
+
+// getCompanyProfile returns the profile of a domain, reading its homepage when
+// nothing is cached yet.
+func (s *CacheServer) getCompanyProfile(c *gin.Context) {
+	domain, err := normalizeDomain(c.Param("domain"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, CompanyProfileResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	profile, err := s.companyProfile(c.Request.Context(), domain)
+	if err != nil {
+		log.Printf("Error loading company profile of %s: %v", domain, err)
+		c.JSON(http.StatusInternalServerError, CompanyProfileResponse{
+			Success: false,
+			Error:   "Failed to load company profile",
+		})
+		return
+	}
+	if profile == nil {
+		c.JSON(http.StatusNotFound, CompanyProfileResponse{
+			Success: false,
+			Error:   fmt.Sprintf("No profile known for %s", domain),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, CompanyProfileResponse{
+		Success: true,
+		Profile: profile,
+	})
+}
+
+// saveCompanyProfile stores a hand-written profile, which replaces the fetched
+// one and is never refreshed from the homepage.
+func (s *CacheServer) saveCompanyProfile(c *gin.Context) {
+	domain, err := normalizeDomain(c.Param("domain"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, CompanyProfileResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	var profile CompanyProfile
+	if err := c.ShouldBindJSON(&profile); err != nil {
+		c.JSON(http.StatusBadRequest, CompanyProfileResponse{
+			Success: false,
+			Error:   "Invalid JSON in request body",
+		})
+		return
+	}
+	for name, value := range map[string]string{
+		"name": profile.Name, "industry": profile.Industry, "size": profile.Size, "location": profile.Location,
+	} {
+		if len(value) > maxLeadFieldLength {
+			c.JSON(http.StatusBadRequest, CompanyProfileResponse{
+				Success: false,
+				Error:   fmt.Sprintf("%s is longer than %d characters", name, maxLeadFieldLength),
+			})
+			return
+		}
+	}
+	if len(profile.Description) > maxLeadTextLength || len(profile.Notes) > maxLeadTextLength {
+		c.JSON(http.StatusBadRequest, CompanyProfileResponse{
+			Success: false,
+			Error:   fmt.Sprintf("description and notes must be at most %d characters", maxLeadTextLength),
+		})
+		return
+	}
+	if profile.empty() {
+		c.JSON(http.StatusBadRequest, CompanyProfileResponse{
+			Success: false,
+			Error:   "Profile has no content",
+		})
+		return
+	}
+
+	profile.Domain = domain
+	profile.Source = COMPANY_PROFILE_SOURCE_MANUAL
+	profile.FetchError = ""
+	profile.UpdatedAt = time.Now().UnixMilli()
+	if err := putRecordJSON(s.ctx, s.store, COMPANY_PROFILE_COLLECTION, domain, &profile); err != nil {
+		log.Printf("Error saving company profile of %s: %v", domain, err)
+		c.JSON(http.StatusInternalServerError, CompanyProfileResponse{
+			Success: false,
+			Error:   "Failed to save company profile",
+		})
+		return
+	}
+
+	log.Printf("🏢 Saved company profile of %s", domain)
+	c.JSON(http.StatusOK, CompanyProfileResponse{
+		Success: true,
+		Profile: &profile,
+	})
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNormalizeDomain(t *testing.T) {
+	for input, want := range map[string]string{
+		"Acme.com":      "acme.com",
+		"@acme.com":     "acme.com",
+		" acme.co.uk. ": "acme.co.uk",
+	} {
+		got, err := normalizeDomain(input)
+		if err != nil || got != want {
+			t.Errorf("normalizeDomain(%q) = %q, %v; want %q", input, got, err, want)
+		}
+	}
+
+	for _, input := range []string{
+		"", "127.0.0.1", "[127.0.0.1]", "10.0.0.5", "[::1]", "localhost", "intranet",
+		"db.internal", "printer.local", "foo.localhost", "1.2.3.4.5", "not a domain",
+	} {
+		if got, err := normalizeDomain(input); err == nil {
+			t.Errorf("normalizeDomain(%q) = %q, want an error", input, got)
+		}
+	}
+}
+
+func TestPublicIP(t *testing.T) {
+	for addr, want := range map[string]bool{
+		"93.184.216.34":    true,
+		"2606:4700::1111":  true,
+		"127.0.0.1":        false,
+		"10.1.2.3":         false,
+		"172.16.0.1":       false,
+		"192.168.1.1":      false,
+		"169.254.169.254":  false,
+		"100.64.0.1":       false,
+		"0.0.0.0":          false,
+		"224.0.0.1":        false,
+		"::1":              false,
+		"fe80::1":          false,
+		"fd00::1":          false,
+		"::ffff:127.0.0.1": false,
+	} {
+		if got := publicIP(net.ParseIP(addr)); got != want {
+			t.Errorf("publicIP(%s) = %t, want %t", addr, got, want)
+		}
+	}
+}
+
+func TestProfileClientRefusesInternalAddresses(t *testing.T) {
+	internal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<title>secret</title>"))
+	}))
+	defer internal.Close()
+
+	resp, err := profileClient.Get(internal.URL)
+	if err == nil {
+		resp.Body.Close()
+		t.Fatalf("profileClient reached %s, want the connection refused", internal.URL)
+	}
+}
@@ -0,0 +1,755 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Duration wraps time.Duration so config files can use values like "30s" or "5m".
+type Duration time.Duration
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(strings.TrimSpace(string(text)))
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+type Config struct {
+	Server ServerConfig `yaml:"server" toml:"server"`
+	CORS   CORSConfig   `yaml:"cors" toml:"cors"`
+	Auth   AuthConfig   `yaml:"auth" toml:"auth"`
+	Store  StoreConfig  `yaml:"store" toml:"store"`
+	Redis  RedisConfig  `yaml:"redis" toml:"redis"`
+	OpenAI OpenAIConfig `yaml:"openai" toml:"openai"`
+	Keys   KeysConfig   `yaml:"keys" toml:"keys"`
+	Export ExportConfig `yaml:"export" toml:"export"`
+
+	Verification VerificationConfig `yaml:"verification" toml:"verification"`
+	Generation   GenerationConfig   `yaml:"generation" toml:"generation"`
+
+	// Workspaces overrides settings per workspace, by name.
+	Workspaces map[string]WorkspaceConfig `yaml:"workspaces" toml:"workspaces"`
+}
+
+type ServerConfig struct {
+	Port            int      `yaml:"port" toml:"port"`
+	ReadTimeout     Duration `yaml:"readTimeout" toml:"readTimeout"`
+	WriteTimeout    Duration `yaml:"writeTimeout" toml:"writeTimeout"`
+	IdleTimeout     Duration `yaml:"idleTimeout" toml:"idleTimeout"`
+	ShutdownTimeout Duration `yaml:"shutdownTimeout" toml:"shutdownTimeout"`
+}
+
+type CORSConfig struct {
+	AllowedOrigins []string `yaml:"allowedOrigins" toml:"allowedOrigins"`
+}
+
+type AuthConfig struct {
+	// Enabled requires an API key (Authorization: Bearer or X-API-Key) on every
+	// route except /health and /ping. Keys are created with --create-key or
+	// POST /auth/keys.
+	Enabled bool `yaml:"enabled" toml:"enabled"`
+	// BootstrapKey is accepted as an admin key of the default workspace without
+	// being stored, so the first keys can be made with POST /auth/keys where
+	// --create-key cannot reach the store, as with the memory backend.
+	BootstrapKey string `yaml:"bootstrapKey" toml:"bootstrapKey"`
+}
+
+// minBootstrapKeyLength keeps auth.bootstrapKey from being guessable.
+const minBootstrapKeyLength = 32
+
+// WorkspaceConfig holds a workspace's own generation settings. Template
+// replaces generation.template and Variables (such as senderCompany and
+// calendarLink) are merged over generation.variables.
+type WorkspaceConfig struct {
+	Template  string            `yaml:"template" toml:"template"`
+	Variables map[string]string `yaml:"variables" toml:"variables"`
+}
+
+type StoreConfig struct {
+	// Backend is one of "redis", "memory" or "bolt".
+	Backend string `yaml:"backend" toml:"backend"`
+	// Path is the database file used by the bolt backend.
+	Path string `yaml:"path" toml:"path"`
+}
+
+type RedisConfig struct {
+	Addr          string   `yaml:"addr" toml:"addr"`
+	Username      string   `yaml:"username" toml:"username"`
+	Password      string   `yaml:"password" toml:"password"`
+	DB            int      `yaml:"db" toml:"db"`
+	TLS           bool     `yaml:"tls" toml:"tls"`
+	TLSSkipVerify bool     `yaml:"tlsSkipVerify" toml:"tlsSkipVerify"`
+	DialTimeout   Duration `yaml:"dialTimeout" toml:"dialTimeout"`
+	ReadTimeout   Duration `yaml:"readTimeout" toml:"readTimeout"`
+	WriteTimeout  Duration `yaml:"writeTimeout" toml:"writeTimeout"`
+	PoolSize      int      `yaml:"poolSize" toml:"poolSize"`
+	MinIdleConns  int      `yaml:"minIdleConns" toml:"minIdleConns"`
+	PoolTimeout   Duration `yaml:"poolTimeout" toml:"poolTimeout"`
+}
+
+type OpenAIConfig struct {
+	APIKey   string   `yaml:"apiKey" toml:"apiKey"`
+	Model    string   `yaml:"model" toml:"model"`
+	Endpoint string   `yaml:"endpoint" toml:"endpoint"`
+	Timeout  Duration `yaml:"timeout" toml:"timeout"`
+}
+
+type GenerationConfig struct {
+	// Provider is the default email generator: "openai", "gemini" or "stub"
+	// (deterministic, no network). Requests may pick another with "provider".
+	Provider string       `yaml:"provider" toml:"provider"`
+	Gemini   GeminiConfig `yaml:"gemini" toml:"gemini"`
+	// Template is the prompt template used when a request has no templateId.
+	Template string `yaml:"template" toml:"template"`
+	// Variables are default prompt template variables such as senderCompany,
+	// calendarLink, tone, length and language.
+	Variables map[string]string `yaml:"variables" toml:"variables"`
+	// Concurrency is how many ?async=true generations run at once; further
+	// jobs wait for a free worker.
+	Concurrency int                        `yaml:"concurrency" toml:"concurrency"`
+	Validation  GenerationValidationConfig `yaml:"validation" toml:"validation"`
+	// Retry and CircuitBreaker apply to every call to an AI provider.
+	Retry          ProviderRetryConfig  `yaml:"retry" toml:"retry"`
+	CircuitBreaker CircuitBreakerConfig `yaml:"circuitBreaker" toml:"circuitBreaker"`
+	// Pricing maps a model name to its price, used to estimate cost.
+	Pricing map[string]ModelPricing `yaml:"pricing" toml:"pricing"`
+	Budget  GenerationBudgetConfig  `yaml:"budget" toml:"budget"`
+	// CompanyProfiles controls the company context added to prompts for leads.
+	CompanyProfiles CompanyProfileConfig `yaml:"companyProfiles" toml:"companyProfiles"`
+	// ReuseWithinDays returns the email saved for a lead instead of generating
+	// again when it came from the same provider and prompt (template version,
+	// variables and lead context) within that many days; 0 always generates.
+	ReuseWithinDays int `yaml:"reuseWithinDays" toml:"reuseWithinDays"`
+}
+
+// CompanyProfileConfig controls how company profiles are cached. Fetched
+// profiles are read from the company's homepage and refreshed after TTL;
+// profiles saved through the API never expire.
+type CompanyProfileConfig struct {
+	Fetch   bool     `yaml:"fetch" toml:"fetch"`
+	TTL     Duration `yaml:"ttl" toml:"ttl"`
+	Timeout Duration `yaml:"timeout" toml:"timeout"`
+}
+
+// ModelPricing is a model's price in USD per million tokens.
+type ModelPricing struct {
+	InputPerMillion  float64 `yaml:"inputPerMillion" toml:"inputPerMillion"`
+	OutputPerMillion float64 `yaml:"outputPerMillion" toml:"outputPerMillion"`
+}
+
+// GenerationBudgetConfig caps estimated spend per calendar month (UTC);
+// 0 means no cap.
+type GenerationBudgetConfig struct {
+	// MonthlyUSD caps the spend of every workspace together
+	MonthlyUSD float64 `yaml:"monthlyUsd" toml:"monthlyUsd"`
+	// UserMonthlyUSD caps each user within a workspace
+	UserMonthlyUSD float64 `yaml:"userMonthlyUsd" toml:"userMonthlyUsd"`
+}
+
+// ProviderRetryConfig controls retries of 429, 5xx and network errors.
+type ProviderRetryConfig struct {
+	MaxRetries int      `yaml:"maxRetries" toml:"maxRetries"`
+	BaseDelay  Duration `yaml:"baseDelay" toml:"baseDelay"`
+	MaxDelay   Duration `yaml:"maxDelay" toml:"maxDelay"`
+}
+
+// CircuitBreakerConfig opens a provider's breaker after FailureThreshold
+// consecutive failed calls; it stays open for Cooldown. 0 disables it.
+type CircuitBreakerConfig struct {
+	FailureThreshold int      `yaml:"failureThreshold" toml:"failureThreshold"`
+	Cooldown         Duration `yaml:"cooldown" toml:"cooldown"`
+}
+
+// GenerationValidationConfig controls how generated emails are checked.
+type GenerationValidationConfig struct {
+	// MaxAttempts is how many times a provider is asked before the best
+	// email is returned together with the checks it still fails.
+	MaxAttempts int `yaml:"maxAttempts" toml:"maxAttempts"`
+	// WordTolerance is how far, in percent, the body may stray from the
+	// template's length variable.
+	WordTolerance int `yaml:"wordTolerance" toml:"wordTolerance"`
+}
+
+type GeminiConfig struct {
+	APIKey string `yaml:"apiKey" toml:"apiKey"`
+	Model  string `yaml:"model" toml:"model"`
+	// Endpoint is the models base URL; the request goes to <endpoint>/<model>:generateContent.
+	Endpoint string   `yaml:"endpoint" toml:"endpoint"`
+	Timeout  Duration `yaml:"timeout" toml:"timeout"`
+}
+
+type KeysConfig struct {
+	LeadPrefix  string `yaml:"leadPrefix" toml:"leadPrefix"`
+	EmailPrefix string `yaml:"emailPrefix" toml:"emailPrefix"`
+	// RecordPrefix namespaces server metadata such as export batches.
+	RecordPrefix string `yaml:"recordPrefix" toml:"recordPrefix"`
+}
+
+type ExportConfig struct {
+	// Presets adds column layouts to, or overrides, the built-in ones by name.
+	Presets map[string]ExportPreset `yaml:"presets" toml:"presets"`
+}
+
+type VerificationConfig struct {
+	// Provider is "neverbounce", "smtp" (built-in MX/SMTP probing) or "fake"
+	// (deterministic, no network). When unset it is neverbounce if its apiKey
+	// is set, otherwise smtp.
+	Provider    string             `yaml:"provider" toml:"provider"`
+	NeverBounce NeverBounceConfig  `yaml:"neverbounce" toml:"neverbounce"`
+	SMTP        SMTPVerifierConfig `yaml:"smtp" toml:"smtp"`
+	// BatchConcurrency is how many addresses a /verify/batch job checks at once.
+	BatchConcurrency int `yaml:"batchConcurrency" toml:"batchConcurrency"`
+	// BatchMaxEmails caps the size of a single /verify/batch job.
+	BatchMaxEmails int `yaml:"batchMaxEmails" toml:"batchMaxEmails"`
+}
+
+type NeverBounceConfig struct {
+	APIKey   string   `yaml:"apiKey" toml:"apiKey"`
+	Endpoint string   `yaml:"endpoint" toml:"endpoint"`
+	Timeout  Duration `yaml:"timeout" toml:"timeout"`
+}
+
+type SMTPVerifierConfig struct {
+	// HeloName should be a hostname that resolves to this server; many mail
+	// servers reject probes from unknown names.
+	HeloName string `yaml:"heloName" toml:"heloName"`
+	// MailFrom is the envelope sender; empty sends the null sender <>.
+	MailFrom string   `yaml:"mailFrom" toml:"mailFrom"`
+	Port     int      `yaml:"port" toml:"port"`
+	Timeout  Duration `yaml:"timeout" toml:"timeout"`
+	// DNSServer (host:port) replaces the system resolver for MX lookups.
+	DNSServer string `yaml:"dnsServer" toml:"dnsServer"`
+	// DisposableDomains extends the built-in list of throwaway-mail domains.
+	DisposableDomains []string `yaml:"disposableDomains" toml:"disposableDomains"`
+}
+
+const REDACTED = "********"
+
+// DefaultConfig returns the settings the server used before it was configurable,
+// minus the Redis Cloud credentials which must now be supplied explicitly.
+func DefaultConfig() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Port:            3001,
+			ReadTimeout:     Duration(30 * time.Second),
+			WriteTimeout:    Duration(time.Minute),
+			IdleTimeout:     Duration(10 * time.Minute),
+			ShutdownTimeout: Duration(10 * time.Second),
+		},
+		CORS: CORSConfig{
+			AllowedOrigins: []string{"chrome-extension://*", "moz-extension://*", "http://localhost:*"},
+		},
+		Auth: AuthConfig{
+			Enabled: true,
+		},
+		Store: StoreConfig{
+			Backend: STORE_BACKEND_REDIS,
+			Path:    "leads.db",
+		},
+		Redis: RedisConfig{
+			Addr:         "localhost:6379",
+			DB:           0,
+			DialTimeout:  Duration(10 * time.Second),
+			ReadTimeout:  Duration(30 * time.Second),
+			WriteTimeout: Duration(30 * time.Second),
+			PoolSize:     10,
+			PoolTimeout:  Duration(30 * time.Second),
+		},
+		OpenAI: OpenAIConfig{
+			Model:    "gpt-5",
+			Endpoint: "https://api.openai.com/v1/responses",
+			Timeout:  Duration(3 * time.Minute),
+		},
+		Keys: KeysConfig{
+			LeadPrefix:   CACHE_KEY_PREFIX,
+			EmailPrefix:  CACHE_KEY_PREFIX_EMAIL,
+			RecordPrefix: CACHE_KEY_PREFIX_RECORD,
+		},
+		Verification: VerificationConfig{
+			// Provider is left empty so ReadConfig can pick one, see defaultVerifier
+			NeverBounce: NeverBounceConfig{
+				Endpoint: "https://api.neverbounce.com/v4/single/check",
+				Timeout:  Duration(30 * time.Second),
+			},
+			SMTP: SMTPVerifierConfig{
+				HeloName: "localhost",
+				Port:     25,
+				Timeout:  Duration(15 * time.Second),
+			},
+			BatchConcurrency: 5,
+			BatchMaxEmails:   1000,
+		},
+		Generation: GenerationConfig{
+			Provider: GENERATOR_OPENAI,
+			Gemini: GeminiConfig{
+				Model:    "gemini-2.5-flash-lite",
+				Endpoint: "https://generativelanguage.googleapis.com/v1beta/models",
+				Timeout:  Duration(3 * time.Minute),
+			},
+			Template: DEFAULT_PROMPT_TEMPLATE,
+			Variables: map[string]string{
+				"senderCompany": "DevXworks",
+				"calendarLink":  "https://calendly.com/ayush-devxworks/intro-call-with-ayush-devxworks",
+				"tone":          "friendly and professional",
+				"length":        "120 to 150",
+				"language":      "English",
+			},
+			Concurrency: 4,
+			Validation: GenerationValidationConfig{
+				MaxAttempts:   3,
+				WordTolerance: 20,
+			},
+			Retry: ProviderRetryConfig{
+				MaxRetries: 3,
+				BaseDelay:  Duration(time.Second),
+				MaxDelay:   Duration(30 * time.Second),
+			},
+			CircuitBreaker: CircuitBreakerConfig{
+				FailureThreshold: 5,
+				Cooldown:         Duration(30 * time.Second),
+			},
+			Pricing: map[string]ModelPricing{
+				"gpt-5":                 {InputPerMillion: 1.25, OutputPerMillion: 10},
+				"gemini-2.5-flash-lite": {InputPerMillion: 0.10, OutputPerMillion: 0.40},
+			},
+			CompanyProfiles: CompanyProfileConfig{
+				Fetch:   true,
+				TTL:     Duration(30 * 24 * time.Hour),
+				Timeout: Duration(5 * time.Second),
+			},
+		},
+	}
+}
+
+// LoadConfig builds the effective configuration with ReadConfig and validates it.
+func LoadConfig(path string) (*Config, error) {
+	cfg, err := ReadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// ReadConfig layers defaults, then the optional config file (YAML or TOML,
+// chosen by extension), then environment variables, without validating the
+// result, so --print-config can show a config that does not validate.
+func ReadConfig(path string) (*Config, error) {
+	cfg := DefaultConfig()
+
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := cfg.applyEnv(); err != nil {
+		return nil, err
+	}
+
+	if cfg.Verification.Provider == "" {
+		cfg.Verification.Provider = cfg.defaultVerifier()
+	}
+
+	return cfg, nil
+}
+
+// defaultVerifier is the verification provider used when none is configured:
+// NeverBounce when it has an API key, otherwise the built-in SMTP check, so a
+// fresh checkout starts without any key.
+func (cfg *Config) defaultVerifier() string {
+	if cfg.Verification.NeverBounce.APIKey != "" {
+		return VERIFIER_NEVERBOUNCE
+	}
+	return VERIFIER_SMTP
+}
+
+func (cfg *Config) loadFile(path string) error {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file %s: %v", path, err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(raw, cfg)
+	case ".toml":
+		err = toml.Unmarshal(raw, cfg)
+	default:
+		return fmt.Errorf("unsupported config file extension %q (use .yaml, .yml or .toml)", filepath.Ext(path))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse config file %s: %v", path, err)
+	}
+
+	return nil
+}
+
+// applyEnv overrides file and default values with any environment variables that are set.
+func (cfg *Config) applyEnv() error {
+	var errs []string
+
+	envString := func(name string, dst *string) {
+		if v, ok := os.LookupEnv(name); ok {
+			*dst = v
+		}
+	}
+	envInt := func(name string, dst *int) {
+		if v, ok := os.LookupEnv(name); ok {
+			n, err := strconv.Atoi(strings.TrimSpace(v))
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %q is not an integer", name, v))
+				return
+			}
+			*dst = n
+		}
+	}
+	envBool := func(name string, dst *bool) {
+		if v, ok := os.LookupEnv(name); ok {
+			b, err := strconv.ParseBool(strings.TrimSpace(v))
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %q is not a boolean", name, v))
+				return
+			}
+			*dst = b
+		}
+	}
+	envFloat := func(name string, dst *float64) {
+		if v, ok := os.LookupEnv(name); ok {
+			f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %q is not a number", name, v))
+				return
+			}
+			*dst = f
+		}
+	}
+	envDuration := func(name string, dst *Duration) {
+		if v, ok := os.LookupEnv(name); ok {
+			if err := dst.UnmarshalText([]byte(v)); err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %q is not a duration", name, v))
+			}
+		}
+	}
+	envList := func(name string, dst *[]string) {
+		if v, ok := os.LookupEnv(name); ok {
+			*dst = splitList(v)
+		}
+	}
+
+	envInt("PORT", &cfg.Server.Port)
+	envDuration("SERVER_READ_TIMEOUT", &cfg.Server.ReadTimeout)
+	envDuration("SERVER_WRITE_TIMEOUT", &cfg.Server.WriteTimeout)
+	envDuration("SERVER_IDLE_TIMEOUT", &cfg.Server.IdleTimeout)
+	envDuration("SERVER_SHUTDOWN_TIMEOUT", &cfg.Server.ShutdownTimeout)
+
+	envList("CORS_ALLOWED_ORIGINS", &cfg.CORS.AllowedOrigins)
+	envBool("AUTH_ENABLED", &cfg.Auth.Enabled)
+	envString("AUTH_BOOTSTRAP_KEY", &cfg.Auth.BootstrapKey)
+
+	envString("STORE_BACKEND", &cfg.Store.Backend)
+	envString("STORE_PATH", &cfg.Store.Path)
+
+	envString("REDIS_ADDR", &cfg.Redis.Addr)
+	envString("REDIS_USERNAME", &cfg.Redis.Username)
+	envString("REDIS_PASSWORD", &cfg.Redis.Password)
+	envInt("REDIS_DB", &cfg.Redis.DB)
+	envBool("REDIS_TLS", &cfg.Redis.TLS)
+	envBool("REDIS_TLS_SKIP_VERIFY", &cfg.Redis.TLSSkipVerify)
+	envDuration("REDIS_DIAL_TIMEOUT", &cfg.Redis.DialTimeout)
+	envDuration("REDIS_READ_TIMEOUT", &cfg.Redis.ReadTimeout)
+	envDuration("REDIS_WRITE_TIMEOUT", &cfg.Redis.WriteTimeout)
+	envInt("REDIS_POOL_SIZE", &cfg.Redis.PoolSize)
+	envInt("REDIS_MIN_IDLE_CONNS", &cfg.Redis.MinIdleConns)
+	envDuration("REDIS_POOL_TIMEOUT", &cfg.Redis.PoolTimeout)
+
+	envString("OPENAI_API_KEY", &cfg.OpenAI.APIKey)
+	envString("OPENAI_MODEL", &cfg.OpenAI.Model)
+	envString("OPENAI_ENDPOINT", &cfg.OpenAI.Endpoint)
+	envDuration("OPENAI_TIMEOUT", &cfg.OpenAI.Timeout)
+
+	envString("EMAIL_GENERATOR", &cfg.Generation.Provider)
+	envString("GEMINI_API_KEY", &cfg.Generation.Gemini.APIKey)
+	envString("GEMINI_MODEL", &cfg.Generation.Gemini.Model)
+	envString("GEMINI_ENDPOINT", &cfg.Generation.Gemini.Endpoint)
+	envDuration("GEMINI_TIMEOUT", &cfg.Generation.Gemini.Timeout)
+	envString("PROMPT_TEMPLATE", &cfg.Generation.Template)
+	envInt("EMAIL_GENERATION_CONCURRENCY", &cfg.Generation.Concurrency)
+	envInt("EMAIL_VALIDATION_MAX_ATTEMPTS", &cfg.Generation.Validation.MaxAttempts)
+	envInt("EMAIL_VALIDATION_WORD_TOLERANCE", &cfg.Generation.Validation.WordTolerance)
+	envInt("PROVIDER_MAX_RETRIES", &cfg.Generation.Retry.MaxRetries)
+	envDuration("PROVIDER_RETRY_BASE_DELAY", &cfg.Generation.Retry.BaseDelay)
+	envDuration("PROVIDER_RETRY_MAX_DELAY", &cfg.Generation.Retry.MaxDelay)
+	envInt("PROVIDER_BREAKER_THRESHOLD", &cfg.Generation.CircuitBreaker.FailureThreshold)
+	envDuration("PROVIDER_BREAKER_COOLDOWN", &cfg.Generation.CircuitBreaker.Cooldown)
+	envFloat("GENERATION_MONTHLY_BUDGET_USD", &cfg.Generation.Budget.MonthlyUSD)
+	envFloat("GENERATION_USER_MONTHLY_BUDGET_USD", &cfg.Generation.Budget.UserMonthlyUSD)
+	envBool("COMPANY_PROFILE_FETCH", &cfg.Generation.CompanyProfiles.Fetch)
+	envDuration("COMPANY_PROFILE_TTL", &cfg.Generation.CompanyProfiles.TTL)
+	envDuration("COMPANY_PROFILE_TIMEOUT", &cfg.Generation.CompanyProfiles.Timeout)
+	envInt("GENERATION_REUSE_DAYS", &cfg.Generation.ReuseWithinDays)
+
+	envString("LEAD_KEY_PREFIX", &cfg.Keys.LeadPrefix)
+	envString("EMAIL_KEY_PREFIX", &cfg.Keys.EmailPrefix)
+	envString("RECORD_KEY_PREFIX", &cfg.Keys.RecordPrefix)
+
+	envString("VERIFIER_PROVIDER", &cfg.Verification.Provider)
+	envString("NEVERBOUNCE_API_KEY", &cfg.Verification.NeverBounce.APIKey)
+	envString("NEVERBOUNCE_ENDPOINT", &cfg.Verification.NeverBounce.Endpoint)
+	envDuration("NEVERBOUNCE_TIMEOUT", &cfg.Verification.NeverBounce.Timeout)
+	envString("SMTP_VERIFIER_HELO", &cfg.Verification.SMTP.HeloName)
+	envString("SMTP_VERIFIER_FROM", &cfg.Verification.SMTP.MailFrom)
+	envInt("SMTP_VERIFIER_PORT", &cfg.Verification.SMTP.Port)
+	envDuration("SMTP_VERIFIER_TIMEOUT", &cfg.Verification.SMTP.Timeout)
+	envString("SMTP_VERIFIER_DNS_SERVER", &cfg.Verification.SMTP.DNSServer)
+	envList("SMTP_VERIFIER_DISPOSABLE_DOMAINS", &cfg.Verification.SMTP.DisposableDomains)
+	envInt("VERIFY_BATCH_CONCURRENCY", &cfg.Verification.BatchConcurrency)
+	envInt("VERIFY_BATCH_MAX_EMAILS", &cfg.Verification.BatchMaxEmails)
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid environment: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Validate reports every problem with the configuration at once so a bad
+// deployment can be fixed in one pass.
+func (cfg *Config) Validate() error {
+	var errs []string
+
+	if cfg.Server.Port <= 0 || cfg.Server.Port >= 65536 {
+		errs = append(errs, fmt.Sprintf("server.port %d is out of range", cfg.Server.Port))
+	}
+	if cfg.Server.ReadTimeout < 0 || cfg.Server.WriteTimeout < 0 || cfg.Server.IdleTimeout < 0 {
+		errs = append(errs, "server timeouts must not be negative")
+	}
+	if cfg.Server.ShutdownTimeout <= 0 {
+		errs = append(errs, "server.shutdownTimeout must be positive")
+	}
+
+	if len(cfg.CORS.AllowedOrigins) == 0 {
+		errs = append(errs, "cors.allowedOrigins must list at least one origin (use \"*\" to allow all)")
+	}
+
+	if cfg.Auth.BootstrapKey != "" && len(cfg.Auth.BootstrapKey) < minBootstrapKeyLength {
+		errs = append(errs, fmt.Sprintf("auth.bootstrapKey must be at least %d characters", minBootstrapKeyLength))
+	}
+	if cfg.Auth.Enabled && cfg.Store.Backend == STORE_BACKEND_MEMORY && cfg.Auth.BootstrapKey == "" {
+		errs = append(errs, "auth.bootstrapKey is required with auth.enabled and the memory backend, since --create-key cannot reach a memory store")
+	}
+
+	switch cfg.Store.Backend {
+	case STORE_BACKEND_REDIS:
+		if cfg.Redis.Addr == "" {
+			errs = append(errs, "redis.addr is required")
+		} else if !strings.Contains(cfg.Redis.Addr, ":") {
+			errs = append(errs, fmt.Sprintf("redis.addr %q must be host:port", cfg.Redis.Addr))
+		}
+		if cfg.Redis.DB < 0 {
+			errs = append(errs, "redis.db must not be negative")
+		}
+		if cfg.Redis.PoolSize <= 0 {
+			errs = append(errs, "redis.poolSize must be positive")
+		}
+		if cfg.Redis.MinIdleConns < 0 || cfg.Redis.MinIdleConns > cfg.Redis.PoolSize {
+			errs = append(errs, "redis.minIdleConns must be between 0 and redis.poolSize")
+		}
+	case STORE_BACKEND_BOLT:
+		if cfg.Store.Path == "" {
+			errs = append(errs, "store.path is required for the bolt backend")
+		}
+	case STORE_BACKEND_MEMORY:
+	default:
+		errs = append(errs, fmt.Sprintf("store.backend %q must be one of redis, memory, bolt", cfg.Store.Backend))
+	}
+
+	if cfg.OpenAI.Model == "" {
+		errs = append(errs, "openai.model is required")
+	}
+	if !strings.HasPrefix(cfg.OpenAI.Endpoint, "http://") && !strings.HasPrefix(cfg.OpenAI.Endpoint, "https://") {
+		errs = append(errs, fmt.Sprintf("openai.endpoint %q must be an http(s) URL", cfg.OpenAI.Endpoint))
+	}
+	if cfg.OpenAI.Timeout <= 0 {
+		errs = append(errs, "openai.timeout must be positive")
+	}
+
+	switch cfg.Generation.Provider {
+	case GENERATOR_OPENAI, GENERATOR_GEMINI, GENERATOR_STUB:
+	default:
+		errs = append(errs, fmt.Sprintf("generation.provider %q must be one of openai, gemini, stub", cfg.Generation.Provider))
+	}
+	if cfg.Generation.Gemini.Model == "" {
+		errs = append(errs, "generation.gemini.model is required")
+	}
+	if !strings.HasPrefix(cfg.Generation.Gemini.Endpoint, "http://") && !strings.HasPrefix(cfg.Generation.Gemini.Endpoint, "https://") {
+		errs = append(errs, fmt.Sprintf("generation.gemini.endpoint %q must be an http(s) URL", cfg.Generation.Gemini.Endpoint))
+	}
+	if cfg.Generation.Gemini.Timeout <= 0 {
+		errs = append(errs, "generation.gemini.timeout must be positive")
+	}
+	if !promptTemplateIDPattern.MatchString(cfg.Generation.Template) {
+		errs = append(errs, fmt.Sprintf("generation.template %q is not a valid template id", cfg.Generation.Template))
+	}
+	if cfg.Generation.Concurrency <= 0 {
+		errs = append(errs, "generation.concurrency must be positive")
+	}
+	if cfg.Generation.Validation.MaxAttempts <= 0 {
+		errs = append(errs, "generation.validation.maxAttempts must be positive")
+	}
+	if cfg.Generation.Validation.WordTolerance < 0 || cfg.Generation.Validation.WordTolerance > 100 {
+		errs = append(errs, "generation.validation.wordTolerance must be between 0 and 100")
+	}
+	if cfg.Generation.Retry.MaxRetries < 0 {
+		errs = append(errs, "generation.retry.maxRetries must not be negative")
+	}
+	if cfg.Generation.Retry.BaseDelay <= 0 || cfg.Generation.Retry.MaxDelay < cfg.Generation.Retry.BaseDelay {
+		errs = append(errs, "generation.retry.baseDelay must be positive and not above maxDelay")
+	}
+	if cfg.Generation.CircuitBreaker.FailureThreshold < 0 {
+		errs = append(errs, "generation.circuitBreaker.failureThreshold must not be negative")
+	}
+	if cfg.Generation.CircuitBreaker.FailureThreshold > 0 && cfg.Generation.CircuitBreaker.Cooldown <= 0 {
+		errs = append(errs, "generation.circuitBreaker.cooldown must be positive")
+	}
+	for model, price := range cfg.Generation.Pricing {
+		if price.InputPerMillion < 0 || price.OutputPerMillion < 0 {
+			errs = append(errs, fmt.Sprintf("generation.pricing.%s must not be negative", model))
+		}
+	}
+	if cfg.Generation.Budget.MonthlyUSD < 0 || cfg.Generation.Budget.UserMonthlyUSD < 0 {
+		errs = append(errs, "generation.budget values must not be negative")
+	}
+	if cfg.Generation.CompanyProfiles.TTL <= 0 || cfg.Generation.CompanyProfiles.Timeout <= 0 {
+		errs = append(errs, "generation.companyProfiles.ttl and timeout must be positive")
+	}
+	if cfg.Generation.ReuseWithinDays < 0 {
+		errs = append(errs, "generation.reuseWithinDays must not be negative")
+	}
+
+	if cfg.Keys.LeadPrefix == "" || cfg.Keys.EmailPrefix == "" || cfg.Keys.RecordPrefix == "" {
+		errs = append(errs, "keys.leadPrefix, keys.emailPrefix and keys.recordPrefix are required")
+	} else if cfg.Keys.LeadPrefix == cfg.Keys.EmailPrefix || cfg.Keys.LeadPrefix == cfg.Keys.RecordPrefix || cfg.Keys.EmailPrefix == cfg.Keys.RecordPrefix {
+		errs = append(errs, "keys.leadPrefix, keys.emailPrefix and keys.recordPrefix must differ")
+	}
+	for _, prefix := range []string{cfg.Keys.LeadPrefix, cfg.Keys.EmailPrefix, cfg.Keys.RecordPrefix} {
+		if strings.HasPrefix(prefix, WORKSPACE_KEY_PREFIX) {
+			errs = append(errs, fmt.Sprintf("keys prefixes must not start with %q, which is reserved for workspaces", WORKSPACE_KEY_PREFIX))
+			break
+		}
+	}
+	for name := range cfg.Workspaces {
+		if !validWorkspaceName(name) {
+			errs = append(errs, fmt.Sprintf("workspaces.%s: %s", name, workspaceNameRule))
+		}
+	}
+
+	for name, preset := range cfg.Export.Presets {
+		if err := preset.validate(); err != nil {
+			errs = append(errs, fmt.Sprintf("export.presets.%s: %v", name, err))
+		}
+	}
+
+	switch cfg.Verification.Provider {
+	case VERIFIER_NEVERBOUNCE:
+		nb := cfg.Verification.NeverBounce
+		if nb.APIKey == "" {
+			errs = append(errs, "verification.neverbounce.apiKey is required when verification.provider is neverbounce (set NEVERBOUNCE_API_KEY, or choose the smtp or fake provider)")
+		}
+		if !strings.HasPrefix(nb.Endpoint, "http://") && !strings.HasPrefix(nb.Endpoint, "https://") {
+			errs = append(errs, fmt.Sprintf("verification.neverbounce.endpoint %q must be an http(s) URL", nb.Endpoint))
+		}
+		if nb.Timeout <= 0 {
+			errs = append(errs, "verification.neverbounce.timeout must be positive")
+		}
+	case VERIFIER_SMTP:
+		smtp := cfg.Verification.SMTP
+		if smtp.HeloName == "" {
+			errs = append(errs, "verification.smtp.heloName is required")
+		}
+		if smtp.MailFrom != "" && validateEmailAddress(smtp.MailFrom) != nil {
+			errs = append(errs, fmt.Sprintf("verification.smtp.mailFrom %q is not a valid email address", smtp.MailFrom))
+		}
+		if smtp.Port <= 0 || smtp.Port >= 65536 {
+			errs = append(errs, fmt.Sprintf("verification.smtp.port %d is out of range", smtp.Port))
+		}
+		if smtp.Timeout <= 0 {
+			errs = append(errs, "verification.smtp.timeout must be positive")
+		}
+		if smtp.DNSServer != "" && !strings.Contains(smtp.DNSServer, ":") {
+			errs = append(errs, fmt.Sprintf("verification.smtp.dnsServer %q must be host:port", smtp.DNSServer))
+		}
+	case VERIFIER_FAKE:
+	default:
+		errs = append(errs, fmt.Sprintf("verification.provider %q must be one of neverbounce, smtp, fake", cfg.Verification.Provider))
+	}
+	if cfg.Verification.BatchConcurrency <= 0 {
+		errs = append(errs, "verification.batchConcurrency must be positive")
+	}
+	if cfg.Verification.BatchMaxEmails <= 0 {
+		errs = append(errs, "verification.batchMaxEmails must be positive")
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration:\n  - %s", strings.Join(errs, "\n  - "))
+	}
+	return nil
+}
+
+// Redacted returns a copy of the config with secrets masked, safe to print or log.
+func (cfg *Config) Redacted() *Config {
+	out := *cfg
+	out.CORS.AllowedOrigins = append([]string(nil), cfg.CORS.AllowedOrigins...)
+	if out.Auth.BootstrapKey != "" {
+		out.Auth.BootstrapKey = REDACTED
+	}
+	if out.Redis.Password != "" {
+		out.Redis.Password = REDACTED
+	}
+	if out.OpenAI.APIKey != "" {
+		out.OpenAI.APIKey = REDACTED
+	}
+	if out.Generation.Gemini.APIKey != "" {
+		out.Generation.Gemini.APIKey = REDACTED
+	}
+	if out.Verification.NeverBounce.APIKey != "" {
+		out.Verification.NeverBounce.APIKey = REDACTED
+	}
+	return &out
+}
+
+// Dump renders the redacted config as YAML for --print-config.
+func (cfg *Config) Dump() (string, error) {
+	out, err := yaml.Marshal(cfg.Redacted())
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,58 @@
+package main
+
+import "testing"
+
+func TestLoadConfigDefaultsStartWithoutKeys(t *testing.T) {
+	t.Setenv("NEVERBOUNCE_API_KEY", "")
+	t.Setenv("VERIFIER_PROVIDER", "")
+
+	cfg, err := LoadConfig("")
+	if err != nil {
+		t.Fatalf("LoadConfig without a file: %v", err)
+	}
+	if cfg.Verification.Provider != VERIFIER_SMTP {
+		t.Fatalf("verification.provider = %q, want %q", cfg.Verification.Provider, VERIFIER_SMTP)
+	}
+}
+
+func TestReadConfigDefaultVerifier(t *testing.T) {
+	tests := []struct {
+		name     string
+		apiKey   string
+		provider string
+		want     string
+	}{
+		{"no key", "", "", VERIFIER_SMTP},
+		{"NeverBounce key", "nb-key", "", VERIFIER_NEVERBOUNCE},
+		{"explicit provider", "nb-key", VERIFIER_FAKE, VERIFIER_FAKE},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("NEVERBOUNCE_API_KEY", tt.apiKey)
+			t.Setenv("VERIFIER_PROVIDER", tt.provider)
+			cfg, err := ReadConfig("")
+			if err != nil {
+				t.Fatalf("ReadConfig: %v", err)
+			}
+			if cfg.Verification.Provider != tt.want {
+				t.Fatalf("verification.provider = %q, want %q", cfg.Verification.Provider, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadConfigDoesNotValidate(t *testing.T) {
+	t.Setenv("VERIFIER_PROVIDER", VERIFIER_NEVERBOUNCE)
+	t.Setenv("NEVERBOUNCE_API_KEY", "")
+
+	cfg, err := ReadConfig("")
+	if err != nil {
+		t.Fatalf("ReadConfig of an invalid config: %v", err)
+	}
+	if _, err := cfg.Dump(); err != nil {
+		t.Fatalf("Dump of an invalid config: %v", err)
+	}
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("Validate accepted neverbounce without an API key")
+	}
+}
@@ -29,6 +29,7 @@ class LinkedInProfileExtractor {
         
         const profileData = {
             name: this.extractName(),
+            headline: this.extractHeadline(),
             profileUrl: window.location.href
         };
 
@@ -63,6 +64,22 @@ class LinkedInProfileExtractor {
     }
 
 
+    extractHeadline() {
+        // The line under the name, e.g. "VP Engineering at Acme"
+        const headlineSelectors = [
+            '.text-body-medium.break-words',
+            '.pv-text-details__left-panel .text-body-medium'
+        ];
+
+        for (const selector of headlineSelectors) {
+            const element = document.querySelector(selector);
+            if (element && element.textContent.trim()) {
+                return element.textContent.trim();
+            }
+        }
+        return '';
+    }
+
     waitForElement(selector, timeout = 10000) {
         return new Promise((resolve, reject) => {
             if (document.querySelector(selector)) {
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	DOMAIN_PATTERN_COLLECTION = "domain_patterns"
+	META_COLLECTION           = "meta"
+
+	// DOMAIN_PATTERN_VERSION is bumped when the way patterns are detected
+	// changes, so learned counts are rebuilt from the cached leads.
+	DOMAIN_PATTERN_VERSION = "1"
+	domainPatternVersionID = "domainPatterns.version"
+
+	// A domain's top pattern above this confidence makes other patterns unlikely.
+	likelyPatternConfidence = 0.75
+)
+
+// PatternCounts is the evidence for one address format at one domain.
+type PatternCounts struct {
+	Valid   int `json:"valid"`
+	Invalid int `json:"invalid"`
+}
+
+// DomainPatterns is what has been learned about one domain's address format.
+type DomainPatterns struct {
+	Domain    string                    `json:"domain"`
+	Patterns  map[string]*PatternCounts `json:"patterns"`
+	UpdatedAt int64                     `json:"updatedAt"`
+}
+
+type DomainPatternStat struct {
+	Pattern string `json:"pattern"`
+	PatternCounts
+}
+
+type DomainPatternResponse struct {
+	Success bool   `json:"success"`
+	Domain  string `json:"domain,omitempty"`
+	// Pattern is the most likely format, e.g. "first.last"; empty when nothing
+	// has been learned yet.
+	Pattern    string              `json:"pattern,omitempty"`
+	Example    string              `json:"example,omitempty"`
+	Confidence float64             `json:"confidence"`
+	Patterns   []DomainPatternStat `json:"patterns,omitempty"`
+	UpdatedAt  int64               `json:"updatedAt,omitempty"`
+	Error      string              `json:"error,omitempty"`
+}
+
+// domainPatternLock serializes read-modify-write of domain pattern records.
+var domainPatternLock sync.Mutex
+
+// leadPattern returns the domain and address pattern a lead provides evidence
+// for, and whether it counts as valid. Leads without a name, without a
+// definite status or on catch-all domains teach nothing.
+func leadPattern(data *CachedData) (domain, pattern string, valid, ok bool) {
+	if data == nil {
+		return "", "", false, false
+	}
+	lead := &data.LeadData
+	if lead.EmailStatus != EMAIL_STATUS_VALID && lead.EmailStatus != EMAIL_STATUS_INVALID {
+		return "", "", false, false
+	}
+	at := strings.LastIndex(lead.Email, "@")
+	if at < 0 || lead.FirstName == "" || lead.LastName == "" {
+		return "", "", false, false
+	}
+	pattern = detectPattern(lead.FirstName, lead.LastName, lead.Email[:at])
+	if pattern == "" {
+		return "", "", false, false
+	}
+	return lead.Email[at+1:], pattern, lead.EmailStatus == EMAIL_STATUS_VALID, true
+}
+
+// applyPatternDelta moves the evidence of a lead from its old to its new state,
+// so re-saving a lead never counts it twice.
+func (s *CacheServer) applyPatternDelta(old, new *CachedData) error {
+	type change struct {
+		domain, pattern string
+		valid           bool
+		delta           int
+	}
+	var changes []change
+	if domain, pattern, valid, ok := leadPattern(old); ok {
+		changes = append(changes, change{domain, pattern, valid, -1})
+	}
+	if domain, pattern, valid, ok := leadPattern(new); ok {
+		if len(changes) == 1 && changes[0].domain == domain && changes[0].pattern == pattern && changes[0].valid == valid {
+			return nil
+		}
+		changes = append(changes, change{domain, pattern, valid, 1})
+	}
+
+	domainPatternLock.Lock()
+	defer domainPatternLock.Unlock()
+
+	for _, c := range changes {
+		patterns, err := s.loadDomainPatterns(c.domain)
+		if err != nil {
+			return err
+		}
+		counts := patterns.Patterns[c.pattern]
+		if counts == nil {
+			counts = &PatternCounts{}
+			patterns.Patterns[c.pattern] = counts
+		}
+		if c.valid {
+			counts.Valid = max(counts.Valid+c.delta, 0)
+		} else {
+			counts.Invalid = max(counts.Invalid+c.delta, 0)
+		}
+		if counts.Valid == 0 && counts.Invalid == 0 {
+			delete(patterns.Patterns, c.pattern)
+		}
+		patterns.UpdatedAt = time.Now().UnixMilli()
+		if err := putRecordJSON(s.ctx, s.store, DOMAIN_PATTERN_COLLECTION, c.domain, patterns); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadDomainPatterns returns the learned patterns of a domain, empty if none.
+func (s *CacheServer) loadDomainPatterns(domain string) (*DomainPatterns, error) {
+	patterns := &DomainPatterns{Domain: domain}
+	err := getRecordJSON(s.ctx, s.store, DOMAIN_PATTERN_COLLECTION, domain, patterns)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+	if patterns.Patterns == nil {
+		patterns.Patterns = make(map[string]*PatternCounts)
+	}
+	return patterns, nil
+}
+
+// ranked orders patterns by valid minus invalid evidence, then by how common
+// the pattern is in general.
+func (p *DomainPatterns) ranked() []DomainPatternStat {
+	order := make(map[string]int, len(emailPatterns))
+	for i, pattern := range emailPatterns {
+		order[pattern.Name] = i
+	}
+
+	stats := make([]DomainPatternStat, 0, len(p.Patterns))
+	for name, counts := range p.Patterns {
+		stats = append(stats, DomainPatternStat{Pattern: name, PatternCounts: *counts})
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		si := stats[i].Valid - stats[i].Invalid
+		sj := stats[j].Valid - stats[j].Invalid
+		if si != sj {
+			return si > sj
+		}
+		return order[stats[i].Pattern] < order[stats[j].Pattern]
+	})
+	return stats
+}
+
+// best returns the most likely pattern and how sure we are of it: the share of
+// all valid addresses at the domain that use it, discounted by addresses of
+// that pattern found invalid, with one imaginary counter-example so a single
+// lead never yields certainty.
+func (p *DomainPatterns) best() (string, float64) {
+	ranked := p.ranked()
+	if len(ranked) == 0 || ranked[0].Valid == 0 {
+		return "", 0
+	}
+
+	totalValid := 0
+	for _, stat := range ranked {
+		totalValid += stat.Valid
+	}
+	top := ranked[0]
+	confidence := float64(top.Valid) / float64(totalValid+top.Invalid+1)
+	return top.Pattern, confidence
+}
+
+// rebuildDomainPatterns recomputes every domain's counts from the cached leads.
+// It runs once at startup when the learned data is missing or outdated.
+func (s *CacheServer) rebuildDomainPatterns() error {
+	var version string
+	if err := getRecordJSON(s.ctx, s.store, META_COLLECTION, domainPatternVersionID, &version); err == nil && version == DOMAIN_PATTERN_VERSION {
+		return nil
+	} else if err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+
+	leads, err := s.store.ListLeads(s.ctx)
+	if err != nil {
+		return err
+	}
+
+	learned := make(map[string]*DomainPatterns)
+	for _, lead := range leads {
+		domain, pattern, valid, ok := leadPattern(lead)
+		if !ok {
+			continue
+		}
+		patterns := learned[domain]
+		if patterns == nil {
+			patterns = &DomainPatterns{Domain: domain, Patterns: make(map[string]*PatternCounts)}
+			learned[domain] = patterns
+		}
+		counts := patterns.Patterns[pattern]
+		if counts == nil {
+			counts = &PatternCounts{}
+			patterns.Patterns[pattern] = counts
+		}
+		if valid {
+			counts.Valid++
+		} else {
+			counts.Invalid++
+		}
+	}
+
+	domainPatternLock.Lock()
+	defer domainPatternLock.Unlock()
+
+	if err := s.deleteDomainPatterns(); err != nil {
+		return err
+	}
+
+	now := time.Now().UnixMilli()
+	for domain, patterns := range learned {
+		patterns.UpdatedAt = now
+		if err := putRecordJSON(s.ctx, s.store, DOMAIN_PATTERN_COLLECTION, domain, patterns); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("🧠 Learned email patterns for %d domains from %d cached leads", len(learned), len(leads))
+	return putRecordJSON(s.ctx, s.store, META_COLLECTION, domainPatternVersionID, DOMAIN_PATTERN_VERSION)
+}
+
+// clearDomainPatterns forgets everything learned, for when all leads are cleared.
+func (s *CacheServer) clearDomainPatterns() error {
+	domainPatternLock.Lock()
+	defer domainPatternLock.Unlock()
+
+	return s.deleteDomainPatterns()
+}
+
+// deleteDomainPatterns removes every domain's record; the caller holds domainPatternLock.
+func (s *CacheServer) deleteDomainPatterns() error {
+	domains, err := s.listDomainPatternIDs()
+	if err != nil {
+		return err
+	}
+	for _, domain := range domains {
+		if _, err := s.store.DeleteRecord(s.ctx, DOMAIN_PATTERN_COLLECTION, domain); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *CacheServer) listDomainPatternIDs() ([]string, error) {
+	records, err := s.store.ListRecords(s.ctx, DOMAIN_PATTERN_COLLECTION)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(records))
+	for _, raw := range records {
+		var patterns DomainPatterns
+		if err := json.Unmarshal(raw, &patterns); err != nil || patterns.Domain == "" {
+			continue
+		}
+		ids = append(ids, patterns.Domain)
+	}
+	return ids, nil
+}
+
+// getDomainPattern reports the most likely address format of a domain.
+func (s *CacheServer) getDomainPattern(c *gin.Context) {
+	domain := strings.ToLower(strings.TrimSpace(strings.TrimPrefix(c.Param("domain"), "@")))
+	if domain == "" || validateEmailAddress("x@"+domain) != nil {
+		c.JSON(http.StatusBadRequest, DomainPatternResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Invalid domain %q", c.Param("domain")),
+		})
+		return
+	}
+
+	patterns, err := s.loadDomainPatterns(domain)
+	if err != nil {
+		log.Printf("Error loading patterns for %s: %v", domain, err)
+		c.JSON(http.StatusInternalServerError, DomainPatternResponse{
+			Success: false,
+			Error:   "Failed to load domain patterns",
+		})
+		return
+	}
+
+	response := DomainPatternResponse{
+		Success:   true,
+		Domain:    domain,
+		Patterns:  patterns.ranked(),
+		UpdatedAt: patterns.UpdatedAt,
+	}
+	response.Pattern, response.Confidence = patterns.best()
+	for _, pattern := range emailPatterns {
+		if pattern.Name == response.Pattern {
+			response.Example = pattern.Build("jane", "doe") + "@" + domain
+		}
+	}
+	c.JSON(http.StatusOK, response)
+}
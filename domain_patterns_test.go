@@ -0,0 +1,51 @@
+package main
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestConcurrentSavesCountLeadOnce(t *testing.T) {
+	s := newTestAuthServer(t)
+	const email = "jane.doe@acme.com"
+
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 200; i++ {
+		status := EMAIL_STATUS_VALID
+		if i%2 == 1 {
+			status = EMAIL_STATUS_INVALID
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			lead := Lead{FirstName: "Jane", LastName: "Doe", EmailStatus: status}
+			if _, err := s.saveLead(email, lead, "test"); err != nil {
+				t.Errorf("saveLead: %v", err)
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	stored, err := s.store.GetLead(s.ctx, email)
+	if err != nil {
+		t.Fatalf("GetLead: %v", err)
+	}
+	patterns, err := s.loadDomainPatterns("acme.com")
+	if err != nil {
+		t.Fatalf("loadDomainPatterns: %v", err)
+	}
+	counts := patterns.Patterns["first.last"]
+	if counts == nil {
+		t.Fatalf("patterns = %+v, want first.last", patterns.Patterns)
+	}
+	want := PatternCounts{Valid: 1}
+	if stored.LeadData.EmailStatus == EMAIL_STATUS_INVALID {
+		want = PatternCounts{Invalid: 1}
+	}
+	if *counts != want || len(patterns.Patterns) != 1 {
+		t.Fatalf("first.last = %+v with status %s, want %+v", *counts, stored.LeadData.EmailStatus, want)
+	}
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ExportRequest selects which leads /leads/export returns. It is read from the
+// query string, or from a JSON body on POST.
+type ExportRequest struct {
+	// List restricts the export to one listLeadBelongsTo value; empty means all lists.
+	List string `form:"list" json:"list"`
+	// Status is an emailStatus to match, or "all". Defaults to "valid".
+	Status string `form:"status" json:"status"`
+	// Exported is "false" (default), "true" or "all".
+	Exported string `form:"exported" json:"exported"`
+	// MarkExported flags every exported row in the same request (POST only).
+	MarkExported bool `form:"markExported" json:"markExported"`
+	// Format is csv, xlsx or ndjson. Defaults to the preset's format.
+	Format string `form:"format" json:"format"`
+	// Preset names the column layout. Defaults to "default".
+	Preset string `form:"preset" json:"preset"`
+}
+
+type ExportPresetsResponse struct {
+	Success bool                    `json:"success"`
+	Formats []string                `json:"formats"`
+	Names   []string                `json:"names"`
+	Presets map[string]ExportPreset `json:"presets"`
+}
+
+// ExportRow is one lead joined with the email saved for it, if any.
+type ExportRow struct {
+	Lead      Lead                   `json:"lead"`
+	Subject   string                 `json:"subject,omitempty"`
+	Body      string                 `json:"body,omitempty"`
+	EmailData map[string]interface{} `json:"emailData,omitempty"`
+}
+
+func (r *ExportRequest) normalize() error {
+	r.List = strings.TrimSpace(r.List)
+	r.Format = strings.ToLower(strings.TrimSpace(r.Format))
+	r.Preset = strings.ToLower(strings.TrimSpace(r.Preset))
+	r.Status = strings.ToLower(strings.TrimSpace(r.Status))
+	r.Exported = strings.ToLower(strings.TrimSpace(r.Exported))
+
+	if r.Status == "" {
+		r.Status = EMAIL_STATUS_VALID
+	}
+	if r.Status != "all" && !containsString(validEmailStatuses, r.Status) {
+		return fmt.Errorf("status must be \"all\" or one of %s", strings.Join(validEmailStatuses, ", "))
+	}
+
+	if r.Exported == "" {
+		r.Exported = "false"
+	}
+	if r.Exported != "false" && r.Exported != "true" && r.Exported != "all" {
+		return fmt.Errorf("exported must be one of false, true, all")
+	}
+
+	if r.Preset == "" {
+		r.Preset = DEFAULT_EXPORT_PRESET
+	}
+	if r.Format != "" && !containsString(exportFormats, r.Format) {
+		return fmt.Errorf("format must be one of %s", strings.Join(exportFormats, ", "))
+	}
+	return nil
+}
+
+func (r *ExportRequest) matches(lead *Lead) bool {
+	if r.Status != "all" && lead.EmailStatus != r.Status {
+		return false
+	}
+	if r.List != "" && lead.List != r.List {
+		return false
+	}
+	switch r.Exported {
+	case "false":
+		return !lead.Exported
+	case "true":
+		return lead.Exported
+	}
+	return true
+}
+
+// bindExportRequest reads the export filter from the query string and, for
+// POST requests with a body, from JSON.
+func bindExportRequest(c *gin.Context) (*ExportRequest, error) {
+	var request ExportRequest
+	if err := c.ShouldBindQuery(&request); err != nil {
+		return nil, err
+	}
+	if c.Request.Method == http.MethodPost && c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&request); err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+	}
+	if err := request.normalize(); err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
+
+// matchingExportLeads returns the leads the request selects, oldest first.
+func (s *CacheServer) matchingExportLeads(request *ExportRequest) ([]Lead, error) {
+	leads, err := s.store.ListLeads(s.ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(leads, func(i, j int) bool {
+		if leads[i].Timestamp == leads[j].Timestamp {
+			return leads[i].Email < leads[j].Email
+		}
+		return leads[i].Timestamp < leads[j].Timestamp
+	})
+
+	seen := make(map[string]bool)
+	var matched []Lead
+	for _, cached := range leads {
+		lead := cached.LeadData
+		if lead.Email == "" || seen[lead.Email] || !request.matches(&lead) {
+			continue
+		}
+		seen[lead.Email] = true
+		matched = append(matched, lead)
+	}
+	return matched, nil
+}
+
+// exportRow joins a lead with the email saved for it. Rows are built one at a
+// time while the export streams, so only the leads are held up front.
+func (s *CacheServer) exportRow(lead Lead) ExportRow {
+	row := ExportRow{Lead: lead}
+	saved, err := s.store.GetEmail(s.ctx, lead.Email)
+	if err == nil {
+		row.EmailData = saved.EmailData
+		row.Subject, _ = saved.EmailData["subject"].(string)
+		row.Body, _ = saved.EmailData["body"].(string)
+	} else if !errors.Is(err, ErrNotFound) {
+		log.Printf("⚠️ Could not fetch email content for %s: %v", lead.Email, err)
+	}
+	return row
+}
+
+// exportLeads streams matching leads in the requested format and preset.
+// Previews are streamed as the rows are read. With markExported=true on POST the
+// run is recorded as an export batch and its leads are flagged in one store
+// transaction before the file is sent, so a failure comes back as a JSON error
+// and the headers describe a batch that exists; if the file then cannot be
+// written the marking is undone and the batch dropped.
+func (s *CacheServer) exportLeads(c *gin.Context) {
+	request, err := bindExportRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, CacheResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Invalid export request: %v", err),
+		})
+		return
+	}
+
+	preset, exists := s.config.exportPresets()[request.Preset]
+	if !exists {
+		c.JSON(http.StatusBadRequest, CacheResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Unknown export preset %q", request.Preset),
+		})
+		return
+	}
+	format := request.Format
+	if format == "" {
+		format = preset.Format
+	}
+	if format == "" {
+		format = EXPORT_FORMAT_CSV
+	}
+
+	if request.MarkExported && c.Request.Method != http.MethodPost {
+		c.JSON(http.StatusMethodNotAllowed, CacheResponse{
+			Success: false,
+			Error:   "markExported requires POST",
+		})
+		return
+	}
+
+	leads, err := s.matchingExportLeads(request)
+	if err != nil {
+		log.Printf("Error collecting leads for export: %v", err)
+		c.JSON(http.StatusInternalServerError, CacheResponse{
+			Success: false,
+			Error:   "Failed to read leads from store",
+		})
+		return
+	}
+
+	batch := &ExportBatch{
+		ID:        newID("exp"),
+		CreatedAt: time.Now().UnixMilli(),
+		Filter:    *request,
+		Format:    format,
+		Preset:    preset,
+		CreatedBy: requestUser(c),
+		Count:     len(leads),
+	}
+	if request.MarkExported && batch.Count > 0 {
+		s.exportMarkedBatch(c, batch, leads)
+		return
+	}
+
+	c.Header("Content-Type", exportContentTypes[format])
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", batch.filename()))
+	c.Header("X-Export-Count", fmt.Sprintf("%d", batch.Count))
+	c.Header("X-Export-Marked", "0")
+	c.Status(http.StatusOK)
+
+	writer, err := newExportWriter(c.Writer, format, &batch.Preset)
+	for i := 0; err == nil && i < len(leads); i++ {
+		row := s.exportRow(leads[i])
+		err = writer.WriteRow(&row)
+	}
+	if err == nil {
+		err = writer.Close()
+	}
+	if err != nil {
+		log.Printf("❌ Error streaming export preview: %v", err)
+		return
+	}
+
+	log.Printf("📤 %s previewed %d leads as %s/%s (list: %q, status: %s, exported: %s)",
+		batch.CreatedBy, batch.Count, request.Preset, format, request.List, request.Status, request.Exported)
+}
+
+// exportMarkedBatch records the batch, marks its leads and only then sends the
+// file, with the batch id, count, checksum and marked count as headers.
+func (s *CacheServer) exportMarkedBatch(c *gin.Context, batch *ExportBatch, leads []Lead) {
+	for _, lead := range leads {
+		row := s.exportRow(lead)
+		batch.Rows = append(batch.Rows, row)
+		batch.Emails = append(batch.Emails, lead.Email)
+	}
+	checksum, err := writeExportBatch(io.Discard, batch)
+	if err != nil {
+		log.Printf("Error rendering export batch %s: %v", batch.ID, err)
+		c.JSON(http.StatusInternalServerError, CacheResponse{
+			Success: false,
+			Error:   "Failed to render export",
+		})
+		return
+	}
+	batch.Checksum = checksum
+
+	if err := s.markExportBatch(batch); err != nil {
+		log.Printf("❌ Export batch %s not recorded: %v", batch.ID, err)
+		c.JSON(http.StatusInternalServerError, CacheResponse{
+			Success: false,
+			Error:   "Failed to mark leads as exported; nothing was exported",
+		})
+		return
+	}
+
+	c.Header("Content-Type", exportContentTypes[batch.Format])
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", batch.filename()))
+	c.Header("X-Export-Batch", batch.ID)
+	c.Header("X-Export-Count", fmt.Sprintf("%d", batch.Count))
+	c.Header("X-Export-Checksum", batch.Checksum)
+	c.Header("X-Export-Marked", fmt.Sprintf("%d", batch.Count))
+	c.Status(http.StatusOK)
+
+	if _, err := writeExportBatch(c.Writer, batch); err != nil {
+		// The client got a truncated file, so the batch must not stand
+		log.Printf("❌ Error streaming export batch %s, undoing it: %v", batch.ID, err)
+		s.dropExportBatch(batch)
+		return
+	}
+
+	log.Printf("📤 %s exported batch %s: %d leads as %s/%s (list: %q, status: %s, exported: %s)",
+		batch.CreatedBy, batch.ID, batch.Count, batch.Filter.Preset, batch.Format, batch.Filter.List, batch.Filter.Status, batch.Filter.Exported)
+}
+
+// markExportBatch saves the batch's rows, flags its leads and saves the batch
+// summary, undoing the earlier steps when a later one fails.
+func (s *CacheServer) markExportBatch(batch *ExportBatch) error {
+	// Rows go first: a summary without its rows could not be downloaded again
+	if err := s.saveExportRows(batch); err != nil {
+		return fmt.Errorf("saving rows: %v", err)
+	}
+
+	marked, err := s.store.SetLeadsExported(s.ctx, batch.Emails, true)
+	if err != nil {
+		s.store.DeleteRecord(s.ctx, EXPORT_ROWS_COLLECTION, batch.ID)
+		return fmt.Errorf("marking %d leads: %v", batch.Count, err)
+	}
+	batch.Marked = true
+	log.Printf("🏷️ Marked %d leads as exported", marked)
+
+	if err := s.saveExportBatch(batch); err != nil {
+		// Without a batch the export could not be reverted, so undo the marking
+		if _, unmarkErr := s.store.SetLeadsExported(s.ctx, batch.Emails, false); unmarkErr != nil {
+			log.Printf("❌ Failed to un-mark leads of unsaved batch %s: %v", batch.ID, unmarkErr)
+		}
+		s.store.DeleteRecord(s.ctx, EXPORT_ROWS_COLLECTION, batch.ID)
+		batch.Marked = false
+		return fmt.Errorf("saving batch: %v", err)
+	}
+	return nil
+}
+
+// dropExportBatch undoes a batch whose file never reached the client: its
+// leads are un-marked, except those other batches exported, and it is deleted.
+func (s *CacheServer) dropExportBatch(batch *ExportBatch) {
+	emails, err := s.unsharedBatchEmails(batch)
+	if err == nil {
+		_, err = s.store.SetLeadsExported(s.ctx, emails, false)
+	}
+	if err != nil {
+		log.Printf("❌ Failed to un-mark leads of export batch %s; revert it by hand: %v", batch.ID, err)
+		return
+	}
+	s.store.DeleteRecord(s.ctx, EXPORT_BATCH_COLLECTION, batch.ID)
+	s.store.DeleteRecord(s.ctx, EXPORT_ROWS_COLLECTION, batch.ID)
+}
+
+// getExportPresets lists the column layouts available to /leads/export.
+func (s *CacheServer) getExportPresets(c *gin.Context) {
+	presets := s.config.exportPresets()
+	c.JSON(http.StatusOK, ExportPresetsResponse{
+		Success: true,
+		Formats: exportFormats,
+		Names:   presetNames(presets),
+		Presets: presets,
+	})
+}
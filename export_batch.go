@@ -0,0 +1,297 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	EXPORT_BATCH_COLLECTION = "exports"
+	// EXPORT_ROWS_COLLECTION holds each batch's row snapshot under the batch id,
+	// apart from the summaries so listing batches never loads the rows.
+	EXPORT_ROWS_COLLECTION = "export_rows"
+)
+
+// ExportBatch records one run of /leads/export that marked leads as exported:
+// what was asked for, which leads went out and a snapshot of the rows, so the
+// exact file can be downloaded again and the exported flag can be rolled back.
+type ExportBatch struct {
+	ID         string        `json:"id"`
+	CreatedAt  int64         `json:"createdAt"`
+	Filter     ExportRequest `json:"filter"`
+	Format     string        `json:"format"`
+	Preset     ExportPreset  `json:"preset"`
+	Emails     []string      `json:"emails"`
+	Count      int           `json:"count"`
+	Checksum   string        `json:"checksum"`
+	Marked     bool          `json:"markedExported"`
+	RevertedAt int64         `json:"revertedAt,omitempty"`
+	Rows       []ExportRow   `json:"rows,omitempty"`
+	// CreatedBy and RevertedBy are the users who exported and reverted the batch
+	CreatedBy  string `json:"createdBy,omitempty"`
+	RevertedBy string `json:"revertedBy,omitempty"`
+}
+
+type ExportBatchResponse struct {
+	Success bool           `json:"success"`
+	Batch   *ExportBatch   `json:"batch,omitempty"`
+	Batches []*ExportBatch `json:"batches,omitempty"`
+	Updated int64          `json:"updated,omitempty"`
+	// Skipped counts leads left exported because another batch still exports them.
+	Skipped int    `json:"skipped,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// newID returns a sortable, unique identifier such as exp_20250101T120000_9f2c41d0.
+func newID(prefix string) string {
+	random := make([]byte, 4)
+	rand.Read(random)
+	return fmt.Sprintf("%s_%s_%s", prefix, time.Now().UTC().Format("20060102T150405"), hex.EncodeToString(random))
+}
+
+func (b *ExportBatch) filename() string {
+	return fmt.Sprintf("leads_%s.%s", b.ID, b.Format)
+}
+
+// summary drops the row snapshot, which is only needed to rebuild the file.
+func (b *ExportBatch) summary() *ExportBatch {
+	out := *b
+	out.Rows = nil
+	return &out
+}
+
+// saveExportBatch stores the batch summary; the rows are saved once, by saveExportRows.
+func (s *CacheServer) saveExportBatch(batch *ExportBatch) error {
+	return putRecordJSON(s.ctx, s.store, EXPORT_BATCH_COLLECTION, batch.ID, batch.summary())
+}
+
+func (s *CacheServer) saveExportRows(batch *ExportBatch) error {
+	return putRecordJSON(s.ctx, s.store, EXPORT_ROWS_COLLECTION, batch.ID, batch.Rows)
+}
+
+// loadExportBatch returns the batch summary, without rows.
+func (s *CacheServer) loadExportBatch(id string) (*ExportBatch, error) {
+	var batch ExportBatch
+	if err := getRecordJSON(s.ctx, s.store, EXPORT_BATCH_COLLECTION, id, &batch); err != nil {
+		return nil, err
+	}
+	return &batch, nil
+}
+
+// loadExportRows fills in the batch's row snapshot. Batches recorded before the
+// rows were split out still carry them in the summary record.
+func (s *CacheServer) loadExportRows(batch *ExportBatch) error {
+	var rows []ExportRow
+	err := getRecordJSON(s.ctx, s.store, EXPORT_ROWS_COLLECTION, batch.ID, &rows)
+	if errors.Is(err, ErrNotFound) && batch.Rows != nil {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	batch.Rows = rows
+	return nil
+}
+
+// listExportBatchSummaries returns every batch summary, newest first.
+func (s *CacheServer) listExportBatchSummaries() ([]*ExportBatch, error) {
+	records, err := s.store.ListRecords(s.ctx, EXPORT_BATCH_COLLECTION)
+	if err != nil {
+		return nil, err
+	}
+
+	batches := make([]*ExportBatch, 0, len(records))
+	for _, raw := range records {
+		var batch ExportBatch
+		if err := json.Unmarshal(raw, &batch); err != nil {
+			log.Printf("⚠️ Skipping unreadable export batch: %v", err)
+			continue
+		}
+		batches = append(batches, batch.summary())
+	}
+
+	sort.Slice(batches, func(i, j int) bool {
+		return batches[i].CreatedAt > batches[j].CreatedAt
+	})
+	return batches, nil
+}
+
+// writeExportBatch renders the batch's snapshot and returns the SHA-256 of what was written.
+func writeExportBatch(w io.Writer, batch *ExportBatch) (string, error) {
+	hash := sha256.New()
+	err := writeExport(io.MultiWriter(w, hash), batch.Format, &batch.Preset, batch.Rows)
+	return hex.EncodeToString(hash.Sum(nil)), err
+}
+
+func (s *CacheServer) listExportBatches(c *gin.Context) {
+	batches, err := s.listExportBatchSummaries()
+	if err != nil {
+		log.Printf("Error listing export batches: %v", err)
+		c.JSON(http.StatusInternalServerError, ExportBatchResponse{
+			Success: false,
+			Error:   "Failed to list export batches",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ExportBatchResponse{
+		Success: true,
+		Batches: batches,
+	})
+}
+
+// lookupExportBatch loads the batch named in the URL, writing the error response itself.
+func (s *CacheServer) lookupExportBatch(c *gin.Context) (*ExportBatch, bool) {
+	id := c.Param("id")
+	batch, err := s.loadExportBatch(id)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			c.JSON(http.StatusNotFound, ExportBatchResponse{
+				Success: false,
+				Error:   fmt.Sprintf("Export batch %s not found", id),
+			})
+			return nil, false
+		}
+		log.Printf("Error loading export batch %s: %v", id, err)
+		c.JSON(http.StatusInternalServerError, ExportBatchResponse{
+			Success: false,
+			Error:   "Failed to load export batch",
+		})
+		return nil, false
+	}
+	return batch, true
+}
+
+// downloadExportBatch rebuilds the file from the batch's snapshot, byte for byte.
+func (s *CacheServer) downloadExportBatch(c *gin.Context) {
+	batch, ok := s.lookupExportBatch(c)
+	if !ok {
+		return
+	}
+	if err := s.loadExportRows(batch); err != nil {
+		log.Printf("Error loading rows of export batch %s: %v", batch.ID, err)
+		c.JSON(http.StatusInternalServerError, ExportBatchResponse{
+			Success: false,
+			Error:   "Failed to load export batch rows",
+		})
+		return
+	}
+
+	c.Header("Content-Type", exportContentTypes[batch.Format])
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", batch.filename()))
+	c.Header("X-Export-Batch", batch.ID)
+	c.Header("X-Export-Checksum", batch.Checksum)
+	c.Header("X-Export-Count", fmt.Sprintf("%d", batch.Count))
+	c.Status(http.StatusOK)
+
+	checksum, err := writeExportBatch(c.Writer, batch)
+	if err != nil {
+		log.Printf("❌ Error streaming export batch %s: %v", batch.ID, err)
+		return
+	}
+	if checksum != batch.Checksum {
+		log.Printf("⚠️ Export batch %s re-downloaded with checksum %s, expected %s", batch.ID, checksum, batch.Checksum)
+	}
+
+	log.Printf("📥 Re-downloaded export batch %s (%d leads)", batch.ID, batch.Count)
+}
+
+// unsharedBatchEmails returns the batch's leads that no other unreverted,
+// marked batch exported, older or newer; only those may be un-marked.
+func (s *CacheServer) unsharedBatchEmails(batch *ExportBatch) ([]string, error) {
+	batches, err := s.listExportBatchSummaries()
+	if err != nil {
+		return nil, err
+	}
+	shared := make(map[string]bool)
+	for _, other := range batches {
+		if other.ID == batch.ID || !other.Marked || other.RevertedAt != 0 {
+			continue
+		}
+		for _, email := range other.Emails {
+			shared[email] = true
+		}
+	}
+	emails := make([]string, 0, len(batch.Emails))
+	for _, email := range batch.Emails {
+		if !shared[email] {
+			emails = append(emails, email)
+		}
+	}
+	return emails, nil
+}
+
+// revertExportBatch clears the exported flag on every lead the batch marked,
+// except leads another unreverted batch, older or newer, also exported.
+func (s *CacheServer) revertExportBatch(c *gin.Context) {
+	batch, ok := s.lookupExportBatch(c)
+	if !ok {
+		return
+	}
+
+	if !batch.Marked {
+		c.JSON(http.StatusBadRequest, ExportBatchResponse{
+			Success: false,
+			Error:   "Export batch did not mark leads as exported",
+		})
+		return
+	}
+	if batch.RevertedAt != 0 {
+		c.JSON(http.StatusConflict, ExportBatchResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Export batch was already reverted at %s", time.UnixMilli(batch.RevertedAt).Format(time.RFC3339)),
+		})
+		return
+	}
+
+	emails, err := s.unsharedBatchEmails(batch)
+	if err != nil {
+		log.Printf("Error listing export batches to revert %s: %v", batch.ID, err)
+		c.JSON(http.StatusInternalServerError, ExportBatchResponse{
+			Success: false,
+			Error:   "Failed to list export batches",
+		})
+		return
+	}
+
+	updated, err := s.store.SetLeadsExported(s.ctx, emails, false)
+	if err != nil {
+		log.Printf("Error reverting export batch %s: %v", batch.ID, err)
+		c.JSON(http.StatusInternalServerError, ExportBatchResponse{
+			Success: false,
+			Error:   "Failed to un-mark exported leads",
+		})
+		return
+	}
+
+	batch.RevertedAt = time.Now().UnixMilli()
+	batch.RevertedBy = requestUser(c)
+	if err := s.saveExportBatch(batch); err != nil {
+		log.Printf("Error saving reverted export batch %s: %v", batch.ID, err)
+		c.JSON(http.StatusInternalServerError, ExportBatchResponse{
+			Success: false,
+			Error:   "Leads were un-marked but the batch could not be updated",
+		})
+		return
+	}
+
+	log.Printf("↩️ %s reverted export batch %s (%d leads un-marked, %d kept for other batches)",
+		batch.RevertedBy, batch.ID, updated, len(batch.Emails)-len(emails))
+	c.JSON(http.StatusOK, ExportBatchResponse{
+		Success: true,
+		Batch:   batch.summary(),
+		Updated: updated,
+		Skipped: len(batch.Emails) - len(emails),
+	})
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func exportMarked(t *testing.T, s *CacheServer, body string) string {
+	t.Helper()
+	got := serveWithKey(s, http.MethodPost, "/leads/export", testBootstrapKey, body)
+	if got.Code != http.StatusOK {
+		t.Fatalf("POST /leads/export %s = %d: %s", body, got.Code, got.Body)
+	}
+	id := got.Header().Get("X-Export-Batch")
+	if id == "" {
+		t.Fatalf("POST /leads/export %s: no X-Export-Batch header", body)
+	}
+	return id
+}
+
+func revertBatch(t *testing.T, s *CacheServer, id string) ExportBatchResponse {
+	t.Helper()
+	got := serveWithKey(s, http.MethodPost, "/exports/"+id+"/revert", testBootstrapKey, "")
+	if got.Code != http.StatusOK {
+		t.Fatalf("revert %s = %d: %s", id, got.Code, got.Body)
+	}
+	var response ExportBatchResponse
+	if err := json.Unmarshal(got.Body.Bytes(), &response); err != nil {
+		t.Fatalf("decode revert response: %v", err)
+	}
+	return response
+}
+
+func assertExported(t *testing.T, s *CacheServer, want map[string]bool) {
+	t.Helper()
+	for email, exported := range want {
+		lead, err := s.store.GetLead(s.ctx, email)
+		if err != nil {
+			t.Fatalf("GetLead %s: %v", email, err)
+		}
+		if lead.LeadData.Exported != exported {
+			t.Errorf("%s exported = %t, want %t", email, lead.LeadData.Exported, exported)
+		}
+	}
+}
+
+// Reverting a batch keeps leads that another batch, older or newer, still exports.
+func TestRevertExportBatchKeepsLeadsOfOtherBatches(t *testing.T) {
+	s := newTestAuthServer(t)
+	for i, email := range []string{"a@example.com", "b@example.com"} {
+		if err := s.store.SaveLead(s.ctx, testLead(email, EMAIL_STATUS_VALID, "q1", int64(1000+i))); err != nil {
+			t.Fatalf("SaveLead: %v", err)
+		}
+	}
+	batchA := exportMarked(t, s, `{"markExported":true}`)
+
+	if err := s.store.SaveLead(s.ctx, testLead("c@example.com", EMAIL_STATUS_VALID, "q1", 3000)); err != nil {
+		t.Fatalf("SaveLead: %v", err)
+	}
+	batchB := exportMarked(t, s, `{"markExported":true,"exported":"all"}`)
+
+	response := revertBatch(t, s, batchB)
+	if response.Updated != 1 || response.Skipped != 2 {
+		t.Fatalf("revert B updated %d, skipped %d; want 1 and 2", response.Updated, response.Skipped)
+	}
+	assertExported(t, s, map[string]bool{"a@example.com": true, "b@example.com": true, "c@example.com": false})
+
+	response = revertBatch(t, s, batchA)
+	if response.Updated != 2 || response.Skipped != 0 {
+		t.Fatalf("revert A updated %d, skipped %d; want 2 and 0", response.Updated, response.Skipped)
+	}
+	assertExported(t, s, map[string]bool{"a@example.com": false, "b@example.com": false})
+}
+
+// failingWriter accepts headers but fails every write of the body.
+type failingWriter struct {
+	header http.Header
+	code   int
+}
+
+func (w *failingWriter) Header() http.Header         { return w.header }
+func (w *failingWriter) WriteHeader(code int)        { w.code = code }
+func (w *failingWriter) Write(p []byte) (int, error) { return 0, errors.New("client went away") }
+
+func TestExportMarkedBatchHeaders(t *testing.T) {
+	s := newTestAuthServer(t)
+	if err := s.store.SaveLead(s.ctx, testLead("a@example.com", EMAIL_STATUS_VALID, "q1", 1000)); err != nil {
+		t.Fatalf("SaveLead: %v", err)
+	}
+
+	got := serveWithKey(s, http.MethodPost, "/leads/export", testBootstrapKey, `{"markExported":true}`)
+	if got.Code != http.StatusOK {
+		t.Fatalf("POST /leads/export = %d: %s", got.Code, got.Body)
+	}
+	batch, err := s.loadExportBatch(got.Header().Get("X-Export-Batch"))
+	if err != nil {
+		t.Fatalf("batch named in X-Export-Batch: %v", err)
+	}
+	sum := sha256.Sum256(got.Body.Bytes())
+	if checksum := got.Header().Get("X-Export-Checksum"); checksum != hex.EncodeToString(sum[:]) || checksum != batch.Checksum {
+		t.Fatalf("X-Export-Checksum = %s, body %x, batch %s", checksum, sum, batch.Checksum)
+	}
+	if got.Header().Get("X-Export-Marked") != "1" || got.Header().Get("X-Export-Count") != "1" {
+		t.Fatalf("headers = %v", got.Header())
+	}
+	assertExported(t, s, map[string]bool{"a@example.com": true})
+}
+
+func TestExportFailedStreamUndoesMarking(t *testing.T) {
+	s := newTestAuthServer(t)
+	if err := s.store.SaveLead(s.ctx, testLead("a@example.com", EMAIL_STATUS_VALID, "q1", 1000)); err != nil {
+		t.Fatalf("SaveLead: %v", err)
+	}
+
+	request := httptest.NewRequest(http.MethodPost, "/leads/export", strings.NewReader(`{"markExported":true}`))
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Authorization", "Bearer "+testBootstrapKey)
+	s.router.ServeHTTP(&failingWriter{header: http.Header{}}, request)
+
+	assertExported(t, s, map[string]bool{"a@example.com": false})
+	batches, err := s.listExportBatchSummaries()
+	if err != nil || len(batches) != 0 {
+		t.Fatalf("batches after a failed export = %d, %v; want none", len(batches), err)
+	}
+}
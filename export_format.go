@@ -0,0 +1,327 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+const (
+	EXPORT_FORMAT_CSV    = "csv"
+	EXPORT_FORMAT_XLSX   = "xlsx"
+	EXPORT_FORMAT_NDJSON = "ndjson"
+
+	DEFAULT_EXPORT_PRESET = "default"
+)
+
+var exportFormats = []string{EXPORT_FORMAT_CSV, EXPORT_FORMAT_XLSX, EXPORT_FORMAT_NDJSON}
+
+var exportContentTypes = map[string]string{
+	EXPORT_FORMAT_CSV:    "text/csv; charset=utf-8",
+	EXPORT_FORMAT_XLSX:   "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	EXPORT_FORMAT_NDJSON: "application/x-ndjson",
+}
+
+// ExportColumn maps one output column to a value taken from the row. Field is
+// one of the Lead fields (firstName, lastName, title, companyName, domain, email,
+// emailStatus, list, sourceUrl, notes, exportedAt, verifiedAt), "subject" or "body" from
+// the saved email, "custom.<name>" for a lead custom field or "email.<name>" for
+// any other key saved with the email. Value is used verbatim when Field is empty.
+type ExportColumn struct {
+	Header string `yaml:"header" toml:"header" json:"header"`
+	Field  string `yaml:"field,omitempty" toml:"field,omitempty" json:"field,omitempty"`
+	Value  string `yaml:"value,omitempty" toml:"value,omitempty" json:"value,omitempty"`
+}
+
+// ExportPreset is a named column layout, usually matching a sequencer's import format.
+type ExportPreset struct {
+	// Format is used when the request doesn't ask for one.
+	Format  string         `yaml:"format" toml:"format" json:"format,omitempty"`
+	Columns []ExportColumn `yaml:"columns" toml:"columns" json:"columns"`
+}
+
+// builtinExportPresets can be overridden, or extended, under export.presets in the config file.
+var builtinExportPresets = map[string]ExportPreset{
+	DEFAULT_EXPORT_PRESET: {
+		Format: EXPORT_FORMAT_CSV,
+		Columns: []ExportColumn{
+			{Header: "firstName", Field: "firstName"},
+			{Header: "lastName", Field: "lastName"},
+			{Header: "companyName", Field: "companyName"},
+			{Header: "email", Field: "email"},
+			{Header: "subject", Field: "subject"},
+			{Header: "body", Field: "body"},
+		},
+	},
+	"lemlist": {
+		Format: EXPORT_FORMAT_CSV,
+		Columns: []ExportColumn{
+			{Header: "email", Field: "email"},
+			{Header: "firstName", Field: "firstName"},
+			{Header: "lastName", Field: "lastName"},
+			{Header: "companyName", Field: "companyName"},
+			{Header: "companyDomain", Field: "domain"},
+			{Header: "subject", Field: "subject"},
+			{Header: "emailBody", Field: "body"},
+		},
+	},
+	"instantly": {
+		Format: EXPORT_FORMAT_CSV,
+		Columns: []ExportColumn{
+			{Header: "email", Field: "email"},
+			{Header: "first_name", Field: "firstName"},
+			{Header: "last_name", Field: "lastName"},
+			{Header: "company_name", Field: "companyName"},
+			{Header: "website", Field: "domain"},
+			{Header: "subject", Field: "subject"},
+			{Header: "personalization", Field: "body"},
+		},
+	},
+	"apollo": {
+		Format: EXPORT_FORMAT_CSV,
+		Columns: []ExportColumn{
+			{Header: "First Name", Field: "firstName"},
+			{Header: "Last Name", Field: "lastName"},
+			{Header: "Company", Field: "companyName"},
+			{Header: "Email", Field: "email"},
+			{Header: "Website", Field: "domain"},
+			{Header: "Email Subject", Field: "subject"},
+			{Header: "Email Body", Field: "body"},
+		},
+	},
+}
+
+var exportLeadFields = []string{
+	"firstName", "lastName", "title", "companyName", "domain", "email", "emailStatus",
+	"list", "sourceUrl", "notes", "exportedAt", "verifiedAt", "subject", "body",
+}
+
+// exportPresets returns the built-in presets merged with those from the config.
+func (cfg *Config) exportPresets() map[string]ExportPreset {
+	presets := make(map[string]ExportPreset, len(builtinExportPresets)+len(cfg.Export.Presets))
+	for name, preset := range builtinExportPresets {
+		presets[name] = preset
+	}
+	for name, preset := range cfg.Export.Presets {
+		presets[strings.ToLower(name)] = preset
+	}
+	return presets
+}
+
+func (p *ExportPreset) validate() error {
+	if p.Format != "" && !containsString(exportFormats, p.Format) {
+		return fmt.Errorf("format %q must be one of %s", p.Format, strings.Join(exportFormats, ", "))
+	}
+	if len(p.Columns) == 0 {
+		return fmt.Errorf("at least one column is required")
+	}
+	for i, column := range p.Columns {
+		if column.Header == "" {
+			return fmt.Errorf("column %d has no header", i+1)
+		}
+		if column.Field == "" {
+			continue
+		}
+		if !containsString(exportLeadFields, column.Field) &&
+			!strings.HasPrefix(column.Field, "custom.") && !strings.HasPrefix(column.Field, "email.") {
+			return fmt.Errorf("column %q has unknown field %q", column.Header, column.Field)
+		}
+	}
+	return nil
+}
+
+func (p *ExportPreset) headers() []string {
+	headers := make([]string, len(p.Columns))
+	for i, column := range p.Columns {
+		headers[i] = column.Header
+	}
+	return headers
+}
+
+func (p *ExportPreset) values(row *ExportRow) []string {
+	values := make([]string, len(p.Columns))
+	for i, column := range p.Columns {
+		if column.Field == "" {
+			values[i] = column.Value
+			continue
+		}
+		values[i] = row.field(column.Field)
+	}
+	return values
+}
+
+func (row *ExportRow) field(name string) string {
+	lead := &row.Lead
+	switch name {
+	case "firstName":
+		return lead.FirstName
+	case "lastName":
+		return lead.LastName
+	case "title":
+		return lead.Title
+	case "companyName":
+		return lead.CompanyName
+	case "domain":
+		return lead.Domain
+	case "email":
+		return lead.Email
+	case "emailStatus":
+		return lead.EmailStatus
+	case "list":
+		return lead.List
+	case "sourceUrl":
+		return lead.SourceURL
+	case "notes":
+		return lead.Notes
+	case "exportedAt":
+		return formatMillis(lead.ExportedAt)
+	case "verifiedAt":
+		return formatMillis(lead.VerifiedAt)
+	case "subject":
+		return row.Subject
+	case "body":
+		return row.Body
+	}
+	if key, ok := strings.CutPrefix(name, "custom."); ok {
+		return looseString(lead.CustomFields[key])
+	}
+	if key, ok := strings.CutPrefix(name, "email."); ok {
+		return looseString(row.EmailData[key])
+	}
+	return ""
+}
+
+func formatMillis(ms int64) string {
+	if ms == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d", ms)
+}
+
+// exportWriter renders rows one at a time, so an export is streamed to the
+// client as it is read from the store.
+type exportWriter interface {
+	WriteRow(row *ExportRow) error
+	// Close writes anything still buffered and the format's trailer.
+	Close() error
+}
+
+// newExportWriter returns a writer for format using the preset's columns. CSV
+// and XLSX writers emit the header row immediately.
+func newExportWriter(w io.Writer, format string, preset *ExportPreset) (exportWriter, error) {
+	switch format {
+	case EXPORT_FORMAT_CSV:
+		writer := csv.NewWriter(w)
+		if err := writer.Write(preset.headers()); err != nil {
+			return nil, err
+		}
+		return &csvExportWriter{writer: writer, preset: preset}, nil
+	case EXPORT_FORMAT_NDJSON:
+		return &ndjsonExportWriter{w: w, preset: preset, headers: preset.headers()}, nil
+	case EXPORT_FORMAT_XLSX:
+		writer, err := newXLSXWriter(w, "Leads")
+		if err != nil {
+			return nil, err
+		}
+		if err := writer.WriteRecord(preset.headers()); err != nil {
+			return nil, err
+		}
+		return &xlsxExportWriter{writer: writer, preset: preset}, nil
+	default:
+		return nil, fmt.Errorf("unsupported export format %q", format)
+	}
+}
+
+// writeExport renders rows in the requested format using the preset's columns.
+func writeExport(w io.Writer, format string, preset *ExportPreset, rows []ExportRow) error {
+	writer, err := newExportWriter(w, format, preset)
+	if err != nil {
+		return err
+	}
+	for i := range rows {
+		if err := writer.WriteRow(&rows[i]); err != nil {
+			return err
+		}
+	}
+	return writer.Close()
+}
+
+type csvExportWriter struct {
+	writer *csv.Writer
+	preset *ExportPreset
+}
+
+func (e *csvExportWriter) WriteRow(row *ExportRow) error {
+	return e.writer.Write(e.preset.values(row))
+}
+
+func (e *csvExportWriter) Close() error {
+	e.writer.Flush()
+	return e.writer.Error()
+}
+
+// ndjsonExportWriter writes one JSON object per row, keyed by column header in column order.
+type ndjsonExportWriter struct {
+	w       io.Writer
+	preset  *ExportPreset
+	headers []string
+	line    bytes.Buffer
+}
+
+func (e *ndjsonExportWriter) WriteRow(row *ExportRow) error {
+	values := e.preset.values(row)
+
+	e.line.Reset()
+	e.line.WriteByte('{')
+	for j, header := range e.headers {
+		if j > 0 {
+			e.line.WriteByte(',')
+		}
+		writeJSONString(&e.line, header)
+		e.line.WriteByte(':')
+		writeJSONString(&e.line, values[j])
+	}
+	e.line.WriteString("}\n")
+
+	_, err := e.w.Write(e.line.Bytes())
+	return err
+}
+
+func (e *ndjsonExportWriter) Close() error {
+	return nil
+}
+
+type xlsxExportWriter struct {
+	writer *xlsxWriter
+	preset *ExportPreset
+}
+
+func (e *xlsxExportWriter) WriteRow(row *ExportRow) error {
+	return e.writer.WriteRecord(e.preset.values(row))
+}
+
+func (e *xlsxExportWriter) Close() error {
+	return e.writer.Close()
+}
+
+// writeJSONString appends value as a JSON string without escaping HTML, since
+// email bodies are full of tags.
+func writeJSONString(buf *bytes.Buffer, value string) {
+	encoder := json.NewEncoder(buf)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(value)
+	buf.Truncate(buf.Len() - 1) // Encode always appends a newline
+}
+
+func presetNames(presets map[string]ExportPreset) []string {
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const JOB_TYPE_GENERATE_EMAIL = "generate_email"
+
+// submitEmailGeneration queues a ?async=true generation as a one-item job keyed
+// by the lead's email. The result is saved like POST /cache/savemail/:email, so
+// it survives the sidebar being closed before the provider answers.
+func (s *CacheServer) submitEmailGeneration(c *gin.Context, request *EmailGenerationRequest, generator EmailGenerator, prompt *EmailPrompt) {
+	email := strings.ToLower(strings.TrimSpace(request.Email))
+	if email == "" {
+		prompt.reservation.release()
+		c.JSON(http.StatusBadRequest, JobResponse{
+			Success: false,
+			Error:   "email is required for async generation",
+		})
+		return
+	}
+	if err := validateEmailAddress(email); err != nil {
+		prompt.reservation.release()
+		c.JSON(http.StatusBadRequest, JobResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	force := c.Query("force") == "true"
+	job, err := s.jobs.Submit(JOB_TYPE_GENERATE_EMAIL, []string{email}, 1,
+		func(ctx context.Context, email string) (interface{}, error) {
+			// The budget stays reserved while the job waits for a worker
+			defer prompt.reservation.release()
+			// Identical jobs share one generation, which alone takes a worker
+			return s.dedupedGeneration(ctx, "save", force, generator, prompt, request.Variants,
+				func(ctx context.Context) (*EmailGenerationResponse, error) {
+					return s.generateAndSaveEmail(ctx, email, generator, prompt, request.Variants)
+				})
+		})
+	if err != nil {
+		prompt.reservation.release()
+		log.Printf("Error starting email generation job: %v", err)
+		c.JSON(http.StatusInternalServerError, JobResponse{
+			Success: false,
+			Error:   "Failed to start email generation job",
+		})
+		return
+	}
+
+	log.Printf("📥 Queued email generation job %s for %s (%s)", job.ID, email, generator.Name())
+	c.JSON(http.StatusAccepted, JobResponse{
+		Success: true,
+		Job:     job,
+	})
+}
+
+// generateAndSaveEmail waits for a free generation worker, runs the generator
+// and stores the email, or all variants when more than one is requested, for
+// the lead.
+func (s *CacheServer) generateAndSaveEmail(ctx context.Context, email string, generator EmailGenerator, prompt *EmailPrompt, variants int) (*EmailGenerationResponse, error) {
+	select {
+	case s.generationSlots <- struct{}{}:
+		defer func() { <-s.generationSlots }()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	if variants > 1 {
+		log.Printf("🔄 Starting %d %s variants for %s", variants, generator.Name(), email)
+		response, err := s.generateAndSaveVariants(ctx, email, generator, prompt, variants)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate email: %v", err)
+		}
+		return response, nil
+	}
+
+	log.Printf("🔄 Starting %s generation for %s", generator.Name(), email)
+	result, err := s.generateEmail(ctx, generator, prompt, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate email: %v", err)
+	}
+	content := result.Content
+
+	emailData := map[string]interface{}{
+		"subject":         content.Subject,
+		"body":            content.Body,
+		"timestamp":       time.Now().UnixMilli(),
+		"provider":        generator.Name(),
+		"templateId":      prompt.TemplateID,
+		"templateVersion": prompt.TemplateVersion,
+		"promptHash":      promptHash(generator, prompt),
+	}
+	if len(result.Violations) > 0 {
+		emailData["violations"] = result.Violations
+	}
+	if result.GenerationID != "" {
+		emailData["generationId"] = result.GenerationID
+	}
+	if err := s.saveEmailContent(ctx, email, prompt.User, emailData); err != nil {
+		return nil, fmt.Errorf("failed to save generated email: %v", err)
+	}
+
+	response := newEmailGenerationResponse(generator, prompt, result, nil)
+	return &response, nil
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// MAX_EMAIL_VARIANTS bounds how many alternatives one request may ask for.
+	MAX_EMAIL_VARIANTS = 5
+
+	VARIANT_CHOICE_COLLECTION = "variant_choices"
+)
+
+// ErrVariantNotFound is returned when a chosen variant is not saved for the lead.
+var ErrVariantNotFound = errors.New("email variant not found")
+
+// variantAngles give each alternative a different opening, so variants differ
+// in more than wording. Variant N uses angle N-1.
+var variantAngles = []string{
+	"lead with a specific challenge companies like theirs typically face",
+	"lead with something recent or notable about the company",
+	"lead with a concrete result achieved for a similar company",
+	"open with a short, direct question about their priorities",
+	"keep it especially brief and lead with one bold, specific claim",
+}
+
+// EmailVariant is one of several alternative emails generated for a lead.
+type EmailVariant struct {
+	ID         string   `json:"id"`
+	Angle      string   `json:"angle"`
+	Subject    string   `json:"subject"`
+	Body       string   `json:"body"`
+	Attempts   int      `json:"attempts,omitempty"`
+	Violations []string `json:"violations,omitempty"`
+	// GenerationID identifies the recorded prompt and output of this variant
+	GenerationID string `json:"generationId,omitempty"`
+}
+
+// VariantChoice records which variant was picked for a lead, so reply rates
+// can later be compared per angle.
+type VariantChoice struct {
+	Email           string `json:"email"`
+	VariantID       string `json:"variantId"`
+	Angle           string `json:"angle"`
+	Subject         string `json:"subject"`
+	VariantCount    int    `json:"variantCount"`
+	Provider        string `json:"provider,omitempty"`
+	TemplateID      string `json:"templateId,omitempty"`
+	TemplateVersion int    `json:"templateVersion,omitempty"`
+	// Edited is set when the saved subject or body differs from the variant
+	Edited   bool   `json:"edited"`
+	User     string `json:"user,omitempty"`
+	ChosenAt int64  `json:"chosenAt"`
+}
+
+type VariantChoicesResponse struct {
+	Success bool             `json:"success"`
+	Choices []*VariantChoice `json:"choices"`
+	// ByAngle and ByVariant count the choices per angle and per variant id
+	ByAngle   map[string]int `json:"byAngle"`
+	ByVariant map[string]int `json:"byVariant"`
+	Error     string         `json:"error,omitempty"`
+}
+
+// variantPrompt asks for variant index (0-based) of total, each with its own angle.
+func variantPrompt(prompt *EmailPrompt, index, total int) *EmailPrompt {
+	variant := *prompt
+	variant.Text = fmt.Sprintf("%s\n\nThis is alternative %d of %d for A/B testing: %s. Use a subject line clearly different from the other alternatives.",
+		prompt.Text, index+1, total, variantAngles[index])
+	return &variant
+}
+
+// generateAndSaveVariants generates count alternatives in parallel and stores
+// them all for the lead; the first usable one becomes the saved subject and
+// body until another is chosen through POST /cache/savemail/:email. Variants
+// that fail are left out; only when all fail is an error returned.
+func (s *CacheServer) generateAndSaveVariants(ctx context.Context, email string, generator EmailGenerator, prompt *EmailPrompt, count int) (*EmailGenerationResponse, error) {
+	results := make([]*GeneratedEmail, count)
+	errs := make([]error, count)
+	var wg sync.WaitGroup
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = s.generateEmail(ctx, generator, variantPrompt(prompt, i, count), nil, nil)
+		}(i)
+	}
+	wg.Wait()
+
+	response := newEmailGenerationResponse(generator, prompt, nil, nil)
+	usage := TokenUsage{Provider: generator.Name()}
+	var firstErr error
+	for i, result := range results {
+		if result != nil {
+			usage.Model = result.Usage.Model
+			usage.add(result.Usage)
+			response.Attempts += result.Attempts
+		}
+		if errs[i] != nil {
+			log.Printf("⚠️ Variant %d of %d for %s failed: %v", i+1, count, email, errs[i])
+			if firstErr == nil {
+				firstErr = errs[i]
+			}
+			continue
+		}
+		response.Variants = append(response.Variants, EmailVariant{
+			ID:           fmt.Sprintf("v%d", i+1),
+			Angle:        variantAngles[i],
+			Subject:      result.Content.Subject,
+			Body:         result.Content.Body,
+			Attempts:     result.Attempts,
+			Violations:   result.Violations,
+			GenerationID: result.GenerationID,
+		})
+	}
+	response.Usage = &usage
+	if len(response.Variants) == 0 {
+		return nil, firstErr
+	}
+
+	first := response.Variants[0]
+	response.Subject, response.Body, response.Violations = first.Subject, first.Body, first.Violations
+
+	emailData := map[string]interface{}{
+		"subject":         first.Subject,
+		"body":            first.Body,
+		"timestamp":       time.Now().UnixMilli(),
+		"provider":        generator.Name(),
+		"templateId":      prompt.TemplateID,
+		"templateVersion": prompt.TemplateVersion,
+		"promptHash":      promptHash(generator, prompt),
+		"variants":        response.Variants,
+	}
+	if err := s.saveEmailContent(ctx, email, prompt.User, emailData); err != nil {
+		return nil, fmt.Errorf("failed to save generated email: %v", err)
+	}
+	log.Printf("🔀 Saved %d of %d email variants for %s", len(response.Variants), count, email)
+	return &response, nil
+}
+
+// generateEmailVariants answers a blocking generation request for more than
+// one variant.
+func (s *CacheServer) generateEmailVariants(c *gin.Context, request *EmailGenerationRequest, generator EmailGenerator, prompt *EmailPrompt, force bool) {
+	email := strings.ToLower(strings.TrimSpace(request.Email))
+	response, err := s.dedupedGeneration(c.Request.Context(), "save", force, generator, prompt, request.Variants,
+		func(ctx context.Context) (*EmailGenerationResponse, error) {
+			log.Printf("🔄 Starting %d %s variants for %s", request.Variants, generator.Name(), email)
+			return s.generateAndSaveVariants(ctx, email, generator, prompt, request.Variants)
+		})
+	if err != nil {
+		log.Printf("❌ Error generating email variants: %v", err)
+		if c.Request.Context().Err() != nil {
+			return
+		}
+		status := http.StatusInternalServerError
+		if errors.Is(err, ErrCircuitOpen) {
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, newEmailGenerationResponse(generator, prompt, nil, err))
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// chooseEmailVariant completes a savemail request that names a chosenVariant:
+// the variant must be among those saved for the lead, its subject and body are
+// used unless the request sends edited ones, the saved variants are kept, and
+// the choice is recorded.
+func (s *CacheServer) chooseEmailVariant(email, variantID, user string, emailData map[string]interface{}) error {
+	saved, err := s.store.GetEmail(s.ctx, email)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return fmt.Errorf("%w: no variants are saved for %s", ErrVariantNotFound, email)
+		}
+		return err
+	}
+
+	var stored struct {
+		Variants        []EmailVariant `json:"variants"`
+		Provider        string         `json:"provider"`
+		TemplateID      string         `json:"templateId"`
+		TemplateVersion int            `json:"templateVersion"`
+	}
+	raw, err := json.Marshal(saved.EmailData)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(raw, &stored); err != nil {
+		return fmt.Errorf("failed to read saved variants: %v", err)
+	}
+
+	var variant *EmailVariant
+	for i := range stored.Variants {
+		if stored.Variants[i].ID == variantID {
+			variant = &stored.Variants[i]
+			break
+		}
+	}
+	if variant == nil {
+		return fmt.Errorf("%w: %s is not saved for %s", ErrVariantNotFound, variantID, email)
+	}
+
+	if subject, _ := emailData["subject"].(string); subject == "" {
+		emailData["subject"] = variant.Subject
+	}
+	if body, _ := emailData["body"].(string); body == "" {
+		emailData["body"] = variant.Body
+	}
+	for _, key := range []string{"variants", "provider", "templateId", "templateVersion", "promptHash"} {
+		if value, ok := saved.EmailData[key]; ok {
+			emailData[key] = value
+		}
+	}
+	// The email is as old as its generation, for generation.reuseWithinDays
+	if _, ok := emailData["timestamp"]; !ok {
+		emailData["timestamp"] = saved.EmailData["timestamp"]
+	}
+	now := time.Now().UnixMilli()
+	emailData["chosenAt"] = now
+
+	choice := &VariantChoice{
+		Email:           email,
+		VariantID:       variant.ID,
+		Angle:           variant.Angle,
+		Subject:         variant.Subject,
+		VariantCount:    len(stored.Variants),
+		Provider:        stored.Provider,
+		TemplateID:      stored.TemplateID,
+		TemplateVersion: stored.TemplateVersion,
+		Edited:          emailData["subject"] != variant.Subject || emailData["body"] != variant.Body,
+		User:            user,
+		ChosenAt:        now,
+	}
+	// One choice per lead; choosing again replaces it
+	if err := putRecordJSON(s.ctx, s.store, VARIANT_CHOICE_COLLECTION, email, choice); err != nil {
+		return fmt.Errorf("failed to record variant choice: %v", err)
+	}
+	log.Printf("🔀 %s chose variant %s of %d for %s (edited: %t)", user, variant.ID, len(stored.Variants), email, choice.Edited)
+	return nil
+}
+
+// listVariantChoices returns every recorded choice, newest first, with counts
+// per angle and per variant id.
+func (s *CacheServer) listVariantChoices(c *gin.Context) {
+	records, err := s.store.ListRecords(s.ctx, VARIANT_CHOICE_COLLECTION)
+	if err != nil {
+		log.Printf("Error listing variant choices: %v", err)
+		c.JSON(http.StatusInternalServerError, VariantChoicesResponse{
+			Success: false,
+			Error:   "Failed to list variant choices",
+		})
+		return
+	}
+
+	response := VariantChoicesResponse{
+		Success:   true,
+		Choices:   make([]*VariantChoice, 0, len(records)),
+		ByAngle:   make(map[string]int),
+		ByVariant: make(map[string]int),
+	}
+	for _, raw := range records {
+		var choice VariantChoice
+		if err := json.Unmarshal(raw, &choice); err != nil {
+			continue
+		}
+		response.Choices = append(response.Choices, &choice)
+		response.ByAngle[choice.Angle]++
+		response.ByVariant[choice.VariantID]++
+	}
+	sort.Slice(response.Choices, func(i, j int) bool { return response.Choices[i].ChosenAt > response.Choices[j].ChosenAt })
+
+	c.JSON(http.StatusOK, response)
+}
+
+// validateVariantCount checks the variants field of a generation request;
+// 0 and 1 both mean a single email.
+func validateVariantCount(request *EmailGenerationRequest) error {
+	if request.Variants < 0 || request.Variants > MAX_EMAIL_VARIANTS {
+		return fmt.Errorf("variants must be between 1 and %d", MAX_EMAIL_VARIANTS)
+	}
+	if request.Variants <= 1 {
+		return nil
+	}
+	email := strings.ToLower(strings.TrimSpace(request.Email))
+	if email == "" {
+		return fmt.Errorf("email is required to generate variants, they are saved for the lead")
+	}
+	return validateEmailAddress(email)
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// GenerationFlights coalesces concurrent identical generations: the first
+// request runs the generation and later ones wait for its result. The shared
+// call is cancelled only once every waiting request has gone away.
+type GenerationFlights struct {
+	mu      sync.Mutex
+	flights map[string]*generationFlight
+}
+
+type generationFlight struct {
+	done     chan struct{}
+	response *EmailGenerationResponse
+	err      error
+	waiters  int
+	cancel   context.CancelFunc
+}
+
+func NewGenerationFlights() *GenerationFlights {
+	return &GenerationFlights{flights: make(map[string]*generationFlight)}
+}
+
+// Do runs fn once for all concurrent callers with the same key. shared is set
+// for callers that joined a generation already in progress.
+func (g *GenerationFlights) Do(ctx context.Context, key string, fn func(ctx context.Context) (*EmailGenerationResponse, error)) (response *EmailGenerationResponse, shared bool, err error) {
+	g.mu.Lock()
+	flight, shared := g.flights[key]
+	if !shared {
+		// Detached from the first caller, so its leaving does not cancel the others
+		flightCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		flight = &generationFlight{done: make(chan struct{}), cancel: cancel}
+		g.flights[key] = flight
+		go func() {
+			flight.response, flight.err = fn(flightCtx)
+			g.forget(key, flight)
+			cancel()
+			close(flight.done)
+		}()
+	}
+	flight.waiters++
+	g.mu.Unlock()
+
+	select {
+	case <-flight.done:
+		return flight.response, shared, flight.err
+	case <-ctx.Done():
+		g.mu.Lock()
+		flight.waiters--
+		abandoned := flight.waiters == 0
+		if abandoned {
+			delete(g.flights, key)
+		}
+		g.mu.Unlock()
+		if abandoned {
+			flight.cancel()
+		}
+		return nil, shared, ctx.Err()
+	}
+}
+
+func (g *GenerationFlights) forget(key string, flight *generationFlight) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.flights[key] == flight {
+		delete(g.flights, key)
+	}
+}
+
+// promptHash identifies what a generation was asked: the provider and the
+// full prompt, which covers the template version, its variables and the lead
+// context. It is saved with generated emails to decide whether one can be reused.
+func promptHash(generator EmailGenerator, prompt *EmailPrompt) string {
+	sum := sha256.Sum256([]byte(generator.Name() + "\x00" + prompt.Text))
+	return hex.EncodeToString(sum[:16])
+}
+
+// generationKey identifies identical requests for coalescing; mode separates
+// generations that save their result from those that only return it, and
+// workspace keeps one workspace from receiving an email saved in another.
+func generationKey(workspace, mode string, generator EmailGenerator, prompt *EmailPrompt, variants int) string {
+	return fmt.Sprintf("%s:%s:%s:%s:%d", workspace, mode, prompt.Lead, promptHash(generator, prompt), variants)
+}
+
+// dedupedGeneration returns the email saved for the lead when it can be reused
+// (see reusableEmail) and force is not set, and otherwise runs fn, sharing one
+// run between concurrent identical requests.
+func (s *CacheServer) dedupedGeneration(ctx context.Context, mode string, force bool, generator EmailGenerator, prompt *EmailPrompt, variants int, fn func(ctx context.Context) (*EmailGenerationResponse, error)) (*EmailGenerationResponse, error) {
+	if !force {
+		if reused := s.reusableEmail(ctx, generator, prompt, variants); reused != nil {
+			return reused, nil
+		}
+	}
+
+	response, shared, err := s.flights.Do(ctx, generationKey(s.workspace, mode, generator, prompt, variants), fn)
+	if shared {
+		log.Printf("🔗 Joined an identical %s generation already running for %s", generator.Name(), prompt.CompanyInfo)
+	}
+	return response, err
+}
+
+// reusableEmail returns the email saved for the prompt's lead when
+// generation.reuseWithinDays is set and it was generated from the same
+// prompt, by the same provider, within that many days, with at least as many
+// variants as requested. It returns nil when nothing can be reused.
+func (s *CacheServer) reusableEmail(ctx context.Context, generator EmailGenerator, prompt *EmailPrompt, variants int) *EmailGenerationResponse {
+	days := s.config.Generation.ReuseWithinDays
+	if days <= 0 || prompt.Lead == "" {
+		return nil
+	}
+
+	saved, err := s.store.GetEmail(ctx, prompt.Lead)
+	if err != nil {
+		if !errors.Is(err, ErrNotFound) {
+			log.Printf("⚠️ Could not read saved email of %s for reuse: %v", prompt.Lead, err)
+		}
+		return nil
+	}
+
+	var stored struct {
+		Subject      string         `json:"subject"`
+		Body         string         `json:"body"`
+		Timestamp    int64          `json:"timestamp"`
+		PromptHash   string         `json:"promptHash"`
+		GenerationID string         `json:"generationId"`
+		Violations   []string       `json:"violations"`
+		Variants     []EmailVariant `json:"variants"`
+	}
+	raw, err := json.Marshal(saved.EmailData)
+	if err != nil || json.Unmarshal(raw, &stored) != nil {
+		return nil
+	}
+	age := time.Since(time.UnixMilli(stored.Timestamp))
+	if stored.PromptHash != promptHash(generator, prompt) || age > time.Duration(days)*24*time.Hour {
+		return nil
+	}
+	if variants > 1 && len(stored.Variants) < variants {
+		return nil
+	}
+
+	log.Printf("♻️ Reusing the email generated for %s %s ago", prompt.Lead, age.Round(time.Minute))
+	response := newEmailGenerationResponse(generator, prompt, nil, nil)
+	response.Subject = stored.Subject
+	response.Body = stored.Body
+	response.Violations = stored.Violations
+	response.GenerationID = stored.GenerationID
+	if variants > 1 {
+		response.Variants = stored.Variants
+	}
+	response.Reused = true
+	return &response
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	GENERATOR_OPENAI = "openai"
+	GENERATOR_GEMINI = "gemini"
+	GENERATOR_STUB   = "stub"
+)
+
+// EmailPrompt is everything a generator gets to write one email.
+type EmailPrompt struct {
+	CompanyInfo string
+	PersonName  string
+	// Text is the full instruction sent to the model.
+	Text string
+	// Variables are the values the prompt template was rendered with.
+	Variables       map[string]string
+	TemplateID      string
+	TemplateVersion int
+	// User and Lead say who the email is written by and for, for usage accounting.
+	User string
+	Lead string
+	// Context is what is known about the lead, already part of Text; nil
+	// when the request names no lead.
+	Context *LeadContext
+	// reservation is the budget held for the request, released once it is done
+	reservation *budgetReservation
+}
+
+// EmailGenerator writes a cold email from a prompt. Implementations return the
+// subject and HTML body, with the provider's token counts in Usage. When the
+// output is unreadable (ErrInvalidOutput) they still return content carrying
+// the Usage, so the spent tokens are accounted for.
+type EmailGenerator interface {
+	Name() string
+	Generate(ctx context.Context, prompt *EmailPrompt) (*EmailContent, error)
+}
+
+// NewEmailGenerators builds every provider; cfg.Generation.Provider picks the
+// default and requests may name another.
+func NewEmailGenerators(cfg *Config) map[string]EmailGenerator {
+	return map[string]EmailGenerator{
+		GENERATOR_OPENAI: NewOpenAIGenerator(cfg.OpenAI, cfg.Generation),
+		GENERATOR_GEMINI: NewGeminiGenerator(cfg.Generation.Gemini, cfg.Generation),
+		GENERATOR_STUB:   NewStubGenerator(),
+	}
+}
+
+// generatorFor returns the generator named in a request, or the configured default.
+func (s *CacheServer) generatorFor(name string) (EmailGenerator, error) {
+	if name == "" {
+		name = s.config.Generation.Provider
+	}
+	generator, ok := s.generators[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown email generator %q (use one of %s)", name, strings.Join(generatorNames(s.generators), ", "))
+	}
+	return generator, nil
+}
+
+func generatorNames(generators map[string]EmailGenerator) []string {
+	names := make([]string, 0, len(generators))
+	for name := range generators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// newEmailGenerationResponse describes the outcome of generateEmail the same
+// way for the blocking, streaming and async endpoints.
+func newEmailGenerationResponse(generator EmailGenerator, prompt *EmailPrompt, result *GeneratedEmail, err error) EmailGenerationResponse {
+	response := EmailGenerationResponse{
+		Success:  err == nil,
+		Provider: generator.Name(),
+
+		TemplateID:      prompt.TemplateID,
+		TemplateVersion: prompt.TemplateVersion,
+		Context:         prompt.Context,
+	}
+	if result != nil {
+		usage := result.Usage
+		response.Usage = &usage
+		response.GenerationID = result.GenerationID
+		response.Attempts = result.Attempts
+		response.Violations = result.Violations
+		if err == nil {
+			response.Subject = result.Content.Subject
+			response.Body = result.Content.Body
+		}
+	}
+	if err != nil {
+		response.Error = fmt.Sprintf("Failed to generate email: %v", err)
+	}
+	return response
+}
+
+// withUsage attaches usage to content, creating an empty one for output that
+// could not be parsed.
+func withUsage(content *EmailContent, usage TokenUsage) *EmailContent {
+	if content == nil {
+		content = &EmailContent{}
+	}
+	content.Usage = usage
+	return content
+}
+
+var (
+	codeFencePattern    = regexp.MustCompile("(?s)^\\s*```[a-zA-Z]*\\s*(.*?)\\s*```\\s*$")
+	markdownBoldPattern = regexp.MustCompile(`\*\*(.+?)\*\*`)
+)
+
+// parseEmailContent reads the {"subject", "body"} object a model returns,
+// tolerating a surrounding ```json fence, prose around the object and
+// **markdown bold**. Anything else is an ErrInvalidOutput, so the caller can
+// retry instead of showing raw model text as the email.
+func parseEmailContent(provider, content string) (*EmailContent, error) {
+	cleaned := strings.TrimSpace(content)
+	if match := codeFencePattern.FindStringSubmatch(cleaned); match != nil {
+		cleaned = match[1]
+	}
+	if start, end := strings.Index(cleaned, "{"), strings.LastIndex(cleaned, "}"); start >= 0 && end > start {
+		cleaned = cleaned[start : end+1]
+	}
+
+	var emailContent EmailContent
+	if err := json.Unmarshal([]byte(cleaned), &emailContent); err != nil {
+		log.Printf("❌ Warning: Could not parse JSON response from %s: %v", provider, err)
+		// The output is a draft about a real person; log its size, not its text
+		log.Printf("📝 Unparsable output was %d bytes", len(content))
+		return nil, fmt.Errorf("%w: output is not a JSON object with subject and body", ErrInvalidOutput)
+	}
+	if strings.TrimSpace(emailContent.Subject) == "" || strings.TrimSpace(emailContent.Body) == "" {
+		return nil, fmt.Errorf("%w: subject or body is empty", ErrInvalidOutput)
+	}
+
+	emailContent.Subject = markdownBoldPattern.ReplaceAllString(emailContent.Subject, "$1")
+	emailContent.Body = markdownBoldPattern.ReplaceAllString(emailContent.Body, "<b>$1</b>")
+	return &emailContent, nil
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// GeminiGenerator calls the Gemini generateContent REST API with Google Search
+// grounding, replacing the old pythonserver.py.
+type GeminiGenerator struct {
+	apiKey   string
+	model    string
+	endpoint string
+	timeout  time.Duration
+	client   *ProviderClient
+}
+
+type geminiPart struct {
+	Text string `json:"text"`
+}
+
+type geminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []geminiPart `json:"parts"`
+}
+
+type geminiRequest struct {
+	Contents         []geminiContent          `json:"contents"`
+	Tools            []map[string]interface{} `json:"tools,omitempty"`
+	GenerationConfig map[string]interface{}   `json:"generationConfig,omitempty"`
+}
+
+type geminiResponse struct {
+	Candidates []struct {
+		Content      geminiContent `json:"content"`
+		FinishReason string        `json:"finishReason"`
+	} `json:"candidates"`
+	UsageMetadata *struct {
+		PromptTokenCount     int `json:"promptTokenCount"`
+		CandidatesTokenCount int `json:"candidatesTokenCount"`
+		ThoughtsTokenCount   int `json:"thoughtsTokenCount"`
+		TotalTokenCount      int `json:"totalTokenCount"`
+	} `json:"usageMetadata"`
+	Error *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Status  string `json:"status"`
+	} `json:"error"`
+}
+
+func NewGeminiGenerator(cfg GeminiConfig, generation GenerationConfig) *GeminiGenerator {
+	return &GeminiGenerator{
+		apiKey:   cfg.APIKey,
+		model:    cfg.Model,
+		endpoint: strings.TrimSuffix(cfg.Endpoint, "/"),
+		timeout:  time.Duration(cfg.Timeout),
+		client:   NewProviderClient("Gemini", generation),
+	}
+}
+
+func (g *GeminiGenerator) Client() *ProviderClient {
+	return g.client
+}
+
+func (g *GeminiGenerator) Name() string {
+	return GENERATOR_GEMINI
+}
+
+// do posts the prompt to the given model method (generateContent or
+// streamGenerateContent?alt=sse); the caller closes the body.
+func (g *GeminiGenerator) do(ctx context.Context, prompt *EmailPrompt, method string) (*http.Response, error) {
+	geminiReq := geminiRequest{
+		Contents: []geminiContent{
+			{Role: "user", Parts: []geminiPart{{Text: prompt.Text}}},
+		},
+		Tools: []map[string]interface{}{
+			{"google_search": map[string]interface{}{}},
+		},
+		// Gemini rejects a responseSchema together with the google_search
+		// tool, so the JSON shape is enforced by parsing and validation instead
+		GenerationConfig: map[string]interface{}{
+			"temperature": 0,
+		},
+	}
+
+	requestBody, err := json.Marshal(geminiReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %v", err)
+	}
+
+	url := fmt.Sprintf("%s/%s:%s", g.endpoint, g.model, method)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(requestBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if g.apiKey != "" {
+		req.Header.Set("x-goog-api-key", g.apiKey)
+	}
+
+	log.Printf("🌐 Making request to Gemini API...")
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make request to Gemini: %w", err)
+	}
+	log.Printf("📡 Received response from Gemini API with status: %d", resp.StatusCode)
+	return resp, nil
+}
+
+func (g *GeminiGenerator) Generate(ctx context.Context, prompt *EmailPrompt) (*EmailContent, error) {
+	ctx, cancel := withProviderTimeout(ctx, g.timeout)
+	defer cancel()
+
+	resp, err := g.do(ctx, prompt, "generateContent")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Gemini API returned status %d: %s", resp.StatusCode, string(responseBody))
+	}
+
+	var geminiResp geminiResponse
+	if err := json.Unmarshal(responseBody, &geminiResp); err != nil {
+		return nil, fmt.Errorf("failed to parse Gemini response: %v", err)
+	}
+	if geminiResp.Error != nil {
+		return nil, fmt.Errorf("Gemini API error %s: %s", geminiResp.Error.Status, geminiResp.Error.Message)
+	}
+
+	usage := geminiResp.tokenUsage(g.model)
+	content := geminiResp.text()
+	if content == "" {
+		return withUsage(nil, usage), fmt.Errorf("no output text found in Gemini response")
+	}
+
+	emailContent, err := parseEmailContent("Gemini", content)
+	return withUsage(emailContent, usage), err
+}
+
+// tokenUsage converts usageMetadata; thinking tokens are billed as output.
+func (r *geminiResponse) tokenUsage(model string) TokenUsage {
+	usage := TokenUsage{Model: model}
+	if r.UsageMetadata != nil {
+		usage.InputTokens = r.UsageMetadata.PromptTokenCount
+		usage.OutputTokens = r.UsageMetadata.CandidatesTokenCount + r.UsageMetadata.ThoughtsTokenCount
+		usage.TotalTokens = r.UsageMetadata.TotalTokenCount
+	}
+	return usage
+}
+
+// text returns the text of the first candidate that has any.
+func (r *geminiResponse) text() string {
+	var content strings.Builder
+	for _, candidate := range r.Candidates {
+		for _, part := range candidate.Content.Parts {
+			content.WriteString(part.Text)
+		}
+		if content.Len() > 0 {
+			break
+		}
+	}
+	return content.String()
+}
+
+// GenerateStream uses streamGenerateContent, where every SSE event carries the
+// next chunk of the candidate's text.
+func (g *GeminiGenerator) GenerateStream(ctx context.Context, prompt *EmailPrompt, onDelta func(delta string)) (*EmailContent, error) {
+	ctx, cancel := withProviderTimeout(ctx, g.timeout)
+	defer cancel()
+
+	resp, err := g.do(ctx, prompt, "streamGenerateContent?alt=sse")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		responseBody, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("Gemini API returned status %d: %s", resp.StatusCode, string(responseBody))
+	}
+
+	var content strings.Builder
+	usage := TokenUsage{Model: g.model}
+	err = readSSE(resp.Body, func(_, data string) error {
+		var chunk geminiResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return fmt.Errorf("failed to parse Gemini stream chunk: %v", err)
+		}
+		if chunk.Error != nil {
+			return fmt.Errorf("Gemini API error %s: %s", chunk.Error.Status, chunk.Error.Message)
+		}
+		// Every chunk repeats the running totals; the last one wins
+		if chunk.UsageMetadata != nil {
+			usage = chunk.tokenUsage(g.model)
+		}
+		if delta := chunk.text(); delta != "" {
+			content.WriteString(delta)
+			onDelta(delta)
+		}
+		return nil
+	})
+	if err != nil {
+		return withUsage(nil, usage), err
+	}
+	if content.Len() == 0 {
+		return withUsage(nil, usage), fmt.Errorf("no output text found in Gemini response")
+	}
+
+	emailContent, err := parseEmailContent("Gemini", content.String())
+	return withUsage(emailContent, usage), err
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type OpenAIRequest struct {
+	Model  string             `json:"model"`
+	Input  string             `json:"input"`
+	Tools  []Tool             `json:"tools"`
+	Text   *OpenAITextOptions `json:"text,omitempty"`
+	Stream bool               `json:"stream,omitempty"`
+}
+
+// OpenAITextOptions requests structured output matching a JSON schema.
+type OpenAITextOptions struct {
+	Format OpenAITextFormat `json:"format"`
+}
+
+type OpenAITextFormat struct {
+	Type   string                 `json:"type"`
+	Name   string                 `json:"name"`
+	Schema map[string]interface{} `json:"schema"`
+	Strict bool                   `json:"strict"`
+}
+
+type Tool struct {
+	Type string `json:"type"`
+}
+
+type OpenAIResponse struct {
+	Output []OutputItem `json:"output"`
+	Usage  *OpenAIUsage `json:"usage"`
+}
+
+type OpenAIUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+	TotalTokens  int `json:"total_tokens"`
+}
+
+// tokenUsage converts the reported usage. The configured model name is kept,
+// rather than the dated snapshot OpenAI reports, so it matches the pricing.
+func (r *OpenAIResponse) tokenUsage(model string) TokenUsage {
+	usage := TokenUsage{Model: model}
+	if r.Usage != nil {
+		usage.InputTokens = r.Usage.InputTokens
+		usage.OutputTokens = r.Usage.OutputTokens
+		usage.TotalTokens = r.Usage.TotalTokens
+	}
+	return usage
+}
+
+type OutputItem struct {
+	Type    string    `json:"type"`
+	Content []Content `json:"content"`
+}
+
+type Content struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// OpenAIGenerator calls the OpenAI Responses API with web search enabled.
+type OpenAIGenerator struct {
+	config OpenAIConfig
+	client *ProviderClient
+}
+
+func NewOpenAIGenerator(cfg OpenAIConfig, generation GenerationConfig) *OpenAIGenerator {
+	return &OpenAIGenerator{
+		config: cfg,
+		client: NewProviderClient("OpenAI", generation),
+	}
+}
+
+func (g *OpenAIGenerator) Client() *ProviderClient {
+	return g.client
+}
+
+func (g *OpenAIGenerator) Name() string {
+	return GENERATOR_OPENAI
+}
+
+// do sends the prompt to the Responses API; the caller closes the body.
+func (g *OpenAIGenerator) do(ctx context.Context, prompt *EmailPrompt, stream bool) (*http.Response, error) {
+	// Prepare OpenAI request
+	openAIRequest := OpenAIRequest{
+		Model: g.config.Model,
+		Input: prompt.Text,
+		Tools: []Tool{
+			{
+				Type: "web_search",
+			},
+		},
+		Text: &OpenAITextOptions{
+			Format: OpenAITextFormat{
+				Type:   "json_schema",
+				Name:   "email",
+				Schema: emailOutputSchema,
+				Strict: true,
+			},
+		},
+		Stream: stream,
+	}
+
+	// Convert to JSON
+	requestBody, err := json.Marshal(openAIRequest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %v", err)
+	}
+
+	// Make HTTP request to OpenAI
+	req, err := http.NewRequestWithContext(ctx, "POST", g.config.Endpoint, bytes.NewBuffer(requestBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+
+	// Set headers
+	req.Header.Set("Content-Type", "application/json")
+	if g.config.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+g.config.APIKey)
+	}
+
+	log.Printf("🌐 Making request to OpenAI API...")
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make request to OpenAI: %w", err)
+	}
+	log.Printf("📡 Received response from OpenAI API with status: %d", resp.StatusCode)
+	return resp, nil
+}
+
+func (g *OpenAIGenerator) Generate(ctx context.Context, prompt *EmailPrompt) (*EmailContent, error) {
+	// Bound the call and its retries by the configured timeout as well as the caller's context
+	ctx, cancel := withProviderTimeout(ctx, time.Duration(g.config.Timeout))
+	defer cancel()
+
+	resp, err := g.do(ctx, prompt, false)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// Read response
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %v", err)
+	}
+
+	// Check status code
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("OpenAI API returned status %d: %s", resp.StatusCode, string(responseBody))
+	}
+
+	// Parse OpenAI response
+	var openAIResponse OpenAIResponse
+	if err := json.Unmarshal(responseBody, &openAIResponse); err != nil {
+		return nil, fmt.Errorf("failed to parse OpenAI response: %v", err)
+	}
+	usage := openAIResponse.tokenUsage(g.config.Model)
+
+	// Extract content from the nested structure
+	var content string
+	for _, output := range openAIResponse.Output {
+		if output.Type == "message" {
+			for _, contentItem := range output.Content {
+				if contentItem.Type == "output_text" {
+					content = contentItem.Text
+					break
+				}
+			}
+			if content != "" {
+				break
+			}
+		}
+	}
+
+	if content == "" {
+		return withUsage(nil, usage), fmt.Errorf("no output text found in OpenAI response")
+	}
+
+	// Parse the JSON response from OpenAI (it should contain subject and body)
+	emailContent, err := parseEmailContent("OpenAI", content)
+	if err != nil {
+		return withUsage(nil, usage), err
+	}
+	log.Printf("✅ Successfully parsed email - Subject: %s", emailContent.Subject)
+	return withUsage(emailContent, usage), nil
+}
+
+// openAIStreamEvent is one event of a streamed Responses API call.
+type openAIStreamEvent struct {
+	Type    string `json:"type"`
+	Delta   string `json:"delta"`
+	Message string `json:"message"`
+	Error   *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+	Response *struct {
+		OpenAIResponse
+		Error *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	} `json:"response"`
+}
+
+// GenerateStream streams the Responses API output, passing each
+// response.output_text.delta to onDelta.
+func (g *OpenAIGenerator) GenerateStream(ctx context.Context, prompt *EmailPrompt, onDelta func(delta string)) (*EmailContent, error) {
+	ctx, cancel := withProviderTimeout(ctx, time.Duration(g.config.Timeout))
+	defer cancel()
+
+	resp, err := g.do(ctx, prompt, true)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		responseBody, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("OpenAI API returned status %d: %s", resp.StatusCode, string(responseBody))
+	}
+
+	var content strings.Builder
+	usage := TokenUsage{Model: g.config.Model}
+	err = readSSE(resp.Body, func(_, data string) error {
+		var event openAIStreamEvent
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			return fmt.Errorf("failed to parse OpenAI stream event: %v", err)
+		}
+		switch event.Type {
+		case "response.output_text.delta":
+			content.WriteString(event.Delta)
+			onDelta(event.Delta)
+		case "response.completed":
+			if event.Response != nil {
+				usage = event.Response.tokenUsage(g.config.Model)
+			}
+		case "response.failed":
+			if event.Response != nil && event.Response.Error != nil {
+				return fmt.Errorf("OpenAI response failed: %s", event.Response.Error.Message)
+			}
+			return fmt.Errorf("OpenAI response failed")
+		case "error":
+			if event.Error != nil {
+				return fmt.Errorf("OpenAI stream error: %s", event.Error.Message)
+			}
+			return fmt.Errorf("OpenAI stream error: %s", event.Message)
+		}
+		return nil
+	})
+	if err != nil {
+		return withUsage(nil, usage), err
+	}
+	if content.Len() == 0 {
+		return withUsage(nil, usage), fmt.Errorf("no output text found in OpenAI response")
+	}
+
+	emailContent, err := parseEmailContent("OpenAI", content.String())
+	return withUsage(emailContent, usage), err
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	STREAM_EVENT_STATUS  = "status"
+	STREAM_EVENT_PARTIAL = "partial"
+	STREAM_EVENT_RESULT  = "result"
+	STREAM_EVENT_ERROR   = "error"
+
+	// streamHeartbeatInterval keeps proxies from closing the stream while the
+	// model is still searching the web and has not produced text yet.
+	streamHeartbeatInterval = 15 * time.Second
+)
+
+// EmailStreamer is implemented by generators that can report the raw model
+// output as it is produced. onDelta receives each new piece of text.
+type EmailStreamer interface {
+	GenerateStream(ctx context.Context, prompt *EmailPrompt, onDelta func(delta string)) (*EmailContent, error)
+}
+
+// StreamStatus is the payload of a "status" event.
+type StreamStatus struct {
+	// Stage is started, writing, retrying or waiting (a heartbeat)
+	Stage    string `json:"stage"`
+	Message  string `json:"message"`
+	Provider string `json:"provider,omitempty"`
+}
+
+// StreamPartial is the payload of a "partial" event: the subject and body
+// decoded so far from the model's JSON output.
+type StreamPartial struct {
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+// generateEmailSuggestionStream is the Server-Sent Events variant of
+// generateEmailSuggestion. It emits status events, partial subject/body as the
+// model writes them, then either a result event carrying the same JSON as the
+// blocking endpoint or an error event. An email saved for the lead that can be
+// reused (see reusableEmail) is sent as the result straight away.
+func (s *CacheServer) generateEmailSuggestionStream(c *gin.Context) {
+	var request EmailGenerationRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		log.Printf("Invalid JSON for email generation: %v", err)
+		c.JSON(http.StatusBadRequest, EmailGenerationResponse{
+			Success: false,
+			Error:   "Invalid JSON in request body",
+		})
+		return
+	}
+
+	if request.Variants > 1 {
+		c.JSON(http.StatusBadRequest, EmailGenerationResponse{
+			Success: false,
+			Error:   "variants cannot be streamed; use POST /generate-email-suggestion",
+		})
+		return
+	}
+
+	request.User = requestUser(c)
+	generator, prompt, err := s.prepareEmailGeneration(&request)
+	if err != nil {
+		c.JSON(generationRequestStatus(err), EmailGenerationResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+	defer prompt.reservation.release()
+
+	// The stream lasts as long as the generator does; its own timeout bounds it
+	clearWriteDeadline(c)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	send := func(event string, payload interface{}) {
+		c.SSEvent(event, payload)
+		c.Writer.Flush()
+	}
+
+	// A reused email is complete already; there is nothing to stream
+	if c.Query("force") != "true" {
+		if reused := s.reusableEmail(c.Request.Context(), generator, prompt, 1); reused != nil {
+			send(STREAM_EVENT_RESULT, reused)
+			return
+		}
+	}
+
+	log.Printf("🤖 Streaming email for company: %s, person: %s (%s, template %s v%d)", request.CompanyInfo, request.PersonName, generator.Name(), prompt.TemplateID, prompt.TemplateVersion)
+	send(STREAM_EVENT_STATUS, StreamStatus{Stage: "started", Message: "Researching the company", Provider: generator.Name()})
+
+	// message is either a piece of model output or the start of a retry
+	type message struct {
+		delta      string
+		retry      int
+		violations []string
+	}
+	type outcome struct {
+		result *GeneratedEmail
+		err    error
+	}
+	messages := make(chan message, 64)
+	done := make(chan outcome, 1)
+	ctx := c.Request.Context()
+
+	go func() {
+		defer close(messages)
+		emit := func(msg message) {
+			select {
+			case messages <- msg:
+			case <-ctx.Done():
+			}
+		}
+		result, err := s.generateEmail(ctx, generator, prompt,
+			func(delta string) { emit(message{delta: delta}) },
+			func(attempt int, violations []string) { emit(message{retry: attempt, violations: violations}) })
+		done <- outcome{result, err}
+	}()
+
+	heartbeat := time.NewTicker(streamHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	var text strings.Builder
+	var last StreamPartial
+	writing := false
+	for messages != nil {
+		select {
+		case msg, ok := <-messages:
+			if !ok {
+				messages = nil
+				continue
+			}
+			if msg.retry > 0 {
+				text.Reset()
+				last = StreamPartial{}
+				writing = false
+				send(STREAM_EVENT_STATUS, StreamStatus{
+					Stage:    "retrying",
+					Message:  fmt.Sprintf("Rewriting (attempt %d): %s", msg.retry, strings.Join(msg.violations, "; ")),
+					Provider: generator.Name(),
+				})
+				continue
+			}
+			if !writing {
+				writing = true
+				send(STREAM_EVENT_STATUS, StreamStatus{Stage: "writing", Message: "Writing the email", Provider: generator.Name()})
+			}
+			text.WriteString(msg.delta)
+			partial := StreamPartial{
+				Subject: partialJSONString(text.String(), "subject"),
+				Body:    partialJSONString(text.String(), "body"),
+			}
+			if partial != last {
+				last = partial
+				send(STREAM_EVENT_PARTIAL, partial)
+			}
+		case <-heartbeat.C:
+			send(STREAM_EVENT_STATUS, StreamStatus{Stage: "waiting", Message: "Still working", Provider: generator.Name()})
+		case <-ctx.Done():
+			log.Printf("❌ Client closed the email stream: %v", ctx.Err())
+			return
+		}
+	}
+
+	final := <-done
+	response := newEmailGenerationResponse(generator, prompt, final.result, final.err)
+	if final.err != nil {
+		log.Printf("❌ Error streaming email: %v", final.err)
+		send(STREAM_EVENT_ERROR, response)
+		return
+	}
+
+	log.Printf("✅ Successfully streamed email for %s", request.CompanyInfo)
+	send(STREAM_EVENT_RESULT, response)
+}
+
+// clearWriteDeadline lifts the server's WriteTimeout for one long-running
+// response, so short timeouts can stay in place for every other route.
+func clearWriteDeadline(c *gin.Context) {
+	if err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{}); err != nil {
+		log.Printf("⚠️ Could not clear write deadline for %s: %v", c.Request.URL.Path, err)
+	}
+}
+
+// readSSE calls fn for every event of a text/event-stream body until it ends,
+// fn returns an error or the reader fails.
+func readSSE(r io.Reader, fn func(event, data string) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+
+	var event string
+	var data []string
+	dispatch := func() error {
+		if len(data) == 0 {
+			event = ""
+			return nil
+		}
+		err := fn(event, strings.Join(data, "\n"))
+		event, data = "", nil
+		return err
+	}
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if err := dispatch(); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, ":"):
+			// comment / keep-alive
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return dispatch()
+}
+
+// partialJSONString decodes the value of a string field from possibly
+// incomplete JSON, returning whatever has been written so far. It is used to
+// show the subject and body while the model is still producing them.
+func partialJSONString(text, key string) string {
+	start := strings.Index(text, `"`+key+`"`)
+	if start < 0 {
+		return ""
+	}
+	rest := strings.TrimLeft(text[start+len(key)+2:], " \t\r\n")
+	if !strings.HasPrefix(rest, ":") {
+		return ""
+	}
+	rest = strings.TrimLeft(rest[1:], " \t\r\n")
+	if !strings.HasPrefix(rest, `"`) {
+		return ""
+	}
+	rest = rest[1:]
+
+	var value strings.Builder
+	for i := 0; i < len(rest); {
+		ch := rest[i]
+		switch {
+		case ch == '"':
+			return value.String()
+		case ch != '\\':
+			r, size := utf8.DecodeRuneInString(rest[i:])
+			value.WriteRune(r)
+			i += size
+			continue
+		case i+1 >= len(rest):
+			return value.String()
+		}
+
+		switch esc := rest[i+1]; esc {
+		case 'n':
+			value.WriteByte('\n')
+		case 't':
+			value.WriteByte('\t')
+		case 'r':
+			value.WriteByte('\r')
+		case 'b', 'f':
+		case 'u':
+			if i+6 > len(rest) {
+				return value.String()
+			}
+			code, err := strconv.ParseUint(rest[i+2:i+6], 16, 32)
+			if err != nil {
+				return value.String()
+			}
+			value.WriteRune(rune(code))
+			i += 6
+			continue
+		default:
+			value.WriteByte(esc)
+		}
+		i += 2
+	}
+	return value.String()
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"strings"
+	"unicode/utf8"
+)
+
+// StubGenerator writes a fixed-shape email from the request alone, with no
+// network access. The same input always produces the same output, which makes
+// it suitable for tests and offline demos.
+type StubGenerator struct{}
+
+// stubSentences fill the stub email up to the requested word count.
+var stubSentences = []string{
+	"Most of the teams we talk to lose whole days every sprint to flaky pipelines and manual release steps.",
+	"We usually start with a short review of your build and deploy setup and share what we would change first.",
+	"From there we work alongside your engineers, so the improvements stick after we step back.",
+	"Happy to share a couple of examples from companies at a similar stage if that is useful.",
+}
+
+func NewStubGenerator() *StubGenerator {
+	return &StubGenerator{}
+}
+
+func (g *StubGenerator) Name() string {
+	return GENERATOR_STUB
+}
+
+func (g *StubGenerator) Generate(ctx context.Context, prompt *EmailPrompt) (*EmailContent, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	variable := func(name, fallback string) string {
+		if value := strings.TrimSpace(prompt.Variables[name]); value != "" {
+			return value
+		}
+		return fallback
+	}
+
+	company := strings.TrimSpace(prompt.CompanyInfo)
+	firstName := strings.TrimSpace(prompt.PersonName)
+	if fields := strings.Fields(firstName); len(fields) > 0 {
+		firstName = fields[0]
+	}
+	firstName = variable("firstName", firstName)
+	sender := variable("senderCompany", "DevXworks")
+	calendarLink := variable("calendarLink", "https://calendly.com/ayush-devxworks/intro-call-with-ayush-devxworks")
+
+	subject := fmt.Sprintf("How %s can help %s ship faster", sender, company)
+	intro := fmt.Sprintf("<p>Hi %s,</p>"+
+		"<p>I came across <b>%s</b> and wanted to share a quick idea.</p>"+
+		"<p>At <b>%s</b> we help teams like yours:</p><ul>"+
+		"<li>cut release cycles by <b>30%%</b></li>"+
+		"<li>reduce cloud spend by <b>20%%</b></li>"+
+		"<li>free engineers from maintenance work</li></ul>",
+		html.EscapeString(firstName), html.EscapeString(company), html.EscapeString(sender))
+	outro := fmt.Sprintf("<p>Would you be open to a brief chat? <a href='%s'>schedule a call</a></p>", html.EscapeString(calendarLink))
+
+	// Pad to the requested length so the stub passes validation
+	var padding strings.Builder
+	if min, _, ok := wordRange(prompt.Variables["length"]); ok {
+		words := len(strings.Fields(plainText(intro + outro)))
+		for i := 0; words < min; i++ {
+			sentence := stubSentences[i%len(stubSentences)]
+			padding.WriteString("<p>" + sentence + "</p>")
+			words += len(strings.Fields(sentence))
+		}
+	}
+	body := intro + padding.String() + outro
+
+	return &EmailContent{
+		Subject: subject,
+		Body:    body,
+		Usage:   TokenUsage{Model: GENERATOR_STUB},
+	}, nil
+}
+
+// GenerateStream emits the stub email as the JSON a model would write, in
+// small chunks, so the streaming endpoint can be exercised offline.
+func (g *StubGenerator) GenerateStream(ctx context.Context, prompt *EmailPrompt, onDelta func(delta string)) (*EmailContent, error) {
+	content, err := g.Generate(ctx, prompt)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := json.Marshal(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal stub email: %v", err)
+	}
+
+	const chunkSize = 32
+	text := string(raw)
+	for len(text) > 0 {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		n := chunkSize
+		if n > len(text) {
+			n = len(text)
+		}
+		for n < len(text) && !utf8.RuneStart(text[n]) {
+			n++
+		}
+		onDelta(text[:n])
+		text = text[n:]
+	}
+	return content, nil
+}
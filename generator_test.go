@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseEmailContent(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		subject string
+		body    string
+	}{
+		{"plain object", `{"subject": "Hi", "body": "Hello"}`, "Hi", "Hello"},
+		{"code fence", "```json\n{\"subject\": \"Hi\", \"body\": \"Hello\"}\n```", "Hi", "Hello"},
+		{"prose around", `Here you go: {"subject": "Hi", "body": "Hello"} Thanks!`, "Hi", "Hello"},
+		{"trailing text", `{"subject": "Hi", "body": "Hello"} Let me know if you want changes.`, "Hi", "Hello"},
+		{"markdown bold", `{"subject": "**Hi**", "body": "Hello **there**"}`, "Hi", "Hello <b>there</b>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content, err := parseEmailContent("test", tt.content)
+			if err != nil {
+				t.Fatalf("parseEmailContent: %v", err)
+			}
+			if content.Subject != tt.subject || content.Body != tt.body {
+				t.Fatalf("got %q / %q, want %q / %q", content.Subject, content.Body, tt.subject, tt.body)
+			}
+		})
+	}
+}
+
+func TestParseEmailContentInvalid(t *testing.T) {
+	for _, content := range []string{
+		"Dear Jane, I hope this finds you well.",
+		`{"subject": "", "body": "Hello"}`,
+		`{"subject": "Hi"`,
+	} {
+		if _, err := parseEmailContent("test", content); !errors.Is(err, ErrInvalidOutput) {
+			t.Errorf("parseEmailContent(%q) error = %v, want ErrInvalidOutput", content, err)
+		}
+	}
+}
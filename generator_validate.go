@@ -0,0 +1,321 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// ErrInvalidOutput marks model output that could not be read as an email. It
+// is retried like a validation failure rather than reported as a provider error.
+var ErrInvalidOutput = errors.New("invalid model output")
+
+const (
+	subjectMinWords = 3
+	subjectMaxWords = 12
+	subjectMaxChars = 100
+)
+
+// emailOutputSchema is the JSON schema providers are asked to follow.
+var emailOutputSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"subject": map[string]interface{}{"type": "string", "description": "Email subject line, plain text"},
+		"body":    map[string]interface{}{"type": "string", "description": "Email body as HTML using only p, b, ul, li and a tags"},
+	},
+	"required":             []string{"subject", "body"},
+	"additionalProperties": false,
+}
+
+// GeneratedEmail is the outcome of generateEmail: the best email produced, how
+// many provider calls it took and the checks it still fails.
+type GeneratedEmail struct {
+	Content    *EmailContent
+	Attempts   int
+	Violations []string
+	// Usage adds up every attempt
+	Usage TokenUsage
+	// GenerationID identifies the audit record of a generation for a lead
+	GenerationID string
+}
+
+// generateEmail calls the generator until its output passes validateEmail or
+// generation.validation.maxAttempts is reached, feeding the violations back
+// into the prompt each time. onDelta, when set, streams output of generators
+// that support it; onRetry is called before every retry. The usage of all
+// attempts is recorded for the prompt's user and lead, and a generation for a
+// lead is recorded together with its prompt and context.
+func (s *CacheServer) generateEmail(ctx context.Context, generator EmailGenerator, prompt *EmailPrompt, onDelta func(string), onRetry func(attempt int, violations []string)) (best *GeneratedEmail, err error) {
+	maxAttempts := s.config.Generation.Validation.MaxAttempts
+	streamer, canStream := generator.(EmailStreamer)
+
+	usage := TokenUsage{Provider: generator.Name()}
+	defer func() {
+		if best != nil {
+			best.Usage = usage
+		}
+		s.recordUsage(prompt.User, prompt.Lead, usage)
+		if prompt.Lead != "" && usage.Calls > 0 {
+			id := s.recordGeneration(generator, prompt, best, usage, err)
+			if best != nil {
+				best.GenerationID = id
+			}
+		}
+	}()
+
+	attemptPrompt := prompt
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		var content *EmailContent
+		if onDelta != nil && canStream {
+			content, err = streamer.GenerateStream(ctx, attemptPrompt, onDelta)
+		} else {
+			content, err = generator.Generate(ctx, attemptPrompt)
+		}
+		if content != nil {
+			attemptUsage := content.Usage
+			attemptUsage.Calls = 1
+			s.priceUsage(&attemptUsage)
+			usage.Model = attemptUsage.Model
+			usage.add(attemptUsage)
+		}
+
+		var violations []string
+		switch {
+		case errors.Is(err, ErrInvalidOutput):
+			violations = []string{err.Error()}
+		case err != nil:
+			return best, err
+		default:
+			content.Subject = plainText(content.Subject)
+			content.Body = sanitizeEmailHTML(content.Body)
+			violations = s.validateEmail(content, prompt)
+			if best == nil || best.Content == nil || len(violations) < len(best.Violations) {
+				best = &GeneratedEmail{Content: content, Violations: violations}
+			}
+		}
+		if best == nil {
+			best = &GeneratedEmail{Violations: violations}
+		}
+		best.Attempts = attempt
+
+		if len(violations) == 0 {
+			return best, nil
+		}
+		log.Printf("⚠️ %s output failed validation (attempt %d/%d): %s", generator.Name(), attempt, maxAttempts, strings.Join(violations, "; "))
+		if attempt < maxAttempts {
+			if onRetry != nil {
+				onRetry(attempt+1, violations)
+			}
+			attemptPrompt = retryPrompt(prompt, violations)
+		}
+	}
+
+	if best.Content == nil {
+		return best, fmt.Errorf("no usable email after %d attempts: %s", best.Attempts, strings.Join(best.Violations, "; "))
+	}
+	return best, nil
+}
+
+// retryPrompt repeats the original instruction with the problems of the
+// previous answer.
+func retryPrompt(prompt *EmailPrompt, violations []string) *EmailPrompt {
+	retry := *prompt
+	retry.Text = prompt.Text + "\n\nYour previous answer was rejected because: " +
+		strings.Join(violations, "; ") +
+		". Write the email again, fixing these problems and following every instruction above."
+	return &retry
+}
+
+// validateEmail checks a sanitized email against the prompt's requirements
+// and returns one message per violation.
+func (s *CacheServer) validateEmail(content *EmailContent, prompt *EmailPrompt) []string {
+	var violations []string
+
+	subjectWords := len(strings.Fields(content.Subject))
+	switch {
+	case subjectWords == 0:
+		violations = append(violations, "subject is empty")
+	case subjectWords < subjectMinWords || subjectWords > subjectMaxWords:
+		violations = append(violations, fmt.Sprintf("subject has %d words, expected %d to %d", subjectWords, subjectMinWords, subjectMaxWords))
+	case len([]rune(content.Subject)) > subjectMaxChars:
+		violations = append(violations, fmt.Sprintf("subject is longer than %d characters", subjectMaxChars))
+	}
+
+	text := plainText(content.Body)
+	if min, max, ok := wordRange(prompt.Variables["length"]); ok {
+		tolerance := float64(s.config.Generation.Validation.WordTolerance) / 100
+		words := len(strings.Fields(text))
+		low := int(float64(min) * (1 - tolerance))
+		high := int(float64(max)*(1+tolerance) + 0.5)
+		if words < low || words > high {
+			violations = append(violations, fmt.Sprintf("body has %d words, expected %d to %d", words, min, max))
+		}
+	}
+
+	if !greetingPattern.MatchString(text) {
+		violations = append(violations, "body does not start with a greeting")
+	}
+
+	links := emailLinks(content.Body)
+	if calendarLink := strings.TrimSpace(prompt.Variables["calendarLink"]); calendarLink != "" {
+		if !containsString(links, calendarLink) {
+			violations = append(violations, fmt.Sprintf("body has no link to %s", calendarLink))
+		}
+	} else if len(links) == 0 {
+		violations = append(violations, "body has no link")
+	}
+
+	return violations
+}
+
+var (
+	greetingPattern  = regexp.MustCompile(`(?i)^\s*(hi|hello|hey|dear)\b`)
+	wordRangePattern = regexp.MustCompile(`(\d+)(?:\D+(\d+))?`)
+)
+
+// wordRange reads a word count such as "120 to 150" or "100" from the length
+// template variable.
+func wordRange(length string) (int, int, bool) {
+	match := wordRangePattern.FindStringSubmatch(length)
+	if match == nil {
+		return 0, 0, false
+	}
+	min, _ := strconv.Atoi(match[1])
+	max := min
+	if match[2] != "" {
+		max, _ = strconv.Atoi(match[2])
+	}
+	if max < min {
+		min, max = max, min
+	}
+	return min, max, max > 0
+}
+
+var (
+	// allowedEmailTags are kept by sanitizeEmailHTML; strong is renamed to b
+	allowedEmailTags = map[string]bool{"p": true, "b": true, "ul": true, "li": true, "a": true}
+	// droppedEmailTags are removed together with their content
+	droppedEmailTags = map[string]bool{"script": true, "style": true, "head": true, "title": true, "iframe": true, "object": true}
+	// emailTextEscaper re-escapes text without touching quotes, which are
+	// harmless outside attributes
+	emailTextEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+)
+
+// sanitizeEmailHTML keeps only p, b, ul, li and a (with an http, https or
+// mailto href) from a generated body. Other tags are removed but their text
+// stays, except for scripts and styles; <br> becomes a line break.
+func sanitizeEmailHTML(body string) string {
+	var out strings.Builder
+	skip := 0
+	z := html.NewTokenizer(strings.NewReader(body))
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			return strings.TrimSpace(out.String())
+		case html.TextToken:
+			if skip == 0 {
+				out.WriteString(emailTextEscaper.Replace(string(z.Text())))
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			tok := z.Token()
+			name := tok.Data
+			if droppedEmailTags[name] {
+				if tt == html.StartTagToken {
+					skip++
+				}
+				continue
+			}
+			if skip > 0 {
+				continue
+			}
+			if name == "strong" {
+				name = "b"
+			}
+			switch {
+			case name == "br":
+				out.WriteString("\n")
+			case name == "a":
+				out.WriteString("<a")
+				for _, attr := range tok.Attr {
+					if attr.Key == "href" && safeHref(attr.Val) {
+						out.WriteString(` href="` + html.EscapeString(attr.Val) + `"`)
+					}
+				}
+				out.WriteString(">")
+			case allowedEmailTags[name] && tt == html.StartTagToken:
+				out.WriteString("<" + name + ">")
+			}
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			tag := string(name)
+			if droppedEmailTags[tag] {
+				if skip > 0 {
+					skip--
+				}
+				continue
+			}
+			if tag == "strong" {
+				tag = "b"
+			}
+			if skip == 0 && allowedEmailTags[tag] {
+				out.WriteString("</" + tag + ">")
+			}
+		}
+	}
+}
+
+func safeHref(href string) bool {
+	u, err := url.Parse(strings.TrimSpace(href))
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https", "mailto":
+		return true
+	}
+	return false
+}
+
+// plainText returns the text of an HTML fragment with whitespace collapsed.
+func plainText(fragment string) string {
+	var parts []string
+	z := html.NewTokenizer(strings.NewReader(fragment))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return strings.Join(strings.Fields(strings.Join(parts, " ")), " ")
+		case html.TextToken:
+			parts = append(parts, string(z.Text()))
+		}
+	}
+}
+
+// emailLinks lists the hrefs of the links in an HTML fragment.
+func emailLinks(fragment string) []string {
+	var links []string
+	z := html.NewTokenizer(strings.NewReader(fragment))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return links
+		case html.StartTagToken:
+			tok := z.Token()
+			if tok.Data != "a" {
+				continue
+			}
+			for _, attr := range tok.Attr {
+				if attr.Key == "href" {
+					links = append(links, attr.Val)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const JOB_COLLECTION = "jobs"
+
+const (
+	JOB_STATUS_QUEUED    = "queued"
+	JOB_STATUS_RUNNING   = "running"
+	JOB_STATUS_COMPLETED = "completed"
+	JOB_STATUS_FAILED    = "failed"
+	JOB_STATUS_CANCELLED = "cancelled"
+
+	JOB_ITEM_PENDING = "pending"
+	JOB_ITEM_DONE    = "done"
+	JOB_ITEM_FAILED  = "failed"
+)
+
+// jobSaveInterval limits how often a running job's progress is written to the store.
+const jobSaveInterval = time.Second
+
+// Job is a unit of background work made of independent items, such as one
+// verification per email. Running jobs live in memory; every job is also saved
+// as a record so its outcome can be read after it finishes or the server restarts.
+type Job struct {
+	ID         string    `json:"id"`
+	Type       string    `json:"type"`
+	Status     string    `json:"status"`
+	CreatedAt  int64     `json:"createdAt"`
+	StartedAt  int64     `json:"startedAt,omitempty"`
+	FinishedAt int64     `json:"finishedAt,omitempty"`
+	Total      int       `json:"total"`
+	Done       int       `json:"done"`
+	Failed     int       `json:"failed"`
+	Progress   int       `json:"progress"`
+	Items      []JobItem `json:"items"`
+	Error      string    `json:"error,omitempty"`
+}
+
+type JobItem struct {
+	Key    string      `json:"key"`
+	Status string      `json:"status"`
+	Result interface{} `json:"result,omitempty"`
+	Error  string      `json:"error,omitempty"`
+}
+
+type JobResponse struct {
+	Success bool   `json:"success"`
+	Job     *Job   `json:"job,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// JobFunc processes one item of a job and returns what to record as its result.
+type JobFunc func(ctx context.Context, key string) (interface{}, error)
+
+// JobManager runs jobs in the background with a bounded number of items in
+// flight per job.
+type JobManager struct {
+	store   LeadStore
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+	running map[string]*Job
+}
+
+func NewJobManager(store LeadStore) *JobManager {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &JobManager{
+		store:   store,
+		ctx:     ctx,
+		cancel:  cancel,
+		running: make(map[string]*Job),
+	}
+}
+
+// Submit creates a job over keys and starts it. It returns a snapshot of the
+// queued job.
+func (m *JobManager) Submit(jobType string, keys []string, concurrency int, fn JobFunc) (*Job, error) {
+	job := &Job{
+		ID:        newID("job"),
+		Type:      jobType,
+		Status:    JOB_STATUS_QUEUED,
+		CreatedAt: time.Now().UnixMilli(),
+		Total:     len(keys),
+		Items:     make([]JobItem, len(keys)),
+	}
+	for i, key := range keys {
+		job.Items[i] = JobItem{Key: key, Status: JOB_ITEM_PENDING}
+	}
+	if err := m.save(job); err != nil {
+		return nil, fmt.Errorf("failed to save job: %v", err)
+	}
+
+	m.mu.Lock()
+	m.running[job.ID] = job
+	snapshot := job.snapshot()
+	m.mu.Unlock()
+
+	m.wg.Add(1)
+	go m.run(job, concurrency, fn)
+	return snapshot, nil
+}
+
+func (m *JobManager) run(job *Job, concurrency int, fn JobFunc) {
+	defer m.wg.Done()
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	m.mu.Lock()
+	job.Status = JOB_STATUS_RUNNING
+	job.StartedAt = time.Now().UnixMilli()
+	m.mu.Unlock()
+	log.Printf("🧵 Started %s job %s (%d items, concurrency %d)", job.Type, job.ID, job.Total, concurrency)
+
+	indexes := make(chan int)
+	var workers sync.WaitGroup
+	var lastSave time.Time
+	for w := 0; w < concurrency; w++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for i := range indexes {
+				result, err := fn(m.ctx, job.Items[i].Key)
+
+				m.mu.Lock()
+				item := &job.Items[i]
+				if err != nil {
+					item.Status = JOB_ITEM_FAILED
+					item.Error = err.Error()
+					job.Failed++
+				} else {
+					item.Status = JOB_ITEM_DONE
+					item.Result = result
+				}
+				job.Done++
+				job.Progress = job.Done * 100 / job.Total
+				var snapshot *Job
+				if time.Since(lastSave) >= jobSaveInterval {
+					lastSave = time.Now()
+					snapshot = job.snapshot()
+				}
+				m.mu.Unlock()
+
+				if snapshot != nil {
+					if err := m.save(snapshot); err != nil {
+						log.Printf("⚠️ Failed to save progress of job %s: %v", job.ID, err)
+					}
+				}
+			}
+		}()
+	}
+
+	for i := range job.Items {
+		if m.ctx.Err() != nil {
+			break
+		}
+		select {
+		case indexes <- i:
+		case <-m.ctx.Done():
+		}
+	}
+	close(indexes)
+	workers.Wait()
+
+	m.mu.Lock()
+	switch {
+	case m.ctx.Err() != nil && job.Done < job.Total:
+		job.Status = JOB_STATUS_CANCELLED
+		job.Error = "server shut down before the job finished"
+	case job.Total > 0 && job.Failed == job.Total:
+		job.Status = JOB_STATUS_FAILED
+		job.Error = "every item failed"
+	default:
+		job.Status = JOB_STATUS_COMPLETED
+	}
+	job.FinishedAt = time.Now().UnixMilli()
+	if job.Total == 0 {
+		job.Progress = 100
+	}
+	snapshot := job.snapshot()
+	delete(m.running, job.ID)
+	m.mu.Unlock()
+
+	if err := m.save(snapshot); err != nil {
+		log.Printf("❌ Failed to save finished job %s: %v", job.ID, err)
+	}
+	log.Printf("🏁 Job %s %s: %d/%d done, %d failed", job.ID, job.Status, job.Done, job.Total, job.Failed)
+}
+
+// Get returns a running job from memory, or a finished one from the store.
+func (m *JobManager) Get(id string) (*Job, error) {
+	m.mu.Lock()
+	if job, ok := m.running[id]; ok {
+		snapshot := job.snapshot()
+		m.mu.Unlock()
+		return snapshot, nil
+	}
+	m.mu.Unlock()
+
+	var job Job
+	if err := getRecordJSON(m.ctx, m.store, JOB_COLLECTION, id, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// Shutdown stops handing out new items and waits for in-flight ones, so every
+// job is saved before the store is closed.
+func (m *JobManager) Shutdown(ctx context.Context) {
+	m.cancel()
+	done := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Printf("⚠️ Background jobs did not stop before the shutdown timeout")
+	}
+}
+
+func (m *JobManager) save(job *Job) error {
+	// Saving must still work while shutting down, when m.ctx is already cancelled
+	return putRecordJSON(context.Background(), m.store, JOB_COLLECTION, job.ID, job)
+}
+
+// snapshot copies the job so it can be encoded without holding the lock.
+func (j *Job) snapshot() *Job {
+	out := *j
+	out.Items = append([]JobItem(nil), j.Items...)
+	return &out
+}
+
+func (s *CacheServer) getJob(c *gin.Context) {
+	id := c.Param("id")
+	job, err := s.jobs.Get(id)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			c.JSON(http.StatusNotFound, JobResponse{
+				Success: false,
+				Error:   fmt.Sprintf("Job %s not found", id),
+			})
+			return
+		}
+		log.Printf("Error loading job %s: %v", id, err)
+		c.JSON(http.StatusInternalServerError, JobResponse{
+			Success: false,
+			Error:   "Failed to load job",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, JobResponse{
+		Success: true,
+		Job:     job,
+	})
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Email statuses as returned by the verifier and rendered by the sidebar.
+const (
+	EMAIL_STATUS_VALID      = "valid"
+	EMAIL_STATUS_INVALID    = "invalid"
+	EMAIL_STATUS_CATCHALL   = "catchall"
+	EMAIL_STATUS_DISPOSABLE = "disposable"
+	EMAIL_STATUS_UNKNOWN    = "unknown"
+)
+
+var validEmailStatuses = []string{
+	EMAIL_STATUS_VALID,
+	EMAIL_STATUS_INVALID,
+	EMAIL_STATUS_CATCHALL,
+	EMAIL_STATUS_DISPOSABLE,
+	EMAIL_STATUS_UNKNOWN,
+}
+
+const (
+	maxLeadFieldLength = 512
+	// maxLeadTextLength bounds the free-text fields (profileSnippet, notes).
+	maxLeadTextLength = 4000
+)
+
+// Lead is the typed form of the leadData blob the sidebar stores for every
+// verified address. Field names on the wire match what the extension sends.
+type Lead struct {
+	FirstName   string `json:"firstName"`
+	LastName    string `json:"lastName"`
+	Title       string `json:"title,omitempty"`
+	CompanyName string `json:"companyName"`
+	Domain      string `json:"domain"`
+	Email       string `json:"email"`
+	EmailStatus string `json:"emailStatus,omitempty"`
+	List        string `json:"listLeadBelongsTo,omitempty"`
+	Exported    bool   `json:"exported,omitempty"`
+	ExportedAt  int64  `json:"exportedAt,omitempty"`
+	VerifiedAt  int64  `json:"verifiedAt,omitempty"`
+	SourceURL   string `json:"sourceUrl,omitempty"`
+	// ProfileSnippet is the headline or about text of the LinkedIn profile.
+	ProfileSnippet string                 `json:"profileSnippet,omitempty"`
+	Notes          string                 `json:"notes,omitempty"`
+	CustomFields   map[string]interface{} `json:"customFields,omitempty"`
+	// topLevel names the custom fields that were read from unknown top-level
+	// keys. They are written back there, where the Python scripts read them.
+	topLevel map[string]bool
+}
+
+// leadFieldAliases maps every accepted JSON key to the canonical field name.
+var leadFieldAliases = map[string]string{
+	"firstName":         "firstName",
+	"lastName":          "lastName",
+	"title":             "title",
+	"jobTitle":          "title",
+	"position":          "title",
+	"companyName":       "companyName",
+	"company":           "companyName",
+	"domain":            "domain",
+	"email":             "email",
+	"emailStatus":       "emailStatus",
+	"status":            "emailStatus",
+	"listLeadBelongsTo": "list",
+	"list":              "list",
+	"exported":          "exported",
+	"exportedAt":        "exportedAt",
+	"verifiedAt":        "verifiedAt",
+	"sourceUrl":         "sourceUrl",
+	"sourceURL":         "sourceUrl",
+	"profileUrl":        "sourceUrl",
+	"profileSnippet":    "profileSnippet",
+	"headline":          "profileSnippet",
+	"about":             "profileSnippet",
+	"notes":             "notes",
+	"customFields":      "customFields",
+}
+
+// UnmarshalJSON accepts the loosely typed blobs written by older clients and the
+// Python scripts: alternate key names, numbers or booleans stored as strings,
+// and any unknown keys, which are kept in CustomFields. A key found both at the
+// top level and under customFields takes the nested value.
+func (l *Lead) UnmarshalJSON(data []byte) error {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	*l = Lead{}
+	for key, value := range raw {
+		field, known := leadFieldAliases[key]
+		if !known {
+			if _, nested := l.CustomFields[key]; !nested {
+				l.setCustomField(key, value)
+				l.setTopLevel(key, true)
+			}
+			continue
+		}
+
+		switch field {
+		case "firstName":
+			l.FirstName = looseString(value)
+		case "lastName":
+			l.LastName = looseString(value)
+		case "title":
+			l.Title = looseString(value)
+		case "companyName":
+			l.CompanyName = looseString(value)
+		case "domain":
+			l.Domain = looseString(value)
+		case "email":
+			l.Email = looseString(value)
+		case "emailStatus":
+			l.EmailStatus = looseString(value)
+		case "list":
+			l.List = looseString(value)
+		case "exported":
+			l.Exported = looseBool(value)
+		case "exportedAt":
+			l.ExportedAt = looseInt(value)
+		case "verifiedAt":
+			l.VerifiedAt = looseInt(value)
+		case "sourceUrl":
+			l.SourceURL = looseString(value)
+		case "profileSnippet":
+			l.ProfileSnippet = looseString(value)
+		case "notes":
+			l.Notes = looseString(value)
+		case "customFields":
+			if fields, ok := value.(map[string]interface{}); ok {
+				for k, v := range fields {
+					l.setCustomField(k, v)
+					l.setTopLevel(k, false)
+				}
+			}
+		}
+	}
+
+	l.Email = strings.ToLower(strings.TrimSpace(l.Email))
+	l.EmailStatus = strings.ToLower(strings.TrimSpace(l.EmailStatus))
+	return nil
+}
+
+func (l *Lead) setCustomField(key string, value interface{}) {
+	if l.CustomFields == nil {
+		l.CustomFields = make(map[string]interface{})
+	}
+	l.CustomFields[key] = value
+}
+
+func (l *Lead) setTopLevel(key string, topLevel bool) {
+	if !topLevel {
+		delete(l.topLevel, key)
+		if len(l.topLevel) == 0 {
+			l.topLevel = nil
+		}
+		return
+	}
+	if l.topLevel == nil {
+		l.topLevel = make(map[string]bool)
+	}
+	l.topLevel[key] = true
+}
+
+// MarshalJSON writes the custom fields read from unknown top-level keys back at
+// the top level, so saving a legacy blob again keeps its layout. Alternate key
+// names are still written under their canonical name.
+func (l Lead) MarshalJSON() ([]byte, error) {
+	type lead Lead
+	if len(l.topLevel) == 0 {
+		return json.Marshal(lead(l))
+	}
+
+	nested := lead(l)
+	nested.CustomFields = make(map[string]interface{}, len(l.CustomFields))
+	for key, value := range l.CustomFields {
+		if !l.topLevel[key] {
+			nested.CustomFields[key] = value
+		}
+	}
+	raw, err := json.Marshal(nested)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, err
+	}
+	for key := range l.topLevel {
+		value, exists := l.CustomFields[key]
+		if !exists {
+			continue
+		}
+		if fields[key], err = json.Marshal(value); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(fields)
+}
+
+// Validate checks a lead submitted for the given cache key.
+func (l *Lead) Validate(email string) error {
+	var errs []string
+
+	if l.Email != "" && l.Email != email {
+		errs = append(errs, fmt.Sprintf("email %q does not match %q", l.Email, email))
+	}
+	if l.EmailStatus != "" && !containsString(validEmailStatuses, l.EmailStatus) {
+		errs = append(errs, fmt.Sprintf("emailStatus %q must be one of %s", l.EmailStatus, strings.Join(validEmailStatuses, ", ")))
+	}
+	for name, value := range map[string]string{
+		"firstName":         l.FirstName,
+		"lastName":          l.LastName,
+		"title":             l.Title,
+		"companyName":       l.CompanyName,
+		"domain":            l.Domain,
+		"listLeadBelongsTo": l.List,
+		"sourceUrl":         l.SourceURL,
+	} {
+		if len(value) > maxLeadFieldLength {
+			errs = append(errs, fmt.Sprintf("%s is longer than %d characters", name, maxLeadFieldLength))
+		}
+	}
+	for name, value := range map[string]string{
+		"profileSnippet": l.ProfileSnippet,
+		"notes":          l.Notes,
+	} {
+		if len(value) > maxLeadTextLength {
+			errs = append(errs, fmt.Sprintf("%s is longer than %d characters", name, maxLeadTextLength))
+		}
+	}
+	if l.SourceURL != "" && !strings.HasPrefix(l.SourceURL, "http://") && !strings.HasPrefix(l.SourceURL, "https://") {
+		errs = append(errs, "sourceUrl must be an http(s) URL")
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// EmailDomain returns the part of the lead's email after the @.
+func (l *Lead) EmailDomain() string {
+	if at := strings.LastIndex(l.Email, "@"); at >= 0 {
+		return l.Email[at+1:]
+	}
+	return l.Domain
+}
+
+// MarkExported flags the lead as exported now.
+func (l *Lead) MarkExported() {
+	l.Exported = true
+	l.ExportedAt = time.Now().UnixMilli()
+}
+
+// setExported updates both the lead and the legacy root-level flag.
+func setExported(data *CachedData, exported bool) {
+	if exported {
+		data.LeadData.MarkExported()
+	} else {
+		data.LeadData.Exported = false
+		data.LeadData.ExportedAt = 0
+	}
+	data.Exported = exported
+}
+
+// validateEmailAddress checks an address is syntactically usable as a cache key.
+func validateEmailAddress(email string) error {
+	if email == "" {
+		return fmt.Errorf("email is required")
+	}
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email || !strings.Contains(email, "@") {
+		return fmt.Errorf("%q is not a valid email address", email)
+	}
+	return nil
+}
+
+// UnmarshalJSON keeps reading the root-level "exported" flag that the Python
+// exporter writes next to leadData.
+func (d *CachedData) UnmarshalJSON(data []byte) error {
+	type cachedData CachedData
+	var decoded cachedData
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	*d = CachedData(decoded)
+	if d.Exported {
+		d.LeadData.Exported = true
+	}
+	if d.LeadData.Email == "" {
+		d.LeadData.Email = d.Email
+	}
+	return nil
+}
+
+// MarshalJSON mirrors the lead's exported flag to the root for older readers.
+func (d CachedData) MarshalJSON() ([]byte, error) {
+	type cachedData CachedData
+	d.Exported = d.LeadData.Exported
+	return json.Marshal(cachedData(d))
+}
+
+func looseString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return strings.TrimSpace(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+func looseBool(value interface{}) bool {
+	switch v := value.(type) {
+	case bool:
+		return v
+	case string:
+		b, _ := strconv.ParseBool(strings.TrimSpace(v))
+		return b
+	case float64:
+		return v != 0
+	default:
+		return false
+	}
+}
+
+func looseInt(value interface{}) int64 {
+	switch v := value.(type) {
+	case float64:
+		return int64(v)
+	case string:
+		if n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64); err == nil {
+			return n
+		}
+		if t, err := time.Parse(time.RFC3339, strings.TrimSpace(v)); err == nil {
+			return t.UnixMilli()
+		}
+	}
+	return 0
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const GENERATION_COLLECTION = "generations"
+
+// LeadContext is what is already known about the recipient of an email: the
+// stored lead and the profile of their company. It is added to the prompt and
+// saved with the generation so an email can be traced back to its inputs.
+type LeadContext struct {
+	Email          string          `json:"email"`
+	FirstName      string          `json:"firstName,omitempty"`
+	LastName       string          `json:"lastName,omitempty"`
+	Title          string          `json:"title,omitempty"`
+	CompanyName    string          `json:"companyName,omitempty"`
+	Domain         string          `json:"domain,omitempty"`
+	List           string          `json:"list,omitempty"`
+	ProfileURL     string          `json:"profileUrl,omitempty"`
+	ProfileSnippet string          `json:"profileSnippet,omitempty"`
+	Notes          string          `json:"notes,omitempty"`
+	Company        *CompanyProfile `json:"company,omitempty"`
+}
+
+// GenerationRecord is the audit trail of one generation for a lead: the
+// prompt and context it was given and the email it produced.
+type GenerationRecord struct {
+	ID              string       `json:"id"`
+	Email           string       `json:"email"`
+	User            string       `json:"user,omitempty"`
+	Provider        string       `json:"provider"`
+	TemplateID      string       `json:"templateId"`
+	TemplateVersion int          `json:"templateVersion"`
+	Prompt          string       `json:"prompt"`
+	Context         *LeadContext `json:"context,omitempty"`
+	Subject         string       `json:"subject,omitempty"`
+	Body            string       `json:"body,omitempty"`
+	Attempts        int          `json:"attempts"`
+	Violations      []string     `json:"violations,omitempty"`
+	Usage           TokenUsage   `json:"usage"`
+	Error           string       `json:"error,omitempty"`
+	CreatedAt       int64        `json:"createdAt"`
+}
+
+type GenerationRecordsResponse struct {
+	Success     bool                `json:"success"`
+	Generations []*GenerationRecord `json:"generations,omitempty"`
+	Generation  *GenerationRecord   `json:"generation,omitempty"`
+	Error       string              `json:"error,omitempty"`
+}
+
+// leadContext gathers the stored lead and company profile for email. A lead
+// that is not stored still gets the profile of its address's domain. Lookup
+// failures are logged and leave the context out rather than failing generation.
+func (s *CacheServer) leadContext(ctx context.Context, email string) *LeadContext {
+	leadContext := &LeadContext{Email: email}
+	cached, err := s.store.GetLead(ctx, email)
+	switch {
+	case err == nil:
+		lead := cached.LeadData
+		leadContext.FirstName = lead.FirstName
+		leadContext.LastName = lead.LastName
+		leadContext.Title = lead.Title
+		leadContext.CompanyName = lead.CompanyName
+		leadContext.Domain = lead.Domain
+		leadContext.List = lead.List
+		leadContext.ProfileURL = lead.SourceURL
+		leadContext.ProfileSnippet = lead.ProfileSnippet
+		leadContext.Notes = lead.Notes
+	case !errors.Is(err, ErrNotFound):
+		log.Printf("⚠️ Could not read lead %s for email context: %v", email, err)
+	}
+
+	domain := leadContext.Domain
+	if domain == "" {
+		if at := strings.LastIndex(email, "@"); at >= 0 {
+			domain = email[at+1:]
+		}
+	}
+	if domain, err := normalizeDomain(domain); err == nil {
+		company, err := s.companyProfile(ctx, domain)
+		if err != nil {
+			log.Printf("⚠️ Could not read company profile of %s for email context: %v", domain, err)
+		}
+		leadContext.Company = company
+	}
+	return leadContext
+}
+
+// personName is the lead's full name as stored.
+func (l *LeadContext) personName() string {
+	return strings.TrimSpace(l.FirstName + " " + l.LastName)
+}
+
+// companyName is the stored company name, else the one from the profile.
+func (l *LeadContext) companyName() string {
+	if l.CompanyName != "" {
+		return l.CompanyName
+	}
+	if l.Company != nil {
+		return l.Company.Name
+	}
+	return ""
+}
+
+// promptText renders the context as a prompt section; empty when nothing is known.
+func (l *LeadContext) promptText() string {
+	var lines []string
+	add := func(label, value string) {
+		if value = strings.TrimSpace(value); value != "" {
+			lines = append(lines, fmt.Sprintf("- %s: %s", label, value))
+		}
+	}
+
+	add("Name", l.personName())
+	add("Title", l.Title)
+	add("Company", l.CompanyName)
+	add("Company domain", l.Domain)
+	add("Lead list", l.List)
+	add("LinkedIn profile", l.ProfileURL)
+	add("LinkedIn headline/about", l.ProfileSnippet)
+	add("Notes from our team", l.Notes)
+	if company := l.Company; company != nil {
+		add("Company name (from "+company.Domain+")", company.Name)
+		add("Company description", company.Description)
+		add("Industry", company.Industry)
+		add("Company size", company.Size)
+		add("Location", company.Location)
+		add("Notes about the company", company.Notes)
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return "What we already know about the recipient (use it, prefer it over web search results and do not contradict it):\n" +
+		strings.Join(lines, "\n")
+}
+
+// leadContextVariableNames are the template variables variables() sets. They
+// are always defined, empty when the lead or company is unknown.
+var leadContextVariableNames = []string{
+	"title", "domain", "list", "profileUrl", "profileSnippet", "notes", "leadContext", "companyDescription",
+}
+
+// variables exposes the context to prompt templates.
+func (l *LeadContext) variables() map[string]string {
+	variables := map[string]string{
+		"title":              l.Title,
+		"domain":             l.Domain,
+		"list":               l.List,
+		"profileUrl":         l.ProfileURL,
+		"profileSnippet":     l.ProfileSnippet,
+		"notes":              l.Notes,
+		"leadContext":        l.promptText(),
+		"companyDescription": "",
+	}
+	if l.Company != nil {
+		variables["companyDescription"] = l.Company.Description
+	}
+	return variables
+}
+
+// recordGeneration saves the audit record of a generation for a lead and
+// returns its id.
+func (s *CacheServer) recordGeneration(generator EmailGenerator, prompt *EmailPrompt, result *GeneratedEmail, usage TokenUsage, genErr error) string {
+	record := &GenerationRecord{
+		ID:              newID("gen"),
+		Email:           prompt.Lead,
+		User:            prompt.User,
+		Provider:        generator.Name(),
+		TemplateID:      prompt.TemplateID,
+		TemplateVersion: prompt.TemplateVersion,
+		Prompt:          prompt.Text,
+		Context:         prompt.Context,
+		Usage:           usage,
+		CreatedAt:       time.Now().UnixMilli(),
+	}
+	if result != nil {
+		record.Attempts = result.Attempts
+		record.Violations = result.Violations
+		if result.Content != nil {
+			record.Subject = result.Content.Subject
+			record.Body = result.Content.Body
+		}
+	}
+	if genErr != nil {
+		record.Error = genErr.Error()
+	}
+	if err := putRecordJSON(s.ctx, s.store, GENERATION_COLLECTION, record.ID, record); err != nil {
+		log.Printf("⚠️ Failed to record generation for %s: %v", prompt.Lead, err)
+		return ""
+	}
+	return record.ID
+}
+
+// listGenerations returns the recorded generations, newest first, optionally
+// only those for ?email= and at most ?limit= (default 50).
+func (s *CacheServer) listGenerations(c *gin.Context) {
+	email := strings.ToLower(strings.TrimSpace(c.Query("email")))
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 {
+		c.JSON(http.StatusBadRequest, GenerationRecordsResponse{
+			Success: false,
+			Error:   "limit must be a positive number",
+		})
+		return
+	}
+
+	records, err := s.store.ListRecords(s.ctx, GENERATION_COLLECTION)
+	if err != nil {
+		log.Printf("Error listing generations: %v", err)
+		c.JSON(http.StatusInternalServerError, GenerationRecordsResponse{
+			Success: false,
+			Error:   "Failed to list generations",
+		})
+		return
+	}
+
+	generations := make([]*GenerationRecord, 0, len(records))
+	for _, raw := range records {
+		var record GenerationRecord
+		if err := json.Unmarshal(raw, &record); err != nil {
+			continue
+		}
+		if email != "" && record.Email != email {
+			continue
+		}
+		generations = append(generations, &record)
+	}
+	sort.Slice(generations, func(i, j int) bool { return generations[i].CreatedAt > generations[j].CreatedAt })
+	if len(generations) > limit {
+		generations = generations[:limit]
+	}
+
+	c.JSON(http.StatusOK, GenerationRecordsResponse{
+		Success:     true,
+		Generations: generations,
+	})
+}
+
+func (s *CacheServer) getGeneration(c *gin.Context) {
+	var record GenerationRecord
+	if err := getRecordJSON(s.ctx, s.store, GENERATION_COLLECTION, c.Param("id"), &record); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			c.JSON(http.StatusNotFound, GenerationRecordsResponse{
+				Success: false,
+				Error:   "Generation not found",
+			})
+			return
+		}
+		log.Printf("Error loading generation %s: %v", c.Param("id"), err)
+		c.JSON(http.StatusInternalServerError, GenerationRecordsResponse{
+			Success: false,
+			Error:   "Failed to load generation",
+		})
+		return
+	}
+	c.JSON(http.StatusOK, GenerationRecordsResponse{
+		Success:    true,
+		Generation: &record,
+	})
+}
@@ -0,0 +1,49 @@
+package main
+
+import "sync"
+
+// leadLocks serializes the read-modify-write of a single lead, so two saves of
+// the same address cannot both start from the same stored value. Each lock
+// lives only while someone holds or waits for it.
+type leadLocks struct {
+	mu    sync.Mutex
+	locks map[string]*leadLock
+}
+
+type leadLock struct {
+	sync.Mutex
+	holders int
+}
+
+func newLeadLocks() *leadLocks {
+	return &leadLocks{locks: make(map[string]*leadLock)}
+}
+
+// lock blocks until key is free and returns the function that frees it.
+func (l *leadLocks) lock(key string) (unlock func()) {
+	l.mu.Lock()
+	lock, exists := l.locks[key]
+	if !exists {
+		lock = &leadLock{}
+		l.locks[key] = lock
+	}
+	lock.holders++
+	l.mu.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+		l.mu.Lock()
+		lock.holders--
+		if lock.holders == 0 {
+			delete(l.locks, key)
+		}
+		l.mu.Unlock()
+	}
+}
+
+// lockLead locks one lead of the server's workspace; the locks are shared by
+// every workspace, so the key carries the workspace name.
+func (s *CacheServer) lockLead(email string) (unlock func()) {
+	return s.leadLocks.lock(s.workspace + "\x00" + email)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestLeadRoundTripKeepsLegacyLayout(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		blob string
+		// top holds the keys expected at the top level of the re-encoded lead,
+		// nested those expected under customFields (nil when it is absent)
+		top    map[string]interface{}
+		nested map[string]interface{}
+	}{
+		{
+			name: "unknown keys written by the Python scripts",
+			blob: `{"firstName":"Jane","email":"Jane@Acme.com","linkedinId":"abc","score":7}`,
+			top:  map[string]interface{}{"firstName": "Jane", "email": "jane@acme.com", "linkedinId": "abc", "score": 7.0},
+		},
+		{
+			name:   "custom fields sent nested",
+			blob:   `{"firstName":"Jane","customFields":{"segment":"smb"}}`,
+			top:    map[string]interface{}{"firstName": "Jane"},
+			nested: map[string]interface{}{"segment": "smb"},
+		},
+		{
+			name:   "both layouts in one blob",
+			blob:   `{"linkedinId":"abc","customFields":{"segment":"smb"}}`,
+			top:    map[string]interface{}{"linkedinId": "abc"},
+			nested: map[string]interface{}{"segment": "smb"},
+		},
+		{
+			name:   "nested value wins over the same top-level key",
+			blob:   `{"segment":"old","customFields":{"segment":"smb"}}`,
+			nested: map[string]interface{}{"segment": "smb"},
+		},
+		{
+			name: "alternate names are written canonically",
+			blob: `{"company":"Acme","status":"VALID","list":"q1","exported":"true","rowId":"12"}`,
+			top: map[string]interface{}{
+				"companyName":       "Acme",
+				"emailStatus":       "valid",
+				"listLeadBelongsTo": "q1",
+				"exported":          true,
+				"rowId":             "12",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var lead Lead
+			if err := json.Unmarshal([]byte(tc.blob), &lead); err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+			encoded, err := json.Marshal(lead)
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			var got map[string]interface{}
+			if err := json.Unmarshal(encoded, &got); err != nil {
+				t.Fatalf("decode %s: %v", encoded, err)
+			}
+
+			for key, want := range tc.top {
+				if !reflect.DeepEqual(got[key], want) {
+					t.Errorf("%s = %#v, want %#v in %s", key, got[key], want, encoded)
+				}
+			}
+			nested, _ := got["customFields"].(map[string]interface{})
+			if !reflect.DeepEqual(nested, tc.nested) {
+				t.Errorf("customFields = %#v, want %#v in %s", nested, tc.nested, encoded)
+			}
+			for key := range tc.nested {
+				if _, duplicated := got[key]; duplicated {
+					t.Errorf("%s written at the top level as well: %s", key, encoded)
+				}
+			}
+
+			// Reading the result again gives the same lead
+			var again Lead
+			if err := json.Unmarshal(encoded, &again); err != nil {
+				t.Fatalf("Unmarshal again: %v", err)
+			}
+			if !reflect.DeepEqual(again, lead) {
+				t.Errorf("second round trip = %+v, want %+v", again, lead)
+			}
+		})
+	}
+}
+
+func TestCachedDataKeepsLegacyLeadKeys(t *testing.T) {
+	blob := `{"email":"jane@acme.com","exported":true,"timestamp":1,"leadData":{"firstName":"Jane","linkedinId":"abc"}}`
+	var data CachedData
+	if err := json.Unmarshal([]byte(blob), &data); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if !data.LeadData.Exported || data.LeadData.Email != "jane@acme.com" || data.LeadData.CustomFields["linkedinId"] != "abc" {
+		t.Fatalf("decoded lead = %+v", data.LeadData)
+	}
+
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	var got struct {
+		Exported bool                   `json:"exported"`
+		LeadData map[string]interface{} `json:"leadData"`
+	}
+	if err := json.Unmarshal(encoded, &got); err != nil {
+		t.Fatalf("decode %s: %v", encoded, err)
+	}
+	if !got.Exported || got.LeadData["linkedinId"] != "abc" || got.LeadData["customFields"] != nil {
+		t.Fatalf("re-encoded blob = %s", encoded)
+	}
+}
+
+func TestMergeLeadKeepsFieldPlacement(t *testing.T) {
+	var base, update Lead
+	if err := json.Unmarshal([]byte(`{"linkedinId":"abc","segment":"old"}`), &base); err != nil {
+		t.Fatalf("Unmarshal base: %v", err)
+	}
+	if err := json.Unmarshal([]byte(`{"customFields":{"segment":"smb"},"rowId":"12"}`), &update); err != nil {
+		t.Fatalf("Unmarshal update: %v", err)
+	}
+
+	encoded, err := json.Marshal(mergeLead(base, update))
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(encoded, &got); err != nil {
+		t.Fatalf("decode %s: %v", encoded, err)
+	}
+	nested, _ := got["customFields"].(map[string]interface{})
+	if got["linkedinId"] != "abc" || got["rowId"] != "12" || got["segment"] != nil || nested["segment"] != "smb" {
+		t.Fatalf("merged lead = %s", encoded)
+	}
+}
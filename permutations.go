@@ -0,0 +1,309 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// EmailPattern builds a local part from a normalized first and last name.
+type EmailPattern struct {
+	Name  string
+	Build func(first, last string) string
+}
+
+// emailPatterns are ordered from most to least common in B2B addresses; the
+// order is the ranking used when nothing is known about a domain.
+var emailPatterns = []EmailPattern{
+	{"first.last", func(f, l string) string { return f + "." + l }},
+	{"first", func(f, l string) string { return f }},
+	{"flast", func(f, l string) string { return initial(f) + l }},
+	{"firstlast", func(f, l string) string { return f + l }},
+	{"f.last", func(f, l string) string { return initial(f) + "." + l }},
+	{"first_last", func(f, l string) string { return f + "_" + l }},
+	{"firstl", func(f, l string) string { return f + initial(l) }},
+	{"first.l", func(f, l string) string { return f + "." + initial(l) }},
+	{"first_l", func(f, l string) string { return f + "_" + initial(l) }},
+	{"first-last", func(f, l string) string { return f + "-" + l }},
+	{"last.first", func(f, l string) string { return l + "." + f }},
+	{"lastfirst", func(f, l string) string { return l + f }},
+	{"last_first", func(f, l string) string { return l + "_" + f }},
+	{"lastf", func(f, l string) string { return l + initial(f) }},
+	{"last.f", func(f, l string) string { return l + "." + initial(f) }},
+	{"last", func(f, l string) string { return l }},
+	{"fl", func(f, l string) string { return initial(f) + initial(l) }},
+	{"f.l", func(f, l string) string { return initial(f) + "." + initial(l) }},
+}
+
+func initial(name string) string {
+	for _, r := range name {
+		return string(r)
+	}
+	return ""
+}
+
+type PermutationRequest struct {
+	// Name is the full name; FirstName/LastName take precedence when given.
+	Name      string `json:"name"`
+	FirstName string `json:"firstName"`
+	LastName  string `json:"lastName"`
+	Domain    string `json:"domain"`
+	// Limit caps the number of candidates returned. Defaults to 10.
+	Limit int `json:"limit"`
+}
+
+type PermutationCandidate struct {
+	Email   string `json:"email"`
+	Pattern string `json:"pattern"`
+	Score   int    `json:"score"`
+	// ProvenValid and ProvenInvalid count verified leads at the domain that
+	// use this pattern.
+	ProvenValid   int `json:"provenValid,omitempty"`
+	ProvenInvalid int `json:"provenInvalid,omitempty"`
+	// Unlikely is set when the domain is known to use another pattern, so
+	// verifying this candidate can be skipped.
+	Unlikely bool `json:"unlikely,omitempty"`
+	// Status is the cached verification status of this exact address, if any.
+	Status string `json:"status,omitempty"`
+}
+
+type PermutationResponse struct {
+	Success    bool                   `json:"success"`
+	Domain     string                 `json:"domain,omitempty"`
+	FirstName  string                 `json:"firstName,omitempty"`
+	LastName   string                 `json:"lastName,omitempty"`
+	Pattern    string                 `json:"pattern,omitempty"`
+	Confidence float64                `json:"confidence,omitempty"`
+	Candidates []PermutationCandidate `json:"candidates,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+}
+
+// nameSpecialCases covers letters that do not decompose into a base letter
+// plus accents.
+var nameSpecialCases = strings.NewReplacer(
+	"ß", "ss", "æ", "ae", "ø", "o", "œ", "oe", "ł", "l", "đ", "d", "ð", "d", "þ", "th", "ı", "i",
+)
+
+// normalizeNamePart lowercases a name, strips accents and drops everything
+// but letters, digits and hyphens ("José-María" becomes "jose-maria").
+func normalizeNamePart(name string) string {
+	stripAccents := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	folded, _, err := transform.String(stripAccents, strings.ToLower(strings.TrimSpace(name)))
+	if err != nil {
+		folded = strings.ToLower(name)
+	}
+	folded = nameSpecialCases.Replace(folded)
+
+	var b strings.Builder
+	for _, r := range folded {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r == '-' || unicode.IsSpace(r):
+			b.WriteRune('-')
+		}
+	}
+	return strings.Trim(b.String(), "-")
+}
+
+// nameVariants returns the ways a possibly compound name shows up in local
+// parts, most likely first: joined ("jeanluc"), the first part only, for
+// surnames also the last part ("van der berg" as "berg"), and hyphenated.
+func nameVariants(name string, isFirst bool) []string {
+	normalized := normalizeNamePart(name)
+	parts := strings.FieldsFunc(normalized, func(r rune) bool { return r == '-' })
+	if len(parts) == 0 {
+		return nil
+	}
+
+	variants := []string{strings.Join(parts, "")}
+	if len(parts) > 1 {
+		variants = append(variants, parts[0])
+		if !isFirst {
+			variants = append(variants, parts[len(parts)-1])
+		}
+		variants = append(variants, strings.Join(parts, "-"))
+	}
+	return variants
+}
+
+// splitFullName splits "Jean-Luc van der Berg" into first and last names: the
+// first word is the first name and the rest is the surname.
+func splitFullName(name string) (string, string) {
+	words := strings.Fields(name)
+	switch len(words) {
+	case 0:
+		return "", ""
+	case 1:
+		return words[0], ""
+	}
+	return words[0], strings.Join(words[1:], " ")
+}
+
+// detectPattern returns the name of the pattern that produces local for the
+// given name, or "" if none does.
+func detectPattern(firstName, lastName, local string) string {
+	local = strings.ToLower(local)
+	for _, first := range nameVariants(firstName, true) {
+		for _, last := range nameVariants(lastName, false) {
+			for _, pattern := range emailPatterns {
+				if pattern.Build(first, last) == local {
+					return pattern.Name
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// rankPermutations builds every pattern for every name variant and ranks them:
+// patterns proven valid at the domain first, then by how common the pattern is,
+// with less likely name variants after the main one. When the domain's format
+// is known with enough confidence, candidates of other patterns are marked
+// unlikely.
+func rankPermutations(firstName, lastName, domain string, learned *DomainPatterns) []PermutationCandidate {
+	firsts := nameVariants(firstName, true)
+	lasts := nameVariants(lastName, false)
+	best, confidence := learned.best()
+
+	seen := make(map[string]bool)
+	var candidates []PermutationCandidate
+	for fi, first := range firsts {
+		for li, last := range lasts {
+			for pi, pattern := range emailPatterns {
+				local := pattern.Build(first, last)
+				if local == "" {
+					continue
+				}
+				email := local + "@" + domain
+				if seen[email] {
+					continue
+				}
+				seen[email] = true
+
+				score := 100 - pi*5 - (fi+li)*30
+				candidate := PermutationCandidate{
+					Email:   email,
+					Pattern: pattern.Name,
+				}
+				if counts := learned.Patterns[pattern.Name]; counts != nil {
+					score += (counts.Valid - counts.Invalid) * 1000
+					candidate.ProvenValid = counts.Valid
+					candidate.ProvenInvalid = counts.Invalid
+				}
+				if best != "" && confidence >= likelyPatternConfidence && pattern.Name != best {
+					candidate.Unlikely = true
+				}
+				candidate.Score = score
+				candidates = append(candidates, candidate)
+			}
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Score > candidates[j].Score
+	})
+	return candidates
+}
+
+// applyCachedStatuses fills in the cached status of each candidate address and
+// re-ranks: addresses already known valid first, known invalid last.
+// All candidates are read in one batch, since any of them may move up.
+func (s *CacheServer) applyCachedStatuses(candidates []PermutationCandidate) {
+	emails := make([]string, len(candidates))
+	for i := range candidates {
+		emails[i] = candidates[i].Email
+	}
+	cachedLeads, err := s.store.GetLeads(s.ctx, emails)
+	if err != nil {
+		log.Printf("⚠️ Could not read cached statuses of email candidates: %v", err)
+		return
+	}
+	for i := range candidates {
+		cached, exists := cachedLeads[candidates[i].Email]
+		if !exists {
+			continue
+		}
+		candidates[i].Status = cached.LeadData.EmailStatus
+		switch candidates[i].Status {
+		case EMAIL_STATUS_VALID:
+			candidates[i].Score += 100000
+		case EMAIL_STATUS_INVALID:
+			candidates[i].Score -= 100000
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Score > candidates[j].Score
+	})
+}
+
+func (s *CacheServer) generatePermutations(c *gin.Context) {
+	var request PermutationRequest
+	if err := c.ShouldBindJSON(&request); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, PermutationResponse{
+			Success: false,
+			Error:   "Invalid JSON in request body",
+		})
+		return
+	}
+
+	firstName, lastName := request.FirstName, request.LastName
+	if firstName == "" && lastName == "" {
+		firstName, lastName = splitFullName(request.Name)
+	}
+	domain := strings.ToLower(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(request.Domain), "@")))
+
+	if normalizeNamePart(firstName) == "" || normalizeNamePart(lastName) == "" {
+		c.JSON(http.StatusBadRequest, PermutationResponse{
+			Success: false,
+			Error:   "A first and last name are required",
+		})
+		return
+	}
+	if domain == "" || validateEmailAddress("x@"+domain) != nil {
+		c.JSON(http.StatusBadRequest, PermutationResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Invalid domain %q", request.Domain),
+		})
+		return
+	}
+
+	limit := request.Limit
+	if limit <= 0 {
+		limit = 10
+	}
+
+	learned, err := s.loadDomainPatterns(domain)
+	if err != nil {
+		log.Printf("⚠️ Could not read known patterns for %s, ranking without them: %v", domain, err)
+		learned = &DomainPatterns{Domain: domain}
+	}
+
+	candidates := rankPermutations(firstName, lastName, domain, learned)
+	s.applyCachedStatuses(candidates)
+	if len(candidates) > limit {
+		candidates = candidates[:limit]
+	}
+	pattern, confidence := learned.best()
+
+	log.Printf("🔀 Generated %d email candidates for %s %s at %s", len(candidates), firstName, lastName, domain)
+	c.JSON(http.StatusOK, PermutationResponse{
+		Success:    true,
+		Domain:     domain,
+		FirstName:  normalizeNamePart(firstName),
+		LastName:   normalizeNamePart(lastName),
+		Pattern:    pattern,
+		Confidence: confidence,
+		Candidates: candidates,
+	})
+}
@@ -0,0 +1,464 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	PROMPT_TEMPLATE_COLLECTION         = "prompt_templates"
+	PROMPT_TEMPLATE_VERSION_COLLECTION = "prompt_template_versions"
+	DEFAULT_PROMPT_TEMPLATE            = "default"
+)
+
+// PromptTemplate is a named text/template that renders the instruction sent to
+// the email generator. Every update is saved as a new version and old versions
+// stay readable.
+type PromptTemplate struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Version     int    `json:"version"`
+	Text        string `json:"text"`
+	// Variables are defaults for this template, applied over the configured
+	// generation.variables and under the request's own variables.
+	Variables map[string]string `json:"variables,omitempty"`
+	CreatedAt int64             `json:"createdAt"`
+	UpdatedAt int64             `json:"updatedAt"`
+}
+
+type PromptTemplateResponse struct {
+	Success   bool              `json:"success"`
+	Template  *PromptTemplate   `json:"template,omitempty"`
+	Templates []*PromptTemplate `json:"templates,omitempty"`
+	Versions  []int             `json:"versions,omitempty"`
+	Error     string            `json:"error,omitempty"`
+}
+
+// promptVariableNames are filled in for every template; anything else comes from
+// configuration, the template's own defaults or the request.
+var promptVariableNames = []string{
+	"companyInfo", "personName", "firstName",
+	"senderCompany", "calendarLink", "tone", "length", "language",
+}
+
+// defaultPromptTemplate is the outreach prompt the server always used, with
+// the pitch details turned into variables.
+var defaultPromptTemplate = PromptTemplate{
+	ID:          DEFAULT_PROMPT_TEMPLATE,
+	Name:        "Default outreach",
+	Description: "Company-specific problem, how the sender helps, quantified benefits and a calendar link",
+	Text: "write a mail companyName: {{.companyInfo}} personName: {{.personName}}" +
+		"1. Mention something specific about the company or person " +
+		"2. tell a tech problem the is very company specific and not a general problem " +
+		"3. Briefly explain how {{.senderCompany}} can help them solve a problem and how their business might improve(quantify the benifits). when mentioning about {{.senderCompany}} start with At {{.senderCompany}}  " +
+		"4.ensure mail is well structed using bullet points and important keywords are in bold " +
+		"5.ensure word count is between {{.length}}. " +
+		"6.start with Hi {{.firstName}} " +
+		"7.end with a low fricting CTA and add a clickable Calendly link using <a href='{{.calendarLink}}'>schedule a call</a> " +
+		"8.create a eye catcing subject, 5–8 words is ideal, mention the company and Highlight what they gain by opening " +
+		"9.ensure email is HTML based well structed, use li ul tags ad b for bold " +
+		"10.ensure company name is correct and is bold and {{.senderCompany}} is bold too " +
+		"11.write in {{.language}} with a {{.tone}} tone " +
+		"12.output should follow json format with keys subject and body only",
+}
+
+var promptTemplateIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// parse compiles the template; unknown variables are an error when rendering.
+func (t *PromptTemplate) parse() (*template.Template, error) {
+	return template.New(t.ID).Option("missingkey=error").Parse(t.Text)
+}
+
+// validate checks the template compiles and renders with every variable a
+// generation can set: the built-in ones, the lead context, configured
+// defaults and the template's own.
+func (t *PromptTemplate) validate(configured map[string]string) error {
+	var errs []string
+	if !promptTemplateIDPattern.MatchString(t.ID) {
+		errs = append(errs, "id must be 1-64 lowercase letters, digits, '-' or '_'")
+	}
+	if strings.TrimSpace(t.Name) == "" {
+		errs = append(errs, "name is required")
+	}
+	if strings.TrimSpace(t.Text) == "" {
+		errs = append(errs, "text is required")
+	} else if tmpl, err := t.parse(); err != nil {
+		errs = append(errs, fmt.Sprintf("text: %v", err))
+	} else {
+		sample := make(map[string]string)
+		for _, name := range promptVariableNames {
+			sample[name] = name
+		}
+		for _, name := range leadContextVariableNames {
+			sample[name] = name
+		}
+		for name := range configured {
+			sample[name] = name
+		}
+		for name := range t.Variables {
+			sample[name] = name
+		}
+		if err := tmpl.Execute(io.Discard, sample); err != nil {
+			errs = append(errs, fmt.Sprintf("text: %v", err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func promptTemplateVersionID(id string, version int) string {
+	return fmt.Sprintf("%s@%d", id, version)
+}
+
+// seedPromptTemplates stores the built-in default template the first time the
+// server starts against a store without it.
+func (s *CacheServer) seedPromptTemplates() error {
+	if _, err := s.loadPromptTemplate(DEFAULT_PROMPT_TEMPLATE, 0); err == nil {
+		return nil
+	} else if !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	seed := defaultPromptTemplate
+	_, err := s.savePromptTemplate(&seed)
+	return err
+}
+
+// loadPromptTemplate returns the latest version of a template, or the given
+// version when version > 0.
+func (s *CacheServer) loadPromptTemplate(id string, version int) (*PromptTemplate, error) {
+	var tmpl PromptTemplate
+	if version > 0 {
+		err := getRecordJSON(s.ctx, s.store, PROMPT_TEMPLATE_VERSION_COLLECTION, promptTemplateVersionID(id, version), &tmpl)
+		return &tmpl, err
+	}
+	err := getRecordJSON(s.ctx, s.store, PROMPT_TEMPLATE_COLLECTION, id, &tmpl)
+	return &tmpl, err
+}
+
+// savePromptTemplate stores tmpl as the next version of its id.
+func (s *CacheServer) savePromptTemplate(tmpl *PromptTemplate) (*PromptTemplate, error) {
+	now := time.Now().UnixMilli()
+	tmpl.Version = 1
+	tmpl.CreatedAt = now
+	if current, err := s.loadPromptTemplate(tmpl.ID, 0); err == nil {
+		tmpl.Version = current.Version + 1
+		tmpl.CreatedAt = current.CreatedAt
+	} else if !errors.Is(err, ErrNotFound) {
+		return nil, err
+	} else {
+		// A re-created template continues after the versions of the deleted one
+		versions, err := s.promptTemplateVersions(tmpl.ID)
+		if err != nil {
+			return nil, err
+		}
+		if len(versions) > 0 {
+			tmpl.Version = versions[len(versions)-1] + 1
+		}
+	}
+	tmpl.UpdatedAt = now
+
+	if err := putRecordJSON(s.ctx, s.store, PROMPT_TEMPLATE_VERSION_COLLECTION, promptTemplateVersionID(tmpl.ID, tmpl.Version), tmpl); err != nil {
+		return nil, err
+	}
+	if err := putRecordJSON(s.ctx, s.store, PROMPT_TEMPLATE_COLLECTION, tmpl.ID, tmpl); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// promptTemplateVersions lists the stored version numbers of a template.
+func (s *CacheServer) promptTemplateVersions(id string) ([]int, error) {
+	records, err := s.store.ListRecords(s.ctx, PROMPT_TEMPLATE_VERSION_COLLECTION)
+	if err != nil {
+		return nil, err
+	}
+	var versions []int
+	for _, raw := range records {
+		var tmpl PromptTemplate
+		if err := json.Unmarshal(raw, &tmpl); err != nil || tmpl.ID != id {
+			continue
+		}
+		versions = append(versions, tmpl.Version)
+	}
+	sort.Ints(versions)
+	return versions, nil
+}
+
+// renderPrompt builds the generator prompt from the requested template.
+// Variables are layered: configuration, template defaults, the lead context,
+// then the request. The lead context is appended to the prompt unless the
+// template places it itself with {{.leadContext}}.
+func (s *CacheServer) renderPrompt(request *EmailGenerationRequest, leadContext *LeadContext) (*EmailPrompt, error) {
+	id := request.TemplateID
+	if id == "" {
+		id = s.config.Generation.Template
+	}
+	tmpl, err := s.loadPromptTemplate(id, request.TemplateVersion)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			if request.TemplateVersion > 0 {
+				return nil, fmt.Errorf("prompt template %q has no version %d", id, request.TemplateVersion)
+			}
+			return nil, fmt.Errorf("prompt template %q not found", id)
+		}
+		return nil, fmt.Errorf("failed to load prompt template %q: %v", id, err)
+	}
+
+	variables := make(map[string]string)
+	for name, value := range s.config.Generation.Variables {
+		variables[name] = value
+	}
+	for name, value := range tmpl.Variables {
+		variables[name] = value
+	}
+	if leadContext != nil {
+		for name, value := range leadContext.variables() {
+			variables[name] = value
+		}
+	} else {
+		for _, name := range leadContextVariableNames {
+			if _, ok := variables[name]; !ok {
+				variables[name] = ""
+			}
+		}
+	}
+	for name, value := range request.Variables {
+		variables[name] = value
+	}
+	variables["companyInfo"] = request.CompanyInfo
+	variables["personName"] = request.PersonName
+	if _, ok := request.Variables["firstName"]; !ok {
+		variables["firstName"] = request.PersonName
+		if fields := strings.Fields(request.PersonName); len(fields) > 0 {
+			variables["firstName"] = fields[0]
+		}
+	}
+
+	parsed, err := tmpl.parse()
+	if err != nil {
+		return nil, fmt.Errorf("prompt template %q v%d is invalid: %v", tmpl.ID, tmpl.Version, err)
+	}
+	var text strings.Builder
+	if err := parsed.Execute(&text, variables); err != nil {
+		return nil, fmt.Errorf("failed to render prompt template %q v%d: %v", tmpl.ID, tmpl.Version, err)
+	}
+	if section := variables["leadContext"]; section != "" && !strings.Contains(tmpl.Text, ".leadContext") {
+		text.WriteString("\n\n" + section)
+	}
+
+	return &EmailPrompt{
+		CompanyInfo:     request.CompanyInfo,
+		PersonName:      request.PersonName,
+		Text:            text.String(),
+		Variables:       variables,
+		TemplateID:      tmpl.ID,
+		TemplateVersion: tmpl.Version,
+		Context:         leadContext,
+	}, nil
+}
+
+func (s *CacheServer) listPromptTemplates(c *gin.Context) {
+	records, err := s.store.ListRecords(s.ctx, PROMPT_TEMPLATE_COLLECTION)
+	if err != nil {
+		log.Printf("Error listing prompt templates: %v", err)
+		c.JSON(http.StatusInternalServerError, PromptTemplateResponse{
+			Success: false,
+			Error:   "Failed to list prompt templates",
+		})
+		return
+	}
+
+	templates := make([]*PromptTemplate, 0, len(records))
+	for _, raw := range records {
+		var tmpl PromptTemplate
+		if err := json.Unmarshal(raw, &tmpl); err != nil {
+			log.Printf("⚠️ Skipping unreadable prompt template: %v", err)
+			continue
+		}
+		templates = append(templates, &tmpl)
+	}
+	sort.Slice(templates, func(i, j int) bool {
+		return templates[i].ID < templates[j].ID
+	})
+
+	c.JSON(http.StatusOK, PromptTemplateResponse{
+		Success:   true,
+		Templates: templates,
+	})
+}
+
+// getPromptTemplate returns the latest version, or ?version=N, with the list of
+// stored versions.
+func (s *CacheServer) getPromptTemplate(c *gin.Context) {
+	id := c.Param("id")
+	version := 0
+	if v := c.Query("version"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 1 {
+			c.JSON(http.StatusBadRequest, PromptTemplateResponse{
+				Success: false,
+				Error:   "version must be a positive integer",
+			})
+			return
+		}
+		version = parsed
+	}
+
+	tmpl, ok := s.lookupPromptTemplate(c, id, version)
+	if !ok {
+		return
+	}
+	versions, err := s.promptTemplateVersions(id)
+	if err != nil {
+		log.Printf("⚠️ Could not list versions of prompt template %s: %v", id, err)
+	}
+
+	c.JSON(http.StatusOK, PromptTemplateResponse{
+		Success:  true,
+		Template: tmpl,
+		Versions: versions,
+	})
+}
+
+// lookupPromptTemplate loads a template, writing the error response itself.
+func (s *CacheServer) lookupPromptTemplate(c *gin.Context, id string, version int) (*PromptTemplate, bool) {
+	tmpl, err := s.loadPromptTemplate(id, version)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			c.JSON(http.StatusNotFound, PromptTemplateResponse{
+				Success: false,
+				Error:   fmt.Sprintf("Prompt template %s not found", id),
+			})
+			return nil, false
+		}
+		log.Printf("Error loading prompt template %s: %v", id, err)
+		c.JSON(http.StatusInternalServerError, PromptTemplateResponse{
+			Success: false,
+			Error:   "Failed to load prompt template",
+		})
+		return nil, false
+	}
+	return tmpl, true
+}
+
+// createPromptTemplate adds a new template as version 1.
+func (s *CacheServer) createPromptTemplate(c *gin.Context) {
+	var tmpl PromptTemplate
+	if err := c.ShouldBindJSON(&tmpl); err != nil {
+		c.JSON(http.StatusBadRequest, PromptTemplateResponse{
+			Success: false,
+			Error:   "Invalid JSON in request body",
+		})
+		return
+	}
+	tmpl.ID = strings.ToLower(strings.TrimSpace(tmpl.ID))
+
+	if _, err := s.loadPromptTemplate(tmpl.ID, 0); err == nil {
+		c.JSON(http.StatusConflict, PromptTemplateResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Prompt template %s already exists; use PUT to add a version", tmpl.ID),
+		})
+		return
+	}
+	s.storePromptTemplate(c, &tmpl, http.StatusCreated)
+}
+
+// updatePromptTemplate saves the body as the next version of an existing template.
+func (s *CacheServer) updatePromptTemplate(c *gin.Context) {
+	id := c.Param("id")
+	current, ok := s.lookupPromptTemplate(c, id, 0)
+	if !ok {
+		return
+	}
+
+	// Fields left out of the body keep their current value
+	tmpl := *current
+	tmpl.Variables = nil
+	if err := c.ShouldBindJSON(&tmpl); err != nil {
+		c.JSON(http.StatusBadRequest, PromptTemplateResponse{
+			Success: false,
+			Error:   "Invalid JSON in request body",
+		})
+		return
+	}
+	if tmpl.Variables == nil {
+		tmpl.Variables = current.Variables
+	}
+	tmpl.ID = id
+	s.storePromptTemplate(c, &tmpl, http.StatusOK)
+}
+
+func (s *CacheServer) storePromptTemplate(c *gin.Context, tmpl *PromptTemplate, status int) {
+	if err := tmpl.validate(s.config.Generation.Variables); err != nil {
+		c.JSON(http.StatusBadRequest, PromptTemplateResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Invalid prompt template: %v", err),
+		})
+		return
+	}
+
+	saved, err := s.savePromptTemplate(tmpl)
+	if err != nil {
+		log.Printf("Error saving prompt template %s: %v", tmpl.ID, err)
+		c.JSON(http.StatusInternalServerError, PromptTemplateResponse{
+			Success: false,
+			Error:   "Failed to save prompt template",
+		})
+		return
+	}
+
+	log.Printf("📝 Saved prompt template %s v%d", saved.ID, saved.Version)
+	c.JSON(status, PromptTemplateResponse{
+		Success:  true,
+		Template: saved,
+	})
+}
+
+// deletePromptTemplate removes a template so it can no longer be selected. Its
+// stored versions are kept so past generations stay traceable.
+func (s *CacheServer) deletePromptTemplate(c *gin.Context) {
+	id := c.Param("id")
+	if id == s.config.Generation.Template {
+		c.JSON(http.StatusBadRequest, PromptTemplateResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Prompt template %s is the configured default and cannot be deleted", id),
+		})
+		return
+	}
+
+	deleted, err := s.store.DeleteRecord(s.ctx, PROMPT_TEMPLATE_COLLECTION, id)
+	if err != nil {
+		log.Printf("Error deleting prompt template %s: %v", id, err)
+		c.JSON(http.StatusInternalServerError, PromptTemplateResponse{
+			Success: false,
+			Error:   "Failed to delete prompt template",
+		})
+		return
+	}
+	if !deleted {
+		c.JSON(http.StatusNotFound, PromptTemplateResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Prompt template %s not found", id),
+		})
+		return
+	}
+
+	log.Printf("🗑️ Deleted prompt template %s", id)
+	c.JSON(http.StatusOK, PromptTemplateResponse{Success: true})
+}
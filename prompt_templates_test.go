@@ -0,0 +1,24 @@
+package main
+
+import "testing"
+
+func TestPromptTemplateValidateVariables(t *testing.T) {
+	configured := map[string]string{"senderCompany": "Acme", "signature": "Jane"}
+
+	for _, text := range []string{
+		"{{.leadContext}} {{.title}}",
+		"{{.companyDescription}} {{.profileSnippet}} {{.notes}}",
+		"Sign as {{.signature}}",
+		"{{.own}}",
+	} {
+		tmpl := PromptTemplate{ID: "t", Name: "T", Text: text, Variables: map[string]string{"own": "x"}}
+		if err := tmpl.validate(configured); err != nil {
+			t.Errorf("validate(%q) = %v, want nil", text, err)
+		}
+	}
+
+	tmpl := PromptTemplate{ID: "t", Name: "T", Text: "{{.undefined}}"}
+	if err := tmpl.validate(configured); err == nil {
+		t.Error("validate accepted a template with an undefined variable")
+	}
+}
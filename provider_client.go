@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without calling the provider while its circuit
+// breaker is open.
+var ErrCircuitOpen = errors.New("provider circuit breaker is open")
+
+const (
+	BREAKER_CLOSED    = "closed"
+	BREAKER_OPEN      = "open"
+	BREAKER_HALF_OPEN = "half-open"
+)
+
+// providerTransport is shared by every AI provider client so connections to
+// the same host are reused across generators and requests.
+var providerTransport = &http.Transport{
+	Proxy:               http.ProxyFromEnvironment,
+	MaxIdleConns:        20,
+	MaxIdleConnsPerHost: 4,
+	IdleConnTimeout:     90 * time.Second,
+	TLSHandshakeTimeout: 10 * time.Second,
+}
+
+// ProviderClient sends requests to an AI provider, retrying 429 and 5xx
+// responses and network errors with exponential backoff and jitter, honoring
+// Retry-After. A circuit breaker fails calls fast after repeated failures.
+// Timeouts come from the request context, so an abandoned request is
+// cancelled together with its retries.
+type ProviderClient struct {
+	name       string
+	client     *http.Client
+	maxRetries int
+	baseDelay  time.Duration
+	maxDelay   time.Duration
+	breaker    *CircuitBreaker
+}
+
+func NewProviderClient(name string, cfg GenerationConfig) *ProviderClient {
+	return &ProviderClient{
+		name:       name,
+		client:     &http.Client{Transport: providerTransport},
+		maxRetries: cfg.Retry.MaxRetries,
+		baseDelay:  time.Duration(cfg.Retry.BaseDelay),
+		maxDelay:   time.Duration(cfg.Retry.MaxDelay),
+		breaker:    NewCircuitBreaker(name, cfg.CircuitBreaker.FailureThreshold, time.Duration(cfg.CircuitBreaker.Cooldown)),
+	}
+}
+
+// Do sends req, which must have been built with a replayable body (as
+// http.NewRequestWithContext does for a *bytes.Buffer). The caller closes the
+// returned body.
+func (p *ProviderClient) Do(req *http.Request) (*http.Response, error) {
+	if !p.breaker.Allow() {
+		return nil, fmt.Errorf("%w: %s is failing, retry in %s", ErrCircuitOpen, p.name, p.breaker.RetryIn().Round(time.Second))
+	}
+
+	ctx := req.Context()
+	for attempt := 0; ; attempt++ {
+		attemptReq := req
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, fmt.Errorf("failed to rewind request body: %v", err)
+			}
+			attemptReq = req.Clone(ctx)
+			attemptReq.Body = body
+		}
+
+		resp, err := p.client.Do(attemptReq)
+		if ctx.Err() != nil {
+			// Cancelled by the caller; says nothing about the provider's health
+			if err == nil {
+				resp.Body.Close()
+			}
+			p.breaker.Abandon()
+			return nil, ctx.Err()
+		}
+
+		retryable := err != nil || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		if !retryable {
+			p.breaker.Success()
+			return resp, nil
+		}
+		if attempt >= p.maxRetries || (attempt > 0 && req.GetBody == nil) {
+			p.breaker.Failure()
+			return resp, err
+		}
+
+		delay := p.backoff(attempt)
+		if resp != nil {
+			if after, ok := retryAfter(resp.Header.Get("Retry-After")); ok {
+				delay = after
+			}
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+			resp.Body.Close()
+			log.Printf("🔁 %s returned %d, retrying in %s (%d/%d)", p.name, resp.StatusCode, delay.Round(time.Millisecond), attempt+1, p.maxRetries)
+		} else {
+			log.Printf("🔁 %s request failed: %v, retrying in %s (%d/%d)", p.name, err, delay.Round(time.Millisecond), attempt+1, p.maxRetries)
+		}
+
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			p.breaker.Failure()
+			return nil, fmt.Errorf("%s asked to wait %s, longer than the time left for this request", p.name, delay.Round(time.Second))
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			p.breaker.Abandon()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// backoff is the full-jitter exponential delay before retry attempt+1.
+func (p *ProviderClient) backoff(attempt int) time.Duration {
+	limit := p.baseDelay << uint(attempt)
+	if limit > p.maxDelay || limit <= 0 {
+		limit = p.maxDelay
+	}
+	if limit <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(limit))) + time.Millisecond
+}
+
+// retryAfter reads a Retry-After header given in seconds or as an HTTP date.
+func retryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if wait := time.Until(at); wait > 0 {
+			return wait, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// CircuitBreaker opens after threshold consecutive failures and rejects calls
+// for cooldown. It then lets one trial call through (half-open): success
+// closes it, failure opens it again.
+type CircuitBreaker struct {
+	name      string
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time
+	trial    bool
+}
+
+func NewCircuitBreaker(name string, threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{name: name, threshold: threshold, cooldown: cooldown}
+}
+
+func (b *CircuitBreaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state() {
+	case BREAKER_CLOSED:
+		return true
+	case BREAKER_HALF_OPEN:
+		if b.trial {
+			return false
+		}
+		b.trial = true
+		return true
+	}
+	return false
+}
+
+func (b *CircuitBreaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.threshold > 0 && b.failures >= b.threshold {
+		log.Printf("✅ %s circuit breaker closed after a successful call", b.name)
+	}
+	b.failures = 0
+	b.trial = false
+}
+
+func (b *CircuitBreaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	b.trial = false
+	if b.failures >= b.threshold {
+		if b.failures == b.threshold {
+			log.Printf("🚧 %s circuit breaker opened after %d consecutive failures", b.name, b.failures)
+		}
+		b.openedAt = time.Now()
+	}
+}
+
+// Abandon ends a call that was cancelled before its outcome was known, so a
+// half-open breaker lets the next trial through.
+func (b *CircuitBreaker) Abandon() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trial = false
+}
+
+// State is closed, open or half-open.
+func (b *CircuitBreaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state()
+}
+
+// RetryIn is how long until an open breaker lets a trial call through.
+func (b *CircuitBreaker) RetryIn() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if wait := b.cooldown - time.Since(b.openedAt); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+func (b *CircuitBreaker) state() string {
+	if b.threshold <= 0 || b.failures < b.threshold {
+		return BREAKER_CLOSED
+	}
+	if time.Since(b.openedAt) < b.cooldown {
+		return BREAKER_OPEN
+	}
+	return BREAKER_HALF_OPEN
+}
+
+// providerStates reports the circuit breaker state of every generator that
+// calls a remote provider.
+func (s *CacheServer) providerStates() map[string]string {
+	states := make(map[string]string)
+	for name, generator := range s.generators {
+		if remote, ok := generator.(interface{ Client() *ProviderClient }); ok {
+			states[name] = remote.Client().breaker.State()
+		}
+	}
+	return states
+}
+
+// withProviderTimeout bounds a provider call, including its retries.
+func withProviderTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestProviderClient never waits long on its own: a test that relies on the
+// backoff instead of Retry-After would run out of time.
+func newTestProviderClient(maxRetries, threshold int, cooldown time.Duration) *ProviderClient {
+	return &ProviderClient{
+		name:       "test",
+		client:     &http.Client{},
+		maxRetries: maxRetries,
+		baseDelay:  time.Hour,
+		maxDelay:   time.Hour,
+		breaker:    NewCircuitBreaker("test", threshold, cooldown),
+	}
+}
+
+// providerServer answers each request with the next of statuses, repeating the
+// last one, and counts the requests.
+func providerServer(t *testing.T, statuses ...int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(calls.Add(1)) - 1
+		status := statuses[min(n, len(statuses)-1)]
+		if status == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", "0")
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func sendProviderRequest(ctx context.Context, p *ProviderClient, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBufferString(`{"prompt":"hi"}`))
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.Do(req)
+	if err == nil {
+		resp.Body.Close()
+	}
+	return resp, err
+}
+
+func TestProviderClientRetriesAfterRetryAfter(t *testing.T) {
+	server, calls := providerServer(t, http.StatusTooManyRequests, http.StatusOK)
+	p := newTestProviderClient(2, 3, time.Minute)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	resp, err := sendProviderRequest(ctx, p, server.URL)
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || calls.Load() != 2 {
+		t.Fatalf("Do = %d after %d calls, want 200 after 2", resp.StatusCode, calls.Load())
+	}
+}
+
+func TestProviderClientDoesNotRetryClientErrors(t *testing.T) {
+	server, calls := providerServer(t, http.StatusBadRequest, http.StatusOK)
+	p := newTestProviderClient(2, 1, time.Minute)
+
+	resp, err := sendProviderRequest(context.Background(), p, server.URL)
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	if resp.StatusCode != http.StatusBadRequest || calls.Load() != 1 {
+		t.Fatalf("Do = %d after %d calls, want 400 after 1", resp.StatusCode, calls.Load())
+	}
+	// The provider answered; a bad request is not a provider failure
+	if state := p.breaker.State(); state != BREAKER_CLOSED {
+		t.Fatalf("breaker = %s, want closed", state)
+	}
+}
+
+func TestProviderClientBreakerOpensAndLetsOneTrialThrough(t *testing.T) {
+	server, calls := providerServer(t, http.StatusInternalServerError)
+	const cooldown = 50 * time.Millisecond
+	p := newTestProviderClient(0, 2, cooldown)
+
+	for i := 0; i < 2; i++ {
+		resp, err := sendProviderRequest(context.Background(), p, server.URL)
+		if err != nil || resp.StatusCode != http.StatusInternalServerError {
+			t.Fatalf("call %d = %v, %v; want the 500", i+1, resp, err)
+		}
+	}
+	if _, err := sendProviderRequest(context.Background(), p, server.URL); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Do with the breaker open = %v, want ErrCircuitOpen", err)
+	}
+	if calls.Load() != 2 {
+		t.Fatalf("provider called %d times, want 2", calls.Load())
+	}
+
+	time.Sleep(cooldown)
+	if state := p.breaker.State(); state != BREAKER_HALF_OPEN {
+		t.Fatalf("breaker after the cooldown = %s, want half-open", state)
+	}
+	if !p.breaker.Allow() {
+		t.Fatal("half-open breaker refused the trial call")
+	}
+	if p.breaker.Allow() {
+		t.Fatal("half-open breaker let a second call through during the trial")
+	}
+	p.breaker.Success()
+	if state := p.breaker.State(); state != BREAKER_CLOSED || !p.breaker.Allow() {
+		t.Fatalf("breaker after a successful trial = %s, want closed", state)
+	}
+}
+
+func TestProviderClientCancelledCallAbandonsTrial(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	const cooldown = 10 * time.Millisecond
+	p := newTestProviderClient(2, 1, cooldown)
+	p.breaker.Failure()
+	time.Sleep(cooldown)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+	if _, err := sendProviderRequest(ctx, p, server.URL); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Do with a cancelled context = %v, want context.Canceled", err)
+	}
+
+	// Still one failure, and the trial slot is free again
+	if state := p.breaker.State(); state != BREAKER_HALF_OPEN {
+		t.Fatalf("breaker after a cancelled trial = %s, want half-open", state)
+	}
+	if !p.breaker.Allow() {
+		t.Fatal("cancelled trial call kept the half-open breaker blocked")
+	}
+}
@@ -4,8 +4,12 @@ class LeadGeneratorSidebar {
         this.currentTabId = null;
         this.isScanning = false;
         this.verifiedEmail=null;
+        this.profileData=null;
+        // Lead the shown email was generated for; generating again for it forces a new email
+        this.generatedFor=null;
+        // API key sent to the cache server; null until read from storage
+        this.apiKey=null;
         this.cacheServerUrl = 'http://localhost:3001';
-        this.pythonServerUrl='http://localhost:8000'; // Go Redis Cache Server
         this.initializeElements();
         this.setupEventListeners();
         this.checkCurrentTab();
@@ -47,11 +51,21 @@ class LeadGeneratorSidebar {
             copySubjectButton: document.getElementById('copySubjectButton'),
             copyBodyButton: document.getElementById('copyBodyButton'),
             saveEmailButton: document.getElementById('saveEmailButton'),
-            saveGeneratedEmailButton: document.getElementById('saveGeneratedEmailButton')
+            saveGeneratedEmailButton: document.getElementById('saveGeneratedEmailButton'),
+            apiKeyInput: document.getElementById('apiKeyInput')
         };
     }
 
     setupEventListeners() {
+        this.loadApiKey().then(apiKey => {
+            this.elements.apiKeyInput.value = apiKey;
+        });
+        this.elements.apiKeyInput.addEventListener('change', async () => {
+            this.apiKey = this.elements.apiKeyInput.value.trim();
+            await chrome.storage.local.set({ cacheServerApiKey: this.apiKey });
+            this.refreshLeadsCount();
+        });
+
         this.elements.scanButton.addEventListener('click', () => {
             this.scanProfile();
         });
@@ -180,6 +194,9 @@ class LeadGeneratorSidebar {
     }
 
     displayProfile(data) {
+        // Kept for the lead record, so email generation can use the headline
+        this.profileData = data;
+
         // Update profile name
         this.elements.profileName.textContent = data.name || 'Name not found';
 
@@ -273,12 +290,46 @@ hideError() {
             listLeadBelongsTo: listName,
             possibleEmails: emailFormats
         }
+        if (this.profileData) {
+            if (this.profileData.profileUrl) leadData.sourceUrl = this.profileData.profileUrl;
+            if (this.profileData.headline) leadData.profileSnippet = this.profileData.headline;
+        }
 
         console.log("leadData")
         console.log(leadData)
 
         // Update the UI
         this.displayEmailSuggestions(leadData);
+
+        // Replace the basic formats with the server's ranked candidates when it is reachable
+        this.fetchEmailPermutations(name, cleanDomain).then(candidates => {
+            const stillCurrent = this.elements.nameInput.value.trim() === name &&
+                this.elements.emailDomainInput.value.replace('@', '').trim().toLowerCase() === cleanDomain;
+            if (candidates && candidates.length > 0 && stillCurrent) {
+                leadData.possibleEmails = candidates.map(candidate => candidate.email);
+                this.displayEmailSuggestions(leadData);
+            }
+        });
+    }
+
+    async fetchEmailPermutations(name, domain) {
+        try {
+            const response = await this.serverFetch(`/leads/permutations`, {
+                method: 'POST',
+                headers: {
+                    'Content-Type': 'application/json',
+                },
+                body: JSON.stringify({ name: name, domain: domain, limit: 6 })
+            });
+            const result = await response.json();
+            if (!response.ok || !result.success) {
+                throw new Error(result.error || `HTTP error! status: ${response.status}`);
+            }
+            return result.candidates;
+        } catch (error) {
+            console.log('Email permutations unavailable, using basic formats:', error);
+            return null;
+        }
     }
 
     displayEmailSuggestions(leadData) {
@@ -422,14 +473,14 @@ hideError() {
                 email:email,
                 listLeadBelongsTo:leadData.listLeadBelongsTo
             }
-            const result = await this.callNeverBounceAPI(email);
-            dataToBeStoredInCache.emailStatus=result.result;
-            console.log("dataToBeStoredInCache")
-            console.log(dataToBeStoredInCache)
-            // Cache the result
-            await this.setCachedVerification(email, dataToBeStoredInCache);
+            // The server calls the verification provider and caches the result with the lead
+            const result = await this.callVerifyAPI(email, dataToBeStoredInCache);
+            this.verifiedEmail=email;
+            setTimeout(() => {
+                this.loadSavedEmailIfExists();
+            }, 500);
             
-            this.updateVerificationStatus(statusIndicator, verifyButton, result, false);
+            this.updateVerificationStatus(statusIndicator, verifyButton, result, result.cached === true);
         } catch (error) {
             console.error('Email verification failed:', error);
             statusIndicator.innerHTML = '❌';
@@ -445,13 +496,17 @@ hideError() {
         verifyAllButton.innerHTML = '⏳ Verifying...';
         
         try {
-            // Verify all emails concurrently
-            const verificationPromises = emails.map(email => {
-                const emailItem = document.querySelector(`[data-email="${email}"]`);
-                return this.verifyEmail(email, emailItem,leadData);
-            });
-            
-            await Promise.all(verificationPromises);
+            // Verify all emails in one server-side job instead of one request per email
+            try {
+                await this.verifyEmailsInBatch(emails, leadData);
+            } catch (batchError) {
+                console.warn('Batch verification unavailable, verifying one by one:', batchError);
+                const verificationPromises = emails.map(email => {
+                    const emailItem = document.querySelector(`[data-email="${email}"]`);
+                    return this.verifyEmail(email, emailItem,leadData);
+                });
+                await Promise.all(verificationPromises);
+            }
             
             verifyAllButton.innerHTML = '✅ All Verified';
             setTimeout(() => {
@@ -468,29 +523,93 @@ hideError() {
         }
     }
 
-    async callNeverBounceAPI(email) {
-        const API_KEY = 'private_658ac1a2ad10d7c6361d1391903ea93c';
-        const API_URL = 'https://api.neverbounce.com/v4/single/check';
+    async verifyEmailsInBatch(emails, leadData) {
+        // The server reports results by lowercased address
+        const rows = new Map(emails.map(email => [email.toLowerCase(), document.querySelector(`[data-email="${email}"]`)]));
+        rows.forEach(emailItem => {
+            const statusIndicator = emailItem.querySelector('.verification-status');
+            statusIndicator.innerHTML = '⏳';
+            statusIndicator.title = 'Queued...';
+            statusIndicator.className = 'verification-status loading';
+            emailItem.querySelector('.verify-button').disabled = true;
+        });
         
-        const response = await fetch(API_URL, {
+        const response = await this.serverFetch(`/verify/batch`, {
             method: 'POST',
             headers: {
                 'Content-Type': 'application/json',
             },
             body: JSON.stringify({
-                key: API_KEY,
-                email: email
+                emails: emails,
+                lead: {
+                    firstName: leadData.firstName,
+                    lastName: leadData.lastName,
+                    companyName: leadData.companyName,
+                    domain: leadData.domain,
+                    listLeadBelongsTo: leadData.listLeadBelongsTo
+                }
             })
         });
+        const data = await response.json();
+        if (!response.ok || !data.success) {
+            throw new Error(data.error || `Batch request failed: ${response.status}`);
+        }
         
-        if (!response.ok) {
-            throw new Error(`API request failed: ${response.status} ${response.statusText}`);
+        // Poll the job and update each row as its result comes in
+        let job = data.job;
+        while (job.status === 'queued' || job.status === 'running') {
+            await new Promise(resolve => setTimeout(resolve, 1000));
+            const jobResponse = await this.serverFetch(`/jobs/${job.id}`);
+            const jobData = await jobResponse.json();
+            if (!jobResponse.ok || !jobData.success) {
+                throw new Error(jobData.error || `Job request failed: ${jobResponse.status}`);
+            }
+            job = jobData.job;
+            this.showBatchResults(job, rows);
+        }
+        this.showBatchResults(job, rows);
+        
+        const validEmail = job.items.find(item => item.result && item.result.result === 'valid');
+        if (validEmail) {
+            this.verifiedEmail = validEmail.key;
+            setTimeout(() => {
+                this.loadSavedEmailIfExists();
+            }, 500);
         }
+    }
+
+    showBatchResults(job, rows) {
+        job.items.forEach(item => {
+            const emailItem = rows.get(item.key);
+            if (!emailItem || item.status === 'pending') {
+                return;
+            }
+            const statusIndicator = emailItem.querySelector('.verification-status');
+            const verifyButton = emailItem.querySelector('.verify-button');
+            if (item.status === 'failed') {
+                statusIndicator.innerHTML = '❌';
+                statusIndicator.title = `Verification failed: ${item.error}`;
+                statusIndicator.className = 'verification-status error';
+                verifyButton.disabled = false;
+                return;
+            }
+            this.updateVerificationStatus(statusIndicator, verifyButton, item.result, item.result.cached === true);
+        });
+    }
+
+    async callVerifyAPI(email, leadData) {
+        const response = await this.serverFetch(`/verify/${encodeURIComponent(email.toLowerCase())}`, {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+            },
+            body: JSON.stringify(leadData)
+        });
         
         const data = await response.json();
         
-        if (data.status !== 'success') {
-            throw new Error(data.message || 'API returned error status');
+        if (!response.ok || !data.success) {
+            throw new Error(data.error || `API request failed: ${response.status} ${response.statusText}`);
         }
         
         return data;
@@ -538,7 +657,7 @@ hideError() {
     // Email verification cache management via Go Redis server
     async getCachedVerification(email) {
         try {
-            const response = await fetch(`${this.cacheServerUrl}/cache/${encodeURIComponent(email.toLowerCase())}`, {
+            const response = await this.serverFetch(`/cache/${encodeURIComponent(email.toLowerCase())}`, {
                 method: 'GET',
                 headers: {
                     'Content-Type': 'application/json',
@@ -568,7 +687,7 @@ hideError() {
     async setCachedVerification(email, verificationResult) {
         try {
             this.verifiedEmail=email;
-            const response = await fetch(`${this.cacheServerUrl}/cache/${encodeURIComponent(email.toLowerCase())}`, {
+            const response = await this.serverFetch(`/cache/${encodeURIComponent(email.toLowerCase())}`, {
                 method: 'POST',
                 headers: {
                     'Content-Type': 'application/json',
@@ -600,7 +719,7 @@ hideError() {
 
     async removeCachedVerification(email) {
         try {
-            const response = await fetch(`${this.cacheServerUrl}/cache/${encodeURIComponent(email.toLowerCase())}`, {
+            const response = await this.serverFetch(`/cache/${encodeURIComponent(email.toLowerCase())}`, {
                 method: 'DELETE',
                 headers: {
                     'Content-Type': 'application/json',
@@ -630,7 +749,7 @@ hideError() {
 
     async getCacheStats() {
         try {
-            const response = await fetch(`${this.cacheServerUrl}/stats`, {
+            const response = await this.serverFetch(`/stats`, {
                 method: 'GET',
                 headers: {
                     'Content-Type': 'application/json',
@@ -659,10 +778,29 @@ hideError() {
         }
     }
 
+    async loadApiKey() {
+        if (this.apiKey === null) {
+            const stored = await chrome.storage.local.get('cacheServerApiKey');
+            this.apiKey = stored.cacheServerApiKey || '';
+        }
+        return this.apiKey;
+    }
+
+    // Calls the cache server with the API key saved in the sidebar, which the
+    // server requires when auth is enabled.
+    async serverFetch(path, options = {}) {
+        const apiKey = await this.loadApiKey();
+        const headers = { ...(options.headers || {}) };
+        if (apiKey) {
+            headers['Authorization'] = `Bearer ${apiKey}`;
+        }
+        return fetch(`${this.cacheServerUrl}${path}`, { ...options, headers });
+    }
+
     async initializeCache() {
         try {
             // Check if Go cache server is available
-            const healthResponse = await fetch(`${this.cacheServerUrl}/health`);
+            const healthResponse = await this.serverFetch(`/health`);
             
             if (healthResponse.ok) {
                 const health = await healthResponse.json();
@@ -687,7 +825,7 @@ hideError() {
 
     async clearAllCache() {
         try {
-            const response = await fetch(`${this.cacheServerUrl}/cache`, {
+            const response = await this.serverFetch(`/cache`, {
                 method: 'DELETE',
                 headers: {
                     'Content-Type': 'application/json',
@@ -853,35 +991,29 @@ hideError() {
         try {
             console.log('🤖 Generating email for:', {personName, companyInfo });
 
-            // Create AbortController for timeout
-            const controller = new AbortController();
-            const timeoutId = setTimeout(() => controller.abort(), 3*60000); // 60 seconds timeout
-
-            const response = await fetch(`${this.pythonServerUrl}/generate-mail`, {
-                method: 'POST',
-                headers: {
-                    'Content-Type': 'application/json'
-                },
-                body: JSON.stringify({
-                    person_name: personName,
-                    company_name: companyInfo
-                }),
-                signal: controller.signal
-            });
-
-            // Clear timeout if request completes successfully
-            clearTimeout(timeoutId);
-
-            if (!response.ok) {
-                throw new Error(`HTTP error! status: ${response.status}`);
-            }
-
-            const data = await response.json();
+            // With a verified lead the server generates in a background job and saves
+            // the result, so closing the sidebar does not lose it
+            const data = this.verifiedEmail
+                ? await this.generateEmailInBackground({ personName, companyInfo, email: this.verifiedEmail }, this.generatedFor === this.verifiedEmail)
+                : await this.streamEmailGeneration({ personName, companyInfo }, (event, payload) => {
+                    if (event === 'status') {
+                        this.elements.generateEmailButton.lastChild.textContent = ` ${payload.message}...`;
+                    } else if (event === 'partial') {
+                        this.elements.generatedSubject.value = payload.subject;
+                        this.elements.generatedBody.textContent = payload.body;
+                    }
+                });
 
             if (data.success) {
                 // Display the generated email
                 this.displayGeneratedEmail(data.subject, data.body);
-                this.hideError();
+                this.generatedFor = this.verifiedEmail;
+                if (data.violations && data.violations.length > 0) {
+                    // The server kept the best attempt; point out what still needs editing
+                    this.showError(`Please review the email: ${data.violations.join('; ')}`);
+                } else {
+                    this.hideError();
+                }
                 console.log('✅ Email generated successfully');
             } else {
                 throw new Error(data.error || 'Failed to generate email');
@@ -889,13 +1021,7 @@ hideError() {
 
         } catch (error) {
             console.error('❌ Error generating email:', error);
-            
-            // Handle timeout error specifically
-            if (error.name === 'AbortError') {
-                this.showError('Email generation timed out after 60 seconds. Please try again.');
-            } else {
-                this.showError(`Failed to generate email: ${error.message}`);
-            }
+            this.showError(`Failed to generate email: ${error.message}`);
         } finally {
             // Reset button state
             this.elements.generateEmailButton.innerHTML = originalButtonText;
@@ -903,6 +1029,103 @@ hideError() {
         }
     }
 
+    // Queues /generate-email-suggestion?async=true and polls the job until the
+    // email has been generated and saved for the lead. force skips reusing the
+    // email already saved for the lead.
+    async generateEmailInBackground(payload, force) {
+        const response = await this.serverFetch(`/generate-email-suggestion?async=true${force ? '&force=true' : ''}`, {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json'
+            },
+            body: JSON.stringify(payload)
+        });
+
+        const data = await response.json().catch(() => ({}));
+        if (!response.ok || !data.success) {
+            throw new Error(data.error || `HTTP error! status: ${response.status}`);
+        }
+
+        let job = data.job;
+        console.log('📥 Email generation queued as job', job.id);
+        while (job.status === 'queued' || job.status === 'running') {
+            await new Promise(resolve => setTimeout(resolve, 2000));
+            const jobResponse = await this.serverFetch(`/jobs/${job.id}`);
+            if (!jobResponse.ok) {
+                throw new Error(`HTTP error! status: ${jobResponse.status}`);
+            }
+            job = (await jobResponse.json()).job;
+        }
+
+        const item = job.items[0];
+        if (item.status !== 'done') {
+            return { success: false, error: item.error || job.error || `Job ${job.status}` };
+        }
+        return item.result;
+    }
+
+    // Reads the Server-Sent Events of /generate-email-suggestion/stream, calling
+    // onEvent for status and partial events, and resolves with the final result.
+    async streamEmailGeneration(payload, onEvent) {
+        const response = await this.serverFetch(`/generate-email-suggestion/stream`, {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+                'Accept': 'text/event-stream'
+            },
+            body: JSON.stringify(payload)
+        });
+
+        if (!response.ok) {
+            const data = await response.json().catch(() => ({}));
+            throw new Error(data.error || `HTTP error! status: ${response.status}`);
+        }
+
+        const reader = response.body.getReader();
+        const decoder = new TextDecoder();
+        let buffer = '';
+        let result = null;
+
+        const dispatch = (block) => {
+            let event = 'message';
+            const data = [];
+            for (const line of block.split(/\r?\n/)) {
+                if (line.startsWith('event:')) {
+                    event = line.slice(6).trim();
+                } else if (line.startsWith('data:')) {
+                    data.push(line.slice(5).replace(/^ /, ''));
+                }
+            }
+            if (data.length === 0) return;
+
+            const parsed = JSON.parse(data.join('\n'));
+            if (event === 'result' || event === 'error') {
+                result = parsed;
+            } else {
+                onEvent(event, parsed);
+            }
+        };
+
+        while (true) {
+            const { value, done } = await reader.read();
+            if (done) break;
+            buffer += decoder.decode(value, { stream: true });
+
+            let boundary;
+            while ((boundary = buffer.search(/\r?\n\r?\n/)) !== -1) {
+                const block = buffer.slice(0, boundary);
+                buffer = buffer.slice(boundary).replace(/^\r?\n\r?\n/, '');
+                dispatch(block);
+            }
+        }
+        if (buffer.trim()) dispatch(buffer);
+
+        if (!result) {
+            throw new Error('Email stream ended without a result');
+        }
+        return result;
+    }
+
     displayGeneratedEmail(subject, body) {
         // Store the raw body content
         this.rawEmailBody = body;
@@ -1032,7 +1255,7 @@ hideError() {
 
             console.log('💾 Saving email for:', email, saveEmailRequestBody);
 
-            const response = await fetch(`${this.cacheServerUrl}/cache/savemail/${encodeURIComponent(email.toLowerCase())}`, {
+            const response = await this.serverFetch(`/cache/savemail/${encodeURIComponent(email.toLowerCase())}`, {
                 method: 'POST',
                 headers: {
                     'Content-Type': 'application/json',
@@ -1084,7 +1307,7 @@ hideError() {
         try {
             console.log('📧 Retrieving saved email for:', email);
             
-            const response = await fetch(`${this.cacheServerUrl}/cache/savemail/${encodeURIComponent(email.toLowerCase())}`, {
+            const response = await this.serverFetch(`/cache/savemail/${encodeURIComponent(email.toLowerCase())}`, {
                 method: 'GET',
                 headers: {
                     'Content-Type': 'application/json',
@@ -1168,7 +1391,7 @@ hideError() {
         try {
             console.log('📊 Fetching leads count from server...');
             
-            const response = await fetch(`${this.cacheServerUrl}/leads/count`, {
+            const response = await this.serverFetch(`/leads/count`, {
                 method: 'GET',
                 headers: {
                     'Content-Type': 'application/json'
@@ -31,8 +31,6 @@ fi
 if [ -f "./cache-server" ]; then
     echo "⚡ Starting cache server..."
     ./cache-server
-    echo " python server "
-    python pythonserver.py
 else
     echo "🔨 Binary not found, building first..."
     if [ -f "main.go" ]; then
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"strings"
+)
+
+// LeadStats is everything /stats and /leads/count report, computed by the store.
+type LeadStats struct {
+	Total           int64
+	NewestEntry     int64
+	OldestEntry     int64
+	ValidUnexported int64
+	ValidExported   int64
+	Invalid         int64
+	// PerList counts valid, unexported leads per listLeadBelongsTo.
+	PerList map[string]int64
+}
+
+const (
+	counterTotal           = "total"
+	counterValidUnexported = "validUnexported"
+	counterValidExported   = "validExported"
+	counterInvalid         = "invalid"
+	counterListPrefix      = "list:"
+)
+
+// leadCounters returns the counters a single lead contributes to LeadStats.
+// Stores that maintain counters incrementally apply the difference between the
+// old and new value of a lead.
+func leadCounters(data *CachedData) map[string]int64 {
+	if data == nil {
+		return nil
+	}
+	counters := map[string]int64{counterTotal: 1}
+
+	lead := &data.LeadData
+	switch {
+	case lead.EmailStatus != EMAIL_STATUS_VALID:
+		counters[counterInvalid] = 1
+	case lead.Exported:
+		counters[counterValidExported] = 1
+	default:
+		counters[counterValidUnexported] = 1
+		if lead.List != "" {
+			counters[counterListPrefix+lead.List] = 1
+		}
+	}
+	return counters
+}
+
+// counterDelta returns new minus old for every counter either lead touches.
+func counterDelta(old, new *CachedData) map[string]int64 {
+	delta := make(map[string]int64)
+	for name, value := range leadCounters(new) {
+		delta[name] += value
+	}
+	for name, value := range leadCounters(old) {
+		delta[name] -= value
+	}
+	for name, value := range delta {
+		if value == 0 {
+			delete(delta, name)
+		}
+	}
+	return delta
+}
+
+func statsFromCounters(counters map[string]int64) *LeadStats {
+	stats := &LeadStats{
+		Total:           counters[counterTotal],
+		ValidUnexported: counters[counterValidUnexported],
+		ValidExported:   counters[counterValidExported],
+		Invalid:         counters[counterInvalid],
+		PerList:         make(map[string]int64),
+	}
+	for name, value := range counters {
+		if list, ok := strings.CutPrefix(name, counterListPrefix); ok && value > 0 {
+			stats.PerList[list] = value
+		}
+	}
+	return stats
+}
+
+// computeLeadStats derives LeadStats from a full list of leads, for backends
+// small enough that a scan is cheap.
+func computeLeadStats(leads []*CachedData) *LeadStats {
+	counters := make(map[string]int64)
+	var newest, oldest int64
+	for _, lead := range leads {
+		for name, value := range leadCounters(lead) {
+			counters[name] += value
+		}
+		if lead.Timestamp > newest {
+			newest = lead.Timestamp
+		}
+		if oldest == 0 || lead.Timestamp < oldest {
+			oldest = lead.Timestamp
+		}
+	}
+
+	stats := statsFromCounters(counters)
+	stats.NewestEntry = newest
+	stats.OldestEntry = oldest
+	return stats
+}
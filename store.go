@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrNotFound is returned by a LeadStore when the requested lead or email does not exist.
+var ErrNotFound = errors.New("not found")
+
+// LeadStore persists cached leads and saved emails. Handlers on CacheServer only
+// talk to this interface so the backend can be swapped through configuration.
+type LeadStore interface {
+	// Name identifies the backend in logs and the health check.
+	Name() string
+	Ping(ctx context.Context) error
+	Close() error
+
+	GetLead(ctx context.Context, email string) (*CachedData, error)
+	// GetLeads reads several leads in one round trip. Emails that are not
+	// cached are left out of the result.
+	GetLeads(ctx context.Context, emails []string) (map[string]*CachedData, error)
+	SaveLead(ctx context.Context, data *CachedData) error
+	DeleteLead(ctx context.Context, email string) (bool, error)
+	ListLeads(ctx context.Context) ([]*CachedData, error)
+	ClearLeads(ctx context.Context) (int64, error)
+	// LeadStats returns exact totals and per-status/per-list counts.
+	LeadStats(ctx context.Context) (*LeadStats, error)
+	// SetLeadsExported flips the exported flag on all the given leads in a single
+	// transaction and returns how many leads were updated.
+	SetLeadsExported(ctx context.Context, emails []string, exported bool) (int64, error)
+
+	GetEmail(ctx context.Context, email string) (*CachedEmailData, error)
+	SaveEmail(ctx context.Context, data *CachedEmailData) error
+
+	// Records are small JSON documents grouped by collection, used for server
+	// metadata such as export batches.
+	PutRecord(ctx context.Context, collection, id string, value []byte) error
+	GetRecord(ctx context.Context, collection, id string) ([]byte, error)
+	ListRecords(ctx context.Context, collection string) ([][]byte, error)
+	DeleteRecord(ctx context.Context, collection, id string) (bool, error)
+
+	// Workspace returns a store for the named workspace on the same backend,
+	// with its keys under workspacePrefix(name) so no two workspaces share data.
+	// Closing it leaves the backend open.
+	Workspace(ctx context.Context, name string) (LeadStore, error)
+	// GetWorkspaceRecord reads a record of the named workspace straight from its
+	// keys, without opening the workspace. It is called on the default
+	// workspace's store; a workspace never written to has no records.
+	GetWorkspaceRecord(ctx context.Context, workspace, collection, id string) ([]byte, error)
+}
+
+const (
+	STORE_BACKEND_REDIS  = "redis"
+	STORE_BACKEND_MEMORY = "memory"
+	STORE_BACKEND_BOLT   = "bolt"
+)
+
+// putRecordJSON and getRecordJSON wrap the raw record API with JSON encoding.
+func putRecordJSON(ctx context.Context, store LeadStore, collection, id string, value interface{}) error {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return store.PutRecord(ctx, collection, id, raw)
+}
+
+func getRecordJSON(ctx context.Context, store LeadStore, collection, id string, dst interface{}) error {
+	raw, err := store.GetRecord(ctx, collection, id)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, dst)
+}
+
+func getWorkspaceRecordJSON(ctx context.Context, store LeadStore, workspace, collection, id string, dst interface{}) error {
+	raw, err := store.GetWorkspaceRecord(ctx, workspace, collection, id)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, dst)
+}
+
+// NewLeadStore opens the backend selected by cfg.Store.Backend.
+func NewLeadStore(ctx context.Context, cfg *Config) (LeadStore, error) {
+	switch cfg.Store.Backend {
+	case STORE_BACKEND_REDIS:
+		return NewRedisLeadStore(ctx, cfg)
+	case STORE_BACKEND_MEMORY:
+		return NewMemoryLeadStore(), nil
+	case STORE_BACKEND_BOLT:
+		return NewBoltLeadStore(cfg.Store.Path)
+	default:
+		return nil, fmt.Errorf("unknown store backend %q", cfg.Store.Backend)
+	}
+}
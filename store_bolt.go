@@ -0,0 +1,319 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	boltLeadsBucket   = []byte("leads")
+	boltEmailsBucket  = []byte("emails")
+	boltRecordsBucket = []byte("records")
+)
+
+// BoltLeadStore keeps leads and emails in a single BoltDB file so one person can
+// run the server without Redis. A workspace store shares the file and uses
+// buckets named workspacePrefix(name) plus the usual names.
+type BoltLeadStore struct {
+	db      *bolt.DB
+	path    string
+	leads   []byte
+	emails  []byte
+	records []byte
+	// workspace is empty for the store that owns the file
+	workspace string
+}
+
+func NewBoltLeadStore(path string) (*BoltLeadStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open store file %s: %v", path, err)
+	}
+
+	store := &BoltLeadStore{
+		db:      db,
+		path:    path,
+		leads:   boltLeadsBucket,
+		emails:  boltEmailsBucket,
+		records: boltRecordsBucket,
+	}
+	if err := store.createBuckets(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize store file %s: %v", path, err)
+	}
+
+	log.Printf("✅ Opened embedded store at %s", path)
+	return store, nil
+}
+
+func (b *BoltLeadStore) createBuckets() error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{b.leads, b.emails, b.records} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (b *BoltLeadStore) Name() string {
+	return STORE_BACKEND_BOLT
+}
+
+func (b *BoltLeadStore) Ping(ctx context.Context) error {
+	return b.db.View(func(tx *bolt.Tx) error { return nil })
+}
+
+func (b *BoltLeadStore) Close() error {
+	if b.workspace != "" {
+		return nil
+	}
+	return b.db.Close()
+}
+
+func (b *BoltLeadStore) Workspace(ctx context.Context, name string) (LeadStore, error) {
+	prefix := workspacePrefix(name)
+	store := &BoltLeadStore{
+		db:        b.db,
+		path:      b.path,
+		leads:     []byte(prefix + string(boltLeadsBucket)),
+		emails:    []byte(prefix + string(boltEmailsBucket)),
+		records:   []byte(prefix + string(boltRecordsBucket)),
+		workspace: name,
+	}
+	if err := store.createBuckets(); err != nil {
+		return nil, fmt.Errorf("failed to create buckets for workspace %s: %v", name, err)
+	}
+	return store, nil
+}
+
+func (b *BoltLeadStore) GetLead(ctx context.Context, email string) (*CachedData, error) {
+	var data CachedData
+	if err := b.get(b.leads, email, &data); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+func (b *BoltLeadStore) GetLeads(ctx context.Context, emails []string) (map[string]*CachedData, error) {
+	leads := make(map[string]*CachedData, len(emails))
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(b.leads)
+		for _, email := range emails {
+			raw := bucket.Get([]byte(email))
+			if raw == nil {
+				continue
+			}
+			var data CachedData
+			if err := json.Unmarshal(raw, &data); err != nil {
+				log.Printf("⚠️ Skipping lead %s: %v", email, err)
+				continue
+			}
+			leads[email] = &data
+		}
+		return nil
+	})
+	return leads, err
+}
+
+func (b *BoltLeadStore) SaveLead(ctx context.Context, data *CachedData) error {
+	return b.set(b.leads, data.Email, data)
+}
+
+func (b *BoltLeadStore) DeleteLead(ctx context.Context, email string) (bool, error) {
+	var existed bool
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(b.leads)
+		existed = bucket.Get([]byte(email)) != nil
+		return bucket.Delete([]byte(email))
+	})
+	return existed, err
+}
+
+func (b *BoltLeadStore) ListLeads(ctx context.Context) ([]*CachedData, error) {
+	var leads []*CachedData
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(b.leads).ForEach(func(k, v []byte) error {
+			var data CachedData
+			if err := json.Unmarshal(v, &data); err != nil {
+				log.Printf("⚠️ Skipping lead %s: %v", k, err)
+				return nil
+			}
+			leads = append(leads, &data)
+			return nil
+		})
+	})
+	return leads, err
+}
+
+func (b *BoltLeadStore) ClearLeads(ctx context.Context) (int64, error) {
+	var deleted int64
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		deleted = int64(tx.Bucket(b.leads).Stats().KeyN)
+		if err := tx.DeleteBucket(b.leads); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucket(b.leads)
+		return err
+	})
+	return deleted, err
+}
+
+// LeadStats scans the leads bucket; a single-user database is small enough
+// that maintaining separate counters isn't worth it.
+func (b *BoltLeadStore) LeadStats(ctx context.Context) (*LeadStats, error) {
+	leads, err := b.ListLeads(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return computeLeadStats(leads), nil
+}
+
+func (b *BoltLeadStore) SetLeadsExported(ctx context.Context, emails []string, exported bool) (int64, error) {
+	var updated int64
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(b.leads)
+		for _, email := range emails {
+			raw := bucket.Get([]byte(email))
+			if raw == nil {
+				continue
+			}
+			var data CachedData
+			if err := json.Unmarshal(raw, &data); err != nil {
+				return fmt.Errorf("failed to parse lead %s: %v", email, err)
+			}
+			setExported(&data, exported)
+			raw, err := json.Marshal(&data)
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put([]byte(email), raw); err != nil {
+				return err
+			}
+			updated++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return updated, nil
+}
+
+func (b *BoltLeadStore) GetEmail(ctx context.Context, email string) (*CachedEmailData, error) {
+	var data CachedEmailData
+	if err := b.get(b.emails, email, &data); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+func (b *BoltLeadStore) SaveEmail(ctx context.Context, data *CachedEmailData) error {
+	return b.set(b.emails, data.Email, data)
+}
+
+// Records live in one nested bucket per collection under "records".
+func (b *BoltLeadStore) PutRecord(ctx context.Context, collection, id string, value []byte) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.Bucket(b.records).CreateBucketIfNotExists([]byte(collection))
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(id), value)
+	})
+}
+
+func (b *BoltLeadStore) GetRecord(ctx context.Context, collection, id string) ([]byte, error) {
+	var value []byte
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(b.records).Bucket([]byte(collection))
+		if bucket == nil {
+			return ErrNotFound
+		}
+		raw := bucket.Get([]byte(id))
+		if raw == nil {
+			return ErrNotFound
+		}
+		value = append([]byte(nil), raw...)
+		return nil
+	})
+	return value, err
+}
+
+func (b *BoltLeadStore) GetWorkspaceRecord(ctx context.Context, workspace, collection, id string) ([]byte, error) {
+	if workspace == DEFAULT_WORKSPACE {
+		return b.GetRecord(ctx, collection, id)
+	}
+	var value []byte
+	err := b.db.View(func(tx *bolt.Tx) error {
+		records := tx.Bucket([]byte(workspacePrefix(workspace) + string(boltRecordsBucket)))
+		if records == nil {
+			return ErrNotFound
+		}
+		bucket := records.Bucket([]byte(collection))
+		if bucket == nil {
+			return ErrNotFound
+		}
+		raw := bucket.Get([]byte(id))
+		if raw == nil {
+			return ErrNotFound
+		}
+		value = append([]byte(nil), raw...)
+		return nil
+	})
+	return value, err
+}
+
+func (b *BoltLeadStore) ListRecords(ctx context.Context, collection string) ([][]byte, error) {
+	var records [][]byte
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(b.records).Bucket([]byte(collection))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			records = append(records, append([]byte(nil), v...))
+			return nil
+		})
+	})
+	return records, err
+}
+
+func (b *BoltLeadStore) DeleteRecord(ctx context.Context, collection, id string) (bool, error) {
+	var existed bool
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(b.records).Bucket([]byte(collection))
+		if bucket == nil {
+			return nil
+		}
+		existed = bucket.Get([]byte(id)) != nil
+		return bucket.Delete([]byte(id))
+	})
+	return existed, err
+}
+
+func (b *BoltLeadStore) get(bucket []byte, key string, dst interface{}) error {
+	return b.db.View(func(tx *bolt.Tx) error {
+		raw := tx.Bucket(bucket).Get([]byte(key))
+		if raw == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(raw, dst)
+	})
+}
+
+func (b *BoltLeadStore) set(bucket []byte, key string, value interface{}) error {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).Put([]byte(key), raw)
+	})
+}
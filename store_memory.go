@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+)
+
+// MemoryLeadStore keeps everything in process memory. It is meant for tests and
+// offline demos; all data is lost when the server stops.
+type MemoryLeadStore struct {
+	mu      sync.RWMutex
+	leads   map[string][]byte
+	emails  map[string][]byte
+	records map[string]map[string][]byte
+	// workspaces holds a separate store per workspace
+	workspaces map[string]*MemoryLeadStore
+}
+
+func NewMemoryLeadStore() *MemoryLeadStore {
+	return &MemoryLeadStore{
+		leads:      make(map[string][]byte),
+		emails:     make(map[string][]byte),
+		records:    make(map[string]map[string][]byte),
+		workspaces: make(map[string]*MemoryLeadStore),
+	}
+}
+
+func (m *MemoryLeadStore) Name() string {
+	return STORE_BACKEND_MEMORY
+}
+
+func (m *MemoryLeadStore) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (m *MemoryLeadStore) Close() error {
+	return nil
+}
+
+func (m *MemoryLeadStore) Workspace(ctx context.Context, name string) (LeadStore, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	store, exists := m.workspaces[name]
+	if !exists {
+		store = NewMemoryLeadStore()
+		m.workspaces[name] = store
+	}
+	return store, nil
+}
+
+func (m *MemoryLeadStore) GetLead(ctx context.Context, email string) (*CachedData, error) {
+	var data CachedData
+	if err := m.get(memoryLeads, email, &data); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+func (m *MemoryLeadStore) GetLeads(ctx context.Context, emails []string) (map[string]*CachedData, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	leads := make(map[string]*CachedData, len(emails))
+	for _, email := range emails {
+		raw, exists := m.bucket(memoryLeads)[email]
+		if !exists {
+			continue
+		}
+		var data CachedData
+		if err := json.Unmarshal(raw, &data); err != nil {
+			return nil, err
+		}
+		leads[email] = &data
+	}
+	return leads, nil
+}
+
+func (m *MemoryLeadStore) SaveLead(ctx context.Context, data *CachedData) error {
+	return m.set(memoryLeads, data.Email, data)
+}
+
+func (m *MemoryLeadStore) DeleteLead(ctx context.Context, email string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, exists := m.leads[email]
+	delete(m.leads, email)
+	return exists, nil
+}
+
+func (m *MemoryLeadStore) ListLeads(ctx context.Context) ([]*CachedData, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	leads := make([]*CachedData, 0, len(m.leads))
+	for _, raw := range m.leads {
+		var data CachedData
+		if err := json.Unmarshal(raw, &data); err != nil {
+			continue
+		}
+		leads = append(leads, &data)
+	}
+	return leads, nil
+}
+
+func (m *MemoryLeadStore) ClearLeads(ctx context.Context) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	deleted := int64(len(m.leads))
+	m.leads = make(map[string][]byte)
+	return deleted, nil
+}
+
+func (m *MemoryLeadStore) LeadStats(ctx context.Context) (*LeadStats, error) {
+	leads, err := m.ListLeads(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return computeLeadStats(leads), nil
+}
+
+func (m *MemoryLeadStore) SetLeadsExported(ctx context.Context, emails []string, exported bool) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	updated := make(map[string][]byte, len(emails))
+	for _, email := range emails {
+		raw, exists := m.leads[email]
+		if !exists {
+			continue
+		}
+		var data CachedData
+		if err := json.Unmarshal(raw, &data); err != nil {
+			return 0, err
+		}
+		setExported(&data, exported)
+		encoded, err := json.Marshal(&data)
+		if err != nil {
+			return 0, err
+		}
+		updated[email] = encoded
+	}
+
+	for email, raw := range updated {
+		m.leads[email] = raw
+	}
+	return int64(len(updated)), nil
+}
+
+func (m *MemoryLeadStore) GetEmail(ctx context.Context, email string) (*CachedEmailData, error) {
+	var data CachedEmailData
+	if err := m.get(memoryEmails, email, &data); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+func (m *MemoryLeadStore) SaveEmail(ctx context.Context, data *CachedEmailData) error {
+	return m.set(memoryEmails, data.Email, data)
+}
+
+func (m *MemoryLeadStore) PutRecord(ctx context.Context, collection, id string, value []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.records[collection] == nil {
+		m.records[collection] = make(map[string][]byte)
+	}
+	m.records[collection][id] = append([]byte(nil), value...)
+	return nil
+}
+
+func (m *MemoryLeadStore) GetRecord(ctx context.Context, collection, id string) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	raw, exists := m.records[collection][id]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	return append([]byte(nil), raw...), nil
+}
+
+func (m *MemoryLeadStore) GetWorkspaceRecord(ctx context.Context, workspace, collection, id string) ([]byte, error) {
+	if workspace == DEFAULT_WORKSPACE {
+		return m.GetRecord(ctx, collection, id)
+	}
+	m.mu.RLock()
+	store, exists := m.workspaces[workspace]
+	m.mu.RUnlock()
+	if !exists {
+		return nil, ErrNotFound
+	}
+	return store.GetRecord(ctx, collection, id)
+}
+
+func (m *MemoryLeadStore) ListRecords(ctx context.Context, collection string) ([][]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	records := make([][]byte, 0, len(m.records[collection]))
+	for _, raw := range m.records[collection] {
+		records = append(records, append([]byte(nil), raw...))
+	}
+	return records, nil
+}
+
+func (m *MemoryLeadStore) DeleteRecord(ctx context.Context, collection, id string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, exists := m.records[collection][id]
+	delete(m.records[collection], id)
+	return exists, nil
+}
+
+// memoryBucket selects the leads or emails map. The map itself is only looked
+// up under the lock, since ClearLeads replaces it.
+type memoryBucket int
+
+const (
+	memoryLeads memoryBucket = iota
+	memoryEmails
+)
+
+func (m *MemoryLeadStore) bucket(b memoryBucket) map[string][]byte {
+	if b == memoryEmails {
+		return m.emails
+	}
+	return m.leads
+}
+
+// Values are stored serialized so callers never share mutable maps with the store.
+func (m *MemoryLeadStore) get(b memoryBucket, key string, dst interface{}) error {
+	m.mu.RLock()
+	raw, exists := m.bucket(b)[key]
+	m.mu.RUnlock()
+
+	if !exists {
+		return ErrNotFound
+	}
+	return json.Unmarshal(raw, dst)
+}
+
+func (m *MemoryLeadStore) set(b memoryBucket, key string, value interface{}) error {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	m.bucket(b)[key] = raw
+	m.mu.Unlock()
+	return nil
+}
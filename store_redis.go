@@ -0,0 +1,586 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// LEAD_INDEX_VERSION is bumped whenever the index layout changes, which makes
+	// the next startup rebuild every index from the lead keys.
+	LEAD_INDEX_VERSION = "1"
+
+	redisScanCount = 500
+)
+
+// RedisLeadStore keeps each lead and email as a JSON string under a prefixed key,
+// the same layout the extension and the Python scripts have always used.
+//
+// Next to the leads it maintains secondary indexes, updated in the same MULTI as
+// every lead write, so stats and counts never have to walk the keyspace:
+//
+//	<recordPrefix>index:leads:bytime         sorted set of emails scored by timestamp
+//	<recordPrefix>index:leads:status:<s>     set of emails per emailStatus
+//	<recordPrefix>index:leads:list:<name>    set of emails per listLeadBelongsTo
+//	<recordPrefix>index:leads:counters       hash of the counters behind LeadStats
+//
+// A workspace store shares the client and puts workspacePrefix(name) in front
+// of all three prefixes.
+type RedisLeadStore struct {
+	client       *redis.Client
+	leadPrefix   string
+	emailPrefix  string
+	recordPrefix string
+	// workspace is empty for the store that owns the client
+	workspace string
+}
+
+func NewRedisLeadStore(ctx context.Context, cfg *Config) (*RedisLeadStore, error) {
+	options := &redis.Options{
+		Addr:         cfg.Redis.Addr,
+		Username:     cfg.Redis.Username,
+		Password:     cfg.Redis.Password,
+		DB:           cfg.Redis.DB,
+		DialTimeout:  time.Duration(cfg.Redis.DialTimeout),
+		ReadTimeout:  time.Duration(cfg.Redis.ReadTimeout),
+		WriteTimeout: time.Duration(cfg.Redis.WriteTimeout),
+		PoolSize:     cfg.Redis.PoolSize,
+		MinIdleConns: cfg.Redis.MinIdleConns,
+		PoolTimeout:  time.Duration(cfg.Redis.PoolTimeout),
+	}
+	if cfg.Redis.TLS {
+		options.TLSConfig = &tls.Config{
+			MinVersion:         tls.VersionTLS12,
+			InsecureSkipVerify: cfg.Redis.TLSSkipVerify,
+		}
+	}
+	rdb := redis.NewClient(options)
+
+	// Test Redis connection
+	if _, err := rdb.Ping(ctx).Result(); err != nil {
+		rdb.Close()
+		return nil, fmt.Errorf("failed to connect to Redis at %s: %v", cfg.Redis.Addr, err)
+	}
+
+	log.Printf("✅ Connected to Redis at %s successfully", cfg.Redis.Addr)
+
+	store := &RedisLeadStore{
+		client:       rdb,
+		leadPrefix:   cfg.Keys.LeadPrefix,
+		emailPrefix:  cfg.Keys.EmailPrefix,
+		recordPrefix: cfg.Keys.RecordPrefix,
+	}
+
+	if err := store.checkIndexes(ctx); err != nil {
+		rdb.Close()
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// checkIndexes rebuilds the lead indexes when they are missing or outdated,
+// such as for leads written before the indexes existed.
+func (r *RedisLeadStore) checkIndexes(ctx context.Context) error {
+	version, err := r.client.Get(ctx, r.indexKey("version")).Result()
+	if err != nil && err != redis.Nil {
+		return fmt.Errorf("failed to read lead index version: %v", err)
+	}
+	if version != LEAD_INDEX_VERSION {
+		log.Printf("🔧 Rebuilding lead indexes under %q (found version %q, want %q)...", r.recordPrefix, version, LEAD_INDEX_VERSION)
+		count, err := r.RebuildIndexes(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to rebuild lead indexes: %v", err)
+		}
+		log.Printf("✅ Indexed %d leads", count)
+	}
+	return nil
+}
+
+func (r *RedisLeadStore) Name() string {
+	return STORE_BACKEND_REDIS
+}
+
+func (r *RedisLeadStore) Ping(ctx context.Context) error {
+	return r.client.Ping(ctx).Err()
+}
+
+func (r *RedisLeadStore) Close() error {
+	if r.workspace != "" {
+		return nil
+	}
+	return r.client.Close()
+}
+
+func (r *RedisLeadStore) Workspace(ctx context.Context, name string) (LeadStore, error) {
+	prefix := workspacePrefix(name)
+	store := &RedisLeadStore{
+		client:       r.client,
+		leadPrefix:   prefix + r.leadPrefix,
+		emailPrefix:  prefix + r.emailPrefix,
+		recordPrefix: prefix + r.recordPrefix,
+		workspace:    name,
+	}
+	if err := store.checkIndexes(ctx); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+func (r *RedisLeadStore) GetLead(ctx context.Context, email string) (*CachedData, error) {
+	var data CachedData
+	if err := r.getJSON(ctx, r.leadPrefix+email, &data); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+// GetLeads fetches all the leads with a single MGET.
+func (r *RedisLeadStore) GetLeads(ctx context.Context, emails []string) (map[string]*CachedData, error) {
+	leads := make(map[string]*CachedData, len(emails))
+	if len(emails) == 0 {
+		return leads, nil
+	}
+	keys := make([]string, len(emails))
+	for i, email := range emails {
+		keys[i] = r.leadPrefix + email
+	}
+	values, err := r.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	for i, value := range values {
+		raw, ok := value.(string)
+		if !ok {
+			continue // Not cached
+		}
+		var data CachedData
+		if err := json.Unmarshal([]byte(raw), &data); err != nil {
+			log.Printf("⚠️ Skipping lead %s: %v", keys[i], err)
+			continue
+		}
+		leads[emails[i]] = &data
+	}
+	return leads, nil
+}
+
+func (r *RedisLeadStore) SaveLead(ctx context.Context, data *CachedData) error {
+	key := r.leadPrefix + data.Email
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to serialize %s: %v", key, err)
+	}
+
+	return r.watch(ctx, func(tx *redis.Tx) error {
+		old, err := r.readLead(ctx, tx, key)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			// Set with no expiration (permanent cache)
+			pipe.Set(ctx, key, raw, 0)
+			r.updateIndexes(ctx, pipe, data.Email, old, data)
+			return nil
+		})
+		return err
+	}, key)
+}
+
+func (r *RedisLeadStore) DeleteLead(ctx context.Context, email string) (bool, error) {
+	key := r.leadPrefix + email
+	var deleted bool
+	err := r.watch(ctx, func(tx *redis.Tx) error {
+		old, err := r.readLead(ctx, tx, key)
+		if err != nil {
+			return err
+		}
+		var del *redis.IntCmd
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			del = pipe.Del(ctx, key)
+			r.updateIndexes(ctx, pipe, email, old, nil)
+			return nil
+		})
+		// An unreadable blob has no old value but is deleted all the same
+		deleted = err == nil && del.Val() > 0
+		return err
+	}, key)
+	return deleted, err
+}
+
+// ListLeads walks the lead keys with SCAN and fetches them in MGET batches, so
+// Redis is never blocked the way KEYS blocks it.
+func (r *RedisLeadStore) ListLeads(ctx context.Context) ([]*CachedData, error) {
+	var leads []*CachedData
+	err := r.scanLeads(ctx, func(keys []string, values []interface{}) error {
+		for i, value := range values {
+			raw, ok := value.(string)
+			if !ok {
+				continue // Key doesn't exist anymore
+			}
+			var data CachedData
+			if err := json.Unmarshal([]byte(raw), &data); err != nil {
+				log.Printf("⚠️ Skipping lead %s: %v", keys[i], err)
+				continue
+			}
+			leads = append(leads, &data)
+		}
+		return nil
+	})
+	return leads, err
+}
+
+// ClearLeads deletes the leads batch by batch as SCAN finds them. Each batch is
+// removed together with its index entries in one WATCH/MULTI, so a SaveLead
+// running at the same time can never leave the indexes out of step.
+func (r *RedisLeadStore) ClearLeads(ctx context.Context) (int64, error) {
+	var deleted int64
+	err := r.scanKeys(ctx, r.leadPrefix+"*", func(keys []string) error {
+		n, err := r.deleteLeads(ctx, keys)
+		deleted += n
+		return err
+	})
+	return deleted, err
+}
+
+// deleteLeads removes the given lead keys and their index entries atomically,
+// as DeleteLead does for a single lead.
+func (r *RedisLeadStore) deleteLeads(ctx context.Context, keys []string) (int64, error) {
+	var deleted int64
+	err := r.watch(ctx, func(tx *redis.Tx) error {
+		values, err := tx.MGet(ctx, keys...).Result()
+		if err != nil {
+			return err
+		}
+
+		var n int64
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			for i, value := range values {
+				raw, ok := value.(string)
+				if !ok {
+					continue // Deleted in the meantime
+				}
+				n++
+				var old *CachedData
+				var data CachedData
+				if err := json.Unmarshal([]byte(raw), &data); err == nil {
+					old = &data
+				}
+				pipe.Del(ctx, keys[i])
+				r.updateIndexes(ctx, pipe, strings.TrimPrefix(keys[i], r.leadPrefix), old, nil)
+			}
+			return nil
+		})
+		if err == nil {
+			deleted = n
+		}
+		return err
+	}, keys...)
+	return deleted, err
+}
+
+// LeadStats reads the maintained counters and the ends of the timestamp index,
+// which is constant work no matter how many leads are stored.
+func (r *RedisLeadStore) LeadStats(ctx context.Context) (*LeadStats, error) {
+	pipe := r.client.Pipeline()
+	countersCmd := pipe.HGetAll(ctx, r.indexKey("counters"))
+	oldestCmd := pipe.ZRangeWithScores(ctx, r.indexKey("bytime"), 0, 0)
+	newestCmd := pipe.ZRevRangeWithScores(ctx, r.indexKey("bytime"), 0, 0)
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	counters := make(map[string]int64)
+	for name, value := range countersCmd.Val() {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("corrupt lead counter %s=%q", name, value)
+		}
+		counters[name] = n
+	}
+
+	stats := statsFromCounters(counters)
+	if oldest := oldestCmd.Val(); len(oldest) > 0 {
+		stats.OldestEntry = int64(oldest[0].Score)
+	}
+	if newest := newestCmd.Val(); len(newest) > 0 {
+		stats.NewestEntry = int64(newest[0].Score)
+	}
+	return stats, nil
+}
+
+// RebuildIndexes recomputes every index from the lead keys. It runs at startup
+// when the index version is missing or outdated.
+func (r *RedisLeadStore) RebuildIndexes(ctx context.Context) (int64, error) {
+	if err := r.dropIndexes(ctx); err != nil {
+		return 0, err
+	}
+
+	var indexed int64
+	err := r.scanLeads(ctx, func(keys []string, values []interface{}) error {
+		pipe := r.client.TxPipeline()
+		for i, value := range values {
+			raw, ok := value.(string)
+			if !ok {
+				continue
+			}
+			var data CachedData
+			if err := json.Unmarshal([]byte(raw), &data); err != nil {
+				log.Printf("⚠️ Not indexing lead %s: %v", keys[i], err)
+				continue
+			}
+			r.updateIndexes(ctx, pipe, strings.TrimPrefix(keys[i], r.leadPrefix), nil, &data)
+			indexed++
+		}
+		_, err := pipe.Exec(ctx)
+		return err
+	})
+	if err != nil {
+		return indexed, err
+	}
+
+	return indexed, r.client.Set(ctx, r.indexKey("version"), LEAD_INDEX_VERSION, 0).Err()
+}
+
+// SetLeadsExported uses WATCH/MULTI so either every lead is updated or, if any of
+// them changed concurrently, none are and the caller can retry.
+func (r *RedisLeadStore) SetLeadsExported(ctx context.Context, emails []string, exported bool) (int64, error) {
+	if len(emails) == 0 {
+		return 0, nil
+	}
+
+	keys := make([]string, len(emails))
+	for i, email := range emails {
+		keys[i] = r.leadPrefix + email
+	}
+
+	var updated int64
+	err := r.watch(ctx, func(tx *redis.Tx) error {
+		values, err := tx.MGet(ctx, keys...).Result()
+		if err != nil {
+			return err
+		}
+
+		type change struct {
+			old, new *CachedData
+			raw      []byte
+		}
+		changed := make(map[string]change, len(keys))
+		for i, value := range values {
+			raw, ok := value.(string)
+			if !ok {
+				continue // Lead was deleted in the meantime
+			}
+			var old, data CachedData
+			if err := json.Unmarshal([]byte(raw), &old); err != nil {
+				return fmt.Errorf("failed to parse %s: %v", keys[i], err)
+			}
+			data = old
+			setExported(&data, exported)
+			encoded, err := json.Marshal(&data)
+			if err != nil {
+				return err
+			}
+			changed[emails[i]] = change{old: &old, new: &data, raw: encoded}
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			for email, c := range changed {
+				pipe.Set(ctx, r.leadPrefix+email, c.raw, 0)
+				r.updateIndexes(ctx, pipe, email, c.old, c.new)
+			}
+			return nil
+		})
+		if err == nil {
+			updated = int64(len(changed))
+		}
+		return err
+	}, keys...)
+	if err != nil {
+		return 0, err
+	}
+	return updated, nil
+}
+
+func (r *RedisLeadStore) GetEmail(ctx context.Context, email string) (*CachedEmailData, error) {
+	var data CachedEmailData
+	if err := r.getJSON(ctx, r.emailPrefix+email, &data); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+func (r *RedisLeadStore) SaveEmail(ctx context.Context, data *CachedEmailData) error {
+	return r.setJSON(ctx, r.emailPrefix+data.Email, data)
+}
+
+func (r *RedisLeadStore) indexKey(name string) string {
+	return r.recordPrefix + "index:leads:" + name
+}
+
+// updateIndexes queues the index changes for one lead going from old to new;
+// either may be nil for a create or a delete.
+func (r *RedisLeadStore) updateIndexes(ctx context.Context, pipe redis.Pipeliner, email string, old, new *CachedData) {
+	if old != nil {
+		pipe.SRem(ctx, r.indexKey("status:"+old.LeadData.EmailStatus), email)
+		if old.LeadData.List != "" {
+			pipe.SRem(ctx, r.indexKey("list:"+old.LeadData.List), email)
+		}
+	}
+
+	if new != nil {
+		pipe.ZAdd(ctx, r.indexKey("bytime"), redis.Z{Score: float64(new.Timestamp), Member: email})
+		pipe.SAdd(ctx, r.indexKey("status:"+new.LeadData.EmailStatus), email)
+		if new.LeadData.List != "" {
+			pipe.SAdd(ctx, r.indexKey("list:"+new.LeadData.List), email)
+		}
+	} else {
+		pipe.ZRem(ctx, r.indexKey("bytime"), email)
+	}
+
+	for name, delta := range counterDelta(old, new) {
+		pipe.HIncrBy(ctx, r.indexKey("counters"), name, delta)
+	}
+}
+
+func (r *RedisLeadStore) dropIndexes(ctx context.Context) error {
+	return r.scanKeys(ctx, r.indexKey("*"), func(keys []string) error {
+		return r.client.Del(ctx, keys...).Err()
+	})
+}
+
+// readLead returns the current value of a watched lead key, or nil if it doesn't exist.
+func (r *RedisLeadStore) readLead(ctx context.Context, tx *redis.Tx, key string) (*CachedData, error) {
+	raw, err := tx.Get(ctx, key).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var data CachedData
+	if err := json.Unmarshal([]byte(raw), &data); err != nil {
+		// An unreadable blob contributes nothing to the indexes; overwrite it
+		log.Printf("⚠️ Replacing unreadable lead %s: %v", key, err)
+		return nil, nil
+	}
+	return &data, nil
+}
+
+// watch runs fn in a WATCH transaction, retrying when a watched key changes underneath it.
+func (r *RedisLeadStore) watch(ctx context.Context, fn func(*redis.Tx) error, keys ...string) error {
+	const maxAttempts = 5
+	var err error
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		err = r.client.Watch(ctx, fn, keys...)
+		if err != redis.TxFailedErr {
+			return err
+		}
+	}
+	return err
+}
+
+// scanKeys calls fn with batches of keys matching pattern, using SCAN.
+func (r *RedisLeadStore) scanKeys(ctx context.Context, pattern string, fn func(keys []string) error) error {
+	var cursor uint64
+	for {
+		keys, next, err := r.client.Scan(ctx, cursor, pattern, redisScanCount).Result()
+		if err != nil {
+			return err
+		}
+		if len(keys) > 0 {
+			if err := fn(keys); err != nil {
+				return err
+			}
+		}
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// scanLeads calls fn with batches of lead keys and their values.
+func (r *RedisLeadStore) scanLeads(ctx context.Context, fn func(keys []string, values []interface{}) error) error {
+	return r.scanKeys(ctx, r.leadPrefix+"*", func(keys []string) error {
+		values, err := r.client.MGet(ctx, keys...).Result()
+		if err != nil {
+			return err
+		}
+		return fn(keys, values)
+	})
+}
+
+// Each record collection is one hash, keyed by record id.
+func (r *RedisLeadStore) PutRecord(ctx context.Context, collection, id string, value []byte) error {
+	return r.client.HSet(ctx, r.recordPrefix+collection, id, value).Err()
+}
+
+func (r *RedisLeadStore) GetRecord(ctx context.Context, collection, id string) ([]byte, error) {
+	value, err := r.client.HGet(ctx, r.recordPrefix+collection, id).Bytes()
+	if err == redis.Nil {
+		return nil, ErrNotFound
+	}
+	return value, err
+}
+
+func (r *RedisLeadStore) GetWorkspaceRecord(ctx context.Context, workspace, collection, id string) ([]byte, error) {
+	if workspace == DEFAULT_WORKSPACE {
+		return r.GetRecord(ctx, collection, id)
+	}
+	value, err := r.client.HGet(ctx, workspacePrefix(workspace)+r.recordPrefix+collection, id).Bytes()
+	if err == redis.Nil {
+		return nil, ErrNotFound
+	}
+	return value, err
+}
+
+func (r *RedisLeadStore) ListRecords(ctx context.Context, collection string) ([][]byte, error) {
+	values, err := r.client.HVals(ctx, r.recordPrefix+collection).Result()
+	if err != nil {
+		return nil, err
+	}
+	records := make([][]byte, len(values))
+	for i, value := range values {
+		records[i] = []byte(value)
+	}
+	return records, nil
+}
+
+func (r *RedisLeadStore) DeleteRecord(ctx context.Context, collection, id string) (bool, error) {
+	deleted, err := r.client.HDel(ctx, r.recordPrefix+collection, id).Result()
+	if err != nil {
+		return false, err
+	}
+	return deleted > 0, nil
+}
+
+func (r *RedisLeadStore) getJSON(ctx context.Context, key string, dst interface{}) error {
+	value, err := r.client.Get(ctx, key).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return ErrNotFound
+		}
+		return err
+	}
+	if err := json.Unmarshal([]byte(value), dst); err != nil {
+		return fmt.Errorf("failed to parse %s: %v", key, err)
+	}
+	return nil
+}
+
+func (r *RedisLeadStore) setJSON(ctx context.Context, key string, value interface{}) error {
+	dataJSON, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to serialize %s: %v", key, err)
+	}
+	// Set with no expiration (permanent cache)
+	return r.client.Set(ctx, key, dataJSON, 0).Err()
+}
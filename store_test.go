@@ -0,0 +1,349 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// TestLeadStoreContract runs the same behaviour checks against every backend.
+// Redis is only exercised when LEAD_STORE_TEST_REDIS_ADDR points at a server.
+func TestLeadStoreContract(t *testing.T) {
+	backends := map[string]func(t *testing.T) LeadStore{
+		STORE_BACKEND_MEMORY: func(t *testing.T) LeadStore {
+			return NewMemoryLeadStore()
+		},
+		STORE_BACKEND_BOLT: func(t *testing.T) LeadStore {
+			store, err := NewBoltLeadStore(filepath.Join(t.TempDir(), "leads.db"))
+			if err != nil {
+				t.Fatalf("open bolt store: %v", err)
+			}
+			return store
+		},
+		STORE_BACKEND_REDIS: func(t *testing.T) LeadStore {
+			addr := os.Getenv("LEAD_STORE_TEST_REDIS_ADDR")
+			if addr == "" {
+				t.Skip("LEAD_STORE_TEST_REDIS_ADDR not set")
+			}
+			cfg := DefaultConfig()
+			cfg.Redis.Addr = addr
+			prefix := fmt.Sprintf("leadstoretest:%d:", time.Now().UnixNano())
+			cfg.Keys.LeadPrefix = prefix + "lead:"
+			cfg.Keys.EmailPrefix = prefix + "email:"
+			cfg.Keys.RecordPrefix = prefix + "record:"
+			store, err := NewRedisLeadStore(context.Background(), cfg)
+			if err != nil {
+				t.Fatalf("open redis store: %v", err)
+			}
+			t.Cleanup(func() {
+				ctx := context.Background()
+				store.scanKeys(ctx, prefix+"*", func(keys []string) error {
+					return store.client.Del(ctx, keys...).Err()
+				})
+			})
+			return store
+		},
+	}
+
+	for name, open := range backends {
+		t.Run(name, func(t *testing.T) {
+			store := open(t)
+			t.Cleanup(func() { store.Close() })
+			testLeadStore(t, store)
+		})
+	}
+}
+
+func testLead(email, status, list string, timestamp int64) *CachedData {
+	return &CachedData{
+		Email:     email,
+		Timestamp: timestamp,
+		LeadData: Lead{
+			FirstName:   "Test",
+			Email:       email,
+			EmailStatus: status,
+			List:        list,
+		},
+	}
+}
+
+// putRawLead stores raw as the lead blob of email, bypassing SaveLead.
+func putRawLead(t *testing.T, store LeadStore, email string, raw []byte) {
+	t.Helper()
+	var err error
+	switch s := store.(type) {
+	case *MemoryLeadStore:
+		s.mu.Lock()
+		s.leads[email] = raw
+		s.mu.Unlock()
+	case *BoltLeadStore:
+		err = s.db.Update(func(tx *bolt.Tx) error {
+			return tx.Bucket(s.leads).Put([]byte(email), raw)
+		})
+	case *RedisLeadStore:
+		err = s.client.Set(context.Background(), s.leadPrefix+email, raw, 0).Err()
+	default:
+		t.Fatalf("putRawLead: unsupported store %T", store)
+	}
+	if err != nil {
+		t.Fatalf("putRawLead: %v", err)
+	}
+}
+
+func testLeadStore(t *testing.T, store LeadStore) {
+	ctx := context.Background()
+
+	t.Run("GetLead missing", func(t *testing.T) {
+		if _, err := store.GetLead(ctx, "nobody@example.com"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("GetLead error = %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("SaveLead and GetLead", func(t *testing.T) {
+		if err := store.SaveLead(ctx, testLead("a@example.com", EMAIL_STATUS_VALID, "q1", 1000)); err != nil {
+			t.Fatalf("SaveLead: %v", err)
+		}
+		got, err := store.GetLead(ctx, "a@example.com")
+		if err != nil {
+			t.Fatalf("GetLead: %v", err)
+		}
+		if got.LeadData.FirstName != "Test" || got.LeadData.List != "q1" || got.Timestamp != 1000 {
+			t.Fatalf("GetLead = %+v", got)
+		}
+	})
+
+	t.Run("GetLeads", func(t *testing.T) {
+		got, err := store.GetLeads(ctx, []string{"a@example.com", "nobody@example.com"})
+		if err != nil {
+			t.Fatalf("GetLeads: %v", err)
+		}
+		if len(got) != 1 || got["a@example.com"] == nil || got["a@example.com"].LeadData.List != "q1" {
+			t.Fatalf("GetLeads = %+v, want only a@example.com", got)
+		}
+		if got, err := store.GetLeads(ctx, nil); err != nil || len(got) != 0 {
+			t.Fatalf("GetLeads(nil) = %+v, %v", got, err)
+		}
+	})
+
+	t.Run("stats counters", func(t *testing.T) {
+		if _, err := store.ClearLeads(ctx); err != nil {
+			t.Fatalf("ClearLeads: %v", err)
+		}
+		for _, lead := range []*CachedData{
+			testLead("a@example.com", EMAIL_STATUS_VALID, "q1", 1000),
+			testLead("b@example.com", EMAIL_STATUS_VALID, "q1", 2000),
+			testLead("c@example.com", EMAIL_STATUS_VALID, "q2", 3000),
+			testLead("d@example.com", EMAIL_STATUS_INVALID, "q1", 4000),
+		} {
+			if err := store.SaveLead(ctx, lead); err != nil {
+				t.Fatalf("SaveLead %s: %v", lead.Email, err)
+			}
+		}
+		// Overwriting a lead must move it between counters, not add to them
+		if err := store.SaveLead(ctx, testLead("c@example.com", EMAIL_STATUS_INVALID, "q2", 3000)); err != nil {
+			t.Fatalf("SaveLead overwrite: %v", err)
+		}
+
+		stats, err := store.LeadStats(ctx)
+		if err != nil {
+			t.Fatalf("LeadStats: %v", err)
+		}
+		if stats.Total != 4 || stats.ValidUnexported != 2 || stats.ValidExported != 0 || stats.Invalid != 2 {
+			t.Fatalf("LeadStats = %+v", stats)
+		}
+		if stats.PerList["q1"] != 2 || stats.PerList["q2"] != 0 {
+			t.Fatalf("PerList = %v", stats.PerList)
+		}
+		if stats.OldestEntry != 1000 || stats.NewestEntry != 4000 {
+			t.Fatalf("entries = %d..%d, want 1000..4000", stats.OldestEntry, stats.NewestEntry)
+		}
+	})
+
+	t.Run("SetLeadsExported", func(t *testing.T) {
+		updated, err := store.SetLeadsExported(ctx, []string{"a@example.com", "missing@example.com"}, true)
+		if err != nil {
+			t.Fatalf("SetLeadsExported: %v", err)
+		}
+		if updated != 1 {
+			t.Fatalf("updated = %d, want 1", updated)
+		}
+		got, err := store.GetLead(ctx, "a@example.com")
+		if err != nil {
+			t.Fatalf("GetLead: %v", err)
+		}
+		if !got.LeadData.Exported || got.LeadData.ExportedAt == 0 || !got.Exported {
+			t.Fatalf("lead not marked exported: %+v", got)
+		}
+
+		stats, err := store.LeadStats(ctx)
+		if err != nil {
+			t.Fatalf("LeadStats: %v", err)
+		}
+		if stats.ValidUnexported != 1 || stats.ValidExported != 1 || stats.PerList["q1"] != 1 {
+			t.Fatalf("LeadStats after export = %+v", stats)
+		}
+
+		if _, err := store.SetLeadsExported(ctx, []string{"a@example.com"}, false); err != nil {
+			t.Fatalf("SetLeadsExported false: %v", err)
+		}
+		got, err = store.GetLead(ctx, "a@example.com")
+		if err != nil {
+			t.Fatalf("GetLead: %v", err)
+		}
+		if got.LeadData.Exported || got.LeadData.ExportedAt != 0 {
+			t.Fatalf("lead still exported: %+v", got)
+		}
+	})
+
+	t.Run("ListLeads", func(t *testing.T) {
+		leads, err := store.ListLeads(ctx)
+		if err != nil {
+			t.Fatalf("ListLeads: %v", err)
+		}
+		var emails []string
+		for _, lead := range leads {
+			emails = append(emails, lead.Email)
+		}
+		sort.Strings(emails)
+		want := []string{"a@example.com", "b@example.com", "c@example.com", "d@example.com"}
+		if fmt.Sprint(emails) != fmt.Sprint(want) {
+			t.Fatalf("ListLeads = %v, want %v", emails, want)
+		}
+	})
+
+	t.Run("DeleteLead", func(t *testing.T) {
+		deleted, err := store.DeleteLead(ctx, "b@example.com")
+		if err != nil || !deleted {
+			t.Fatalf("DeleteLead = %v, %v; want true", deleted, err)
+		}
+		deleted, err = store.DeleteLead(ctx, "b@example.com")
+		if err != nil || deleted {
+			t.Fatalf("second DeleteLead = %v, %v; want false", deleted, err)
+		}
+		if _, err := store.GetLead(ctx, "b@example.com"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("GetLead after delete error = %v, want ErrNotFound", err)
+		}
+
+		stats, err := store.LeadStats(ctx)
+		if err != nil {
+			t.Fatalf("LeadStats: %v", err)
+		}
+		if stats.Total != 3 || stats.ValidUnexported != 1 || stats.PerList["q1"] != 1 {
+			t.Fatalf("LeadStats after delete = %+v", stats)
+		}
+	})
+
+	t.Run("DeleteLead of an unreadable lead", func(t *testing.T) {
+		putRawLead(t, store, "broken@example.com", []byte("{not json"))
+		deleted, err := store.DeleteLead(ctx, "broken@example.com")
+		if err != nil || !deleted {
+			t.Fatalf("DeleteLead = %v, %v; want true", deleted, err)
+		}
+		if _, err := store.GetLead(ctx, "broken@example.com"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("GetLead after delete error = %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("ClearLeads", func(t *testing.T) {
+		deleted, err := store.ClearLeads(ctx)
+		if err != nil {
+			t.Fatalf("ClearLeads: %v", err)
+		}
+		if deleted != 3 {
+			t.Fatalf("ClearLeads deleted %d, want 3", deleted)
+		}
+		leads, err := store.ListLeads(ctx)
+		if err != nil || len(leads) != 0 {
+			t.Fatalf("ListLeads after clear = %d leads, %v", len(leads), err)
+		}
+		stats, err := store.LeadStats(ctx)
+		if err != nil {
+			t.Fatalf("LeadStats: %v", err)
+		}
+		if stats.Total != 0 || stats.ValidUnexported != 0 || stats.Invalid != 0 || len(stats.PerList) != 0 {
+			t.Fatalf("LeadStats after clear = %+v", stats)
+		}
+	})
+
+	t.Run("SaveEmail and GetEmail", func(t *testing.T) {
+		if _, err := store.GetEmail(ctx, "a@example.com"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("GetEmail error = %v, want ErrNotFound", err)
+		}
+		if err := store.SaveEmail(ctx, &CachedEmailData{Email: "a@example.com", Timestamp: 42}); err != nil {
+			t.Fatalf("SaveEmail: %v", err)
+		}
+		got, err := store.GetEmail(ctx, "a@example.com")
+		if err != nil || got.Timestamp != 42 {
+			t.Fatalf("GetEmail = %+v, %v", got, err)
+		}
+	})
+
+	t.Run("records", func(t *testing.T) {
+		if _, err := store.GetRecord(ctx, "things", "x"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("GetRecord error = %v, want ErrNotFound", err)
+		}
+		records, err := store.ListRecords(ctx, "things")
+		if err != nil || len(records) != 0 {
+			t.Fatalf("ListRecords on empty collection = %d, %v", len(records), err)
+		}
+
+		for _, id := range []string{"x", "y"} {
+			if err := store.PutRecord(ctx, "things", id, []byte(`"`+id+`"`)); err != nil {
+				t.Fatalf("PutRecord %s: %v", id, err)
+			}
+		}
+		raw, err := store.GetRecord(ctx, "things", "x")
+		if err != nil || string(raw) != `"x"` {
+			t.Fatalf("GetRecord = %s, %v", raw, err)
+		}
+		records, err = store.ListRecords(ctx, "things")
+		if err != nil || len(records) != 2 {
+			t.Fatalf("ListRecords = %d, %v; want 2", len(records), err)
+		}
+
+		deleted, err := store.DeleteRecord(ctx, "things", "x")
+		if err != nil || !deleted {
+			t.Fatalf("DeleteRecord = %v, %v; want true", deleted, err)
+		}
+		deleted, err = store.DeleteRecord(ctx, "things", "x")
+		if err != nil || deleted {
+			t.Fatalf("second DeleteRecord = %v, %v; want false", deleted, err)
+		}
+	})
+
+	t.Run("Workspace isolation", func(t *testing.T) {
+		ws, err := store.Workspace(ctx, "team")
+		if err != nil {
+			t.Fatalf("Workspace: %v", err)
+		}
+		if err := ws.SaveLead(ctx, testLead("w@example.com", EMAIL_STATUS_VALID, "", 1)); err != nil {
+			t.Fatalf("SaveLead in workspace: %v", err)
+		}
+		if _, err := store.GetLead(ctx, "w@example.com"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("workspace lead visible in parent store: %v", err)
+		}
+		if err := ws.PutRecord(ctx, "things", "t", []byte(`"team"`)); err != nil {
+			t.Fatalf("PutRecord in workspace: %v", err)
+		}
+		raw, err := store.GetWorkspaceRecord(ctx, "team", "things", "t")
+		if err != nil || string(raw) != `"team"` {
+			t.Fatalf("GetWorkspaceRecord = %s, %v", raw, err)
+		}
+		if _, err := store.GetWorkspaceRecord(ctx, "never-opened", "things", "t"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("GetWorkspaceRecord of an unopened workspace error = %v, want ErrNotFound", err)
+		}
+		if err := ws.Close(); err != nil {
+			t.Fatalf("Close workspace: %v", err)
+		}
+		if err := store.Ping(ctx); err != nil {
+			t.Fatalf("parent store unusable after workspace Close: %v", err)
+		}
+	})
+}
@@ -0,0 +1,366 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const USAGE_COLLECTION = "usage"
+
+const (
+	USAGE_SCOPE_DAY   = "day"
+	USAGE_SCOPE_MONTH = "month"
+	USAGE_SCOPE_USER  = "user"
+	USAGE_SCOPE_LEAD  = "lead"
+
+	// ANONYMOUS_USER is recorded when a request does not identify its user.
+	ANONYMOUS_USER = "anonymous"
+)
+
+// ErrBudgetExceeded rejects generation once a monthly budget is spent.
+var ErrBudgetExceeded = errors.New("generation budget exceeded")
+
+// usageLock serializes the read-modify-write of usage totals.
+var usageLock sync.Mutex
+
+// TokenUsage is what one or more provider calls consumed.
+type TokenUsage struct {
+	Provider     string  `json:"provider,omitempty"`
+	Model        string  `json:"model,omitempty"`
+	Calls        int     `json:"calls"`
+	InputTokens  int     `json:"inputTokens"`
+	OutputTokens int     `json:"outputTokens"`
+	TotalTokens  int     `json:"totalTokens"`
+	CostUSD      float64 `json:"costUsd"`
+}
+
+func (u *TokenUsage) add(other TokenUsage) {
+	u.Calls += other.Calls
+	u.InputTokens += other.InputTokens
+	u.OutputTokens += other.OutputTokens
+	u.TotalTokens += other.TotalTokens
+	u.CostUSD += other.CostUSD
+}
+
+// UsageTotals accumulates usage for one day, month, user-month or lead.
+type UsageTotals struct {
+	ID     string `json:"id"`
+	Scope  string `json:"scope"`
+	Period string `json:"period,omitempty"`
+	Name   string `json:"name,omitempty"`
+	TokenUsage
+	UpdatedAt int64 `json:"updatedAt"`
+}
+
+// UsageBudget reports the caps of generation.budget. MonthlyUSD caps the spend
+// of every workspace together, so SpentUSD and RemainingUSD are server-wide.
+type UsageBudget struct {
+	MonthlyUSD     float64 `json:"monthlyUsd,omitempty"`
+	SpentUSD       float64 `json:"spentUsd,omitempty"`
+	RemainingUSD   float64 `json:"remainingUsd,omitempty"`
+	UserMonthlyUSD float64 `json:"userMonthlyUsd,omitempty"`
+}
+
+type UsageResponse struct {
+	Success bool           `json:"success"`
+	Month   string         `json:"month,omitempty"`
+	Total   *UsageTotals   `json:"total,omitempty"`
+	Budget  *UsageBudget   `json:"budget,omitempty"`
+	Days    []*UsageTotals `json:"days,omitempty"`
+	Users   []*UsageTotals `json:"users,omitempty"`
+	Lead    *UsageTotals   `json:"lead,omitempty"`
+	Error   string         `json:"error,omitempty"`
+}
+
+func usageID(scope, period, name string) string {
+	parts := []string{scope}
+	if period != "" {
+		parts = append(parts, period)
+	}
+	if name != "" {
+		parts = append(parts, name)
+	}
+	return strings.Join(parts, ":")
+}
+
+// requestUser identifies who a request is made for: the user of its API key,
+// or without auth.enabled the X-User header.
+func requestUser(c *gin.Context) string {
+	if key := authenticatedKey(c); key != nil {
+		return key.User
+	}
+	if user := strings.TrimSpace(c.GetHeader("X-User")); user != "" {
+		return user
+	}
+	return ANONYMOUS_USER
+}
+
+// priceUsage fills in the estimated cost of usage from generation.pricing.
+// Models without a price cost nothing.
+func (s *CacheServer) priceUsage(usage *TokenUsage) {
+	price, ok := s.config.Generation.Pricing[usage.Model]
+	if !ok {
+		return
+	}
+	usage.CostUSD = float64(usage.InputTokens)*price.InputPerMillion/1e6 +
+		float64(usage.OutputTokens)*price.OutputPerMillion/1e6
+}
+
+// recordUsage adds usage to the totals of the day, the month, the user's month
+// and, when known, the lead.
+func (s *CacheServer) recordUsage(user, lead string, usage TokenUsage) {
+	if usage.Calls == 0 {
+		return
+	}
+	if user == "" {
+		user = ANONYMOUS_USER
+	}
+
+	now := time.Now().UTC()
+	day, month := now.Format("2006-01-02"), now.Format("2006-01")
+	scopes := []UsageTotals{
+		{Scope: USAGE_SCOPE_DAY, Period: day},
+		{Scope: USAGE_SCOPE_MONTH, Period: month},
+		{Scope: USAGE_SCOPE_USER, Period: month, Name: user},
+	}
+	if lead != "" {
+		scopes = append(scopes, UsageTotals{Scope: USAGE_SCOPE_LEAD, Name: lead})
+	}
+
+	usageLock.Lock()
+	defer usageLock.Unlock()
+	for _, scope := range scopes {
+		totals, err := s.loadUsage(scope.Scope, scope.Period, scope.Name)
+		if err != nil {
+			log.Printf("⚠️ Failed to read %s usage: %v", scope.Scope, err)
+			continue
+		}
+		totals.add(usage)
+		totals.UpdatedAt = now.UnixMilli()
+		if err := putRecordJSON(s.ctx, s.store, USAGE_COLLECTION, totals.ID, totals); err != nil {
+			log.Printf("⚠️ Failed to save %s usage: %v", scope.Scope, err)
+		}
+	}
+	log.Printf("💰 %s used %d tokens (~$%.4f) for %s", usage.Provider, usage.TotalTokens, usage.CostUSD, user)
+}
+
+// loadUsage returns stored totals, or empty ones when nothing was recorded yet.
+func (s *CacheServer) loadUsage(scope, period, name string) (*UsageTotals, error) {
+	id := usageID(scope, period, name)
+	totals := &UsageTotals{ID: id, Scope: scope, Period: period, Name: name}
+	if err := getRecordJSON(s.ctx, s.store, USAGE_COLLECTION, id, totals); err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+	return totals, nil
+}
+
+// serverMonthUsage sums the month's usage of every workspace. The month
+// totals are read straight from the store, so no workspace is opened.
+func (s *CacheServer) serverMonthUsage(month string) (TokenUsage, error) {
+	var usage TokenUsage
+	names, err := s.knownWorkspaces()
+	if err != nil {
+		return usage, err
+	}
+	root := s.workspaces.root
+	for _, name := range names {
+		var totals UsageTotals
+		err := getWorkspaceRecordJSON(s.ctx, root.store, name, USAGE_COLLECTION, usageID(USAGE_SCOPE_MONTH, month, ""), &totals)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return usage, fmt.Errorf("workspace %s: %v", name, err)
+		}
+		usage.add(totals.TokenUsage)
+	}
+	return usage, nil
+}
+
+// budgetReservations holds the estimated cost of generations that passed the
+// budget check and have not finished, so concurrent requests cannot all spend
+// the same remaining budget. It is shared by every workspace.
+type budgetReservations struct {
+	mu    sync.Mutex
+	total float64
+	// users is keyed by workspace and user, like the per-user budget
+	users map[string]float64
+}
+
+func newBudgetReservations() *budgetReservations {
+	return &budgetReservations{users: make(map[string]float64)}
+}
+
+// budgetReservation is what one generation request holds until it finishes.
+type budgetReservation struct {
+	owner *budgetReservations
+	user  string
+	cost  float64
+	once  sync.Once
+}
+
+// release gives the reservation back once the generation's real usage is
+// recorded. It is safe to call more than once, and on nil.
+func (r *budgetReservation) release() {
+	if r == nil {
+		return
+	}
+	r.once.Do(func() {
+		r.owner.mu.Lock()
+		defer r.owner.mu.Unlock()
+		r.owner.total -= r.cost
+		r.owner.users[r.user] -= r.cost
+		if r.owner.users[r.user] <= 0 {
+			delete(r.owner.users, r.user)
+		}
+	})
+}
+
+// reserveBudget fails with ErrBudgetExceeded when this month's spend, together
+// with what running generations reserved and this request's estimate, reaches
+// a configured cap: monthlyUsd for all workspaces together, userMonthlyUsd for
+// the user in this workspace. The estimate is the month's average cost per
+// provider call times the number of variants. The returned reservation must
+// be released when the generation is done.
+func (s *CacheServer) reserveBudget(user string, variants int) (*budgetReservation, error) {
+	budget := s.config.Generation.Budget
+	if budget.MonthlyUSD <= 0 && budget.UserMonthlyUSD <= 0 {
+		return nil, nil
+	}
+	if variants < 1 {
+		variants = 1
+	}
+	month := time.Now().UTC().Format("2006-01")
+	reservations := s.reservations
+
+	// Checking and reserving happen under one lock, so no two requests see the
+	// same remaining budget
+	reservations.mu.Lock()
+	defer reservations.mu.Unlock()
+
+	server, err := s.serverMonthUsage(month)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read usage: %v", err)
+	}
+	var estimate float64
+	if server.Calls > 0 {
+		estimate = server.CostUSD / float64(server.Calls) * float64(variants)
+	}
+
+	if budget.MonthlyUSD > 0 {
+		committed := server.CostUSD + reservations.total
+		if committed >= budget.MonthlyUSD || (estimate > 0 && committed+estimate > budget.MonthlyUSD) {
+			return nil, fmt.Errorf("%w: $%.2f of the $%.2f monthly budget spent or reserved across workspaces, this request needs about $%.2f",
+				ErrBudgetExceeded, committed, budget.MonthlyUSD, estimate)
+		}
+	}
+	key := s.workspace + ":" + user
+	if budget.UserMonthlyUSD > 0 {
+		totals, err := s.loadUsage(USAGE_SCOPE_USER, month, user)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read usage: %v", err)
+		}
+		committed := totals.CostUSD + reservations.users[key]
+		if committed >= budget.UserMonthlyUSD || (estimate > 0 && committed+estimate > budget.UserMonthlyUSD) {
+			return nil, fmt.Errorf("%w: %s spent or reserved $%.2f of the $%.2f monthly budget per user, this request needs about $%.2f",
+				ErrBudgetExceeded, user, committed, budget.UserMonthlyUSD, estimate)
+		}
+	}
+
+	reservations.total += estimate
+	reservations.users[key] += estimate
+	return &budgetReservation{owner: reservations, user: key, cost: estimate}, nil
+}
+
+// getUsage reports a month's totals, per-user totals and budget, the last
+// ?days=N daily totals (default 30) and, with ?lead=, one lead's totals.
+func (s *CacheServer) getUsage(c *gin.Context) {
+	now := time.Now().UTC()
+	month := c.DefaultQuery("month", now.Format("2006-01"))
+	if _, err := time.Parse("2006-01", month); err != nil {
+		c.JSON(http.StatusBadRequest, UsageResponse{
+			Success: false,
+			Error:   "month must be YYYY-MM",
+		})
+		return
+	}
+	days, err := strconv.Atoi(c.DefaultQuery("days", "30"))
+	if err != nil || days < 1 || days > 366 {
+		c.JSON(http.StatusBadRequest, UsageResponse{
+			Success: false,
+			Error:   "days must be between 1 and 366",
+		})
+		return
+	}
+
+	records, err := s.store.ListRecords(s.ctx, USAGE_COLLECTION)
+	if err != nil {
+		log.Printf("Error reading usage: %v", err)
+		c.JSON(http.StatusInternalServerError, UsageResponse{
+			Success: false,
+			Error:   "Failed to read usage",
+		})
+		return
+	}
+
+	firstDay := now.AddDate(0, 0, -(days - 1)).Format("2006-01-02")
+	lead := strings.ToLower(strings.TrimSpace(c.Query("lead")))
+	response := UsageResponse{
+		Success: true,
+		Month:   month,
+		Total:   &UsageTotals{ID: usageID(USAGE_SCOPE_MONTH, month, ""), Scope: USAGE_SCOPE_MONTH, Period: month},
+	}
+	for _, raw := range records {
+		var totals UsageTotals
+		if err := json.Unmarshal(raw, &totals); err != nil {
+			continue
+		}
+		switch {
+		case totals.Scope == USAGE_SCOPE_MONTH && totals.Period == month:
+			response.Total = &totals
+		case totals.Scope == USAGE_SCOPE_DAY && totals.Period >= firstDay:
+			response.Days = append(response.Days, &totals)
+		case totals.Scope == USAGE_SCOPE_USER && totals.Period == month:
+			response.Users = append(response.Users, &totals)
+		case totals.Scope == USAGE_SCOPE_LEAD && lead != "" && totals.Name == lead:
+			response.Lead = &totals
+		}
+	}
+	sort.Slice(response.Days, func(i, j int) bool { return response.Days[i].Period < response.Days[j].Period })
+	sort.Slice(response.Users, func(i, j int) bool { return response.Users[i].CostUSD > response.Users[j].CostUSD })
+
+	if budget := s.config.Generation.Budget; budget.MonthlyUSD > 0 || budget.UserMonthlyUSD > 0 {
+		response.Budget = &UsageBudget{
+			MonthlyUSD:     budget.MonthlyUSD,
+			UserMonthlyUSD: budget.UserMonthlyUSD,
+		}
+		if budget.MonthlyUSD > 0 {
+			usage, err := s.serverMonthUsage(month)
+			spent := usage.CostUSD
+			if err != nil {
+				log.Printf("Error reading usage of every workspace: %v", err)
+				c.JSON(http.StatusInternalServerError, UsageResponse{
+					Success: false,
+					Error:   "Failed to read usage",
+				})
+				return
+			}
+			response.Budget.SpentUSD = spent
+			if budget.MonthlyUSD > spent {
+				response.Budget.RemainingUSD = budget.MonthlyUSD - spent
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
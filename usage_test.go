@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMonthlyBudgetCountsEveryWorkspace(t *testing.T) {
+	s := newTestAuthServer(t)
+	s.config.Workspaces = map[string]WorkspaceConfig{"emea": {}}
+	s.config.Generation.Budget.MonthlyUSD = 1
+
+	emea, err := s.forWorkspace("emea")
+	if err != nil {
+		t.Fatalf("forWorkspace: %v", err)
+	}
+	s.recordUsage("jane", "", TokenUsage{Calls: 2, CostUSD: 0.6})
+	if _, err := emea.reserveBudget("lena", 1); err != nil {
+		t.Fatalf("reserveBudget under the cap: %v", err)
+	}
+
+	emea.recordUsage("lena", "", TokenUsage{Calls: 1, CostUSD: 0.5})
+	for name, ws := range map[string]*CacheServer{"default": s, "emea": emea} {
+		if _, err := ws.reserveBudget("someone", 1); !errors.Is(err, ErrBudgetExceeded) {
+			t.Fatalf("reserveBudget in %s = %v, want ErrBudgetExceeded", name, err)
+		}
+	}
+}
+
+func TestMonthlyBudgetReadsUnopenedWorkspaces(t *testing.T) {
+	s := newTestAuthServer(t)
+	s.config.Workspaces = map[string]WorkspaceConfig{"apac": {}}
+	s.config.Generation.Budget.MonthlyUSD = 1
+
+	// Usage written by an earlier run, before the workspace was opened here
+	store, err := s.store.Workspace(s.ctx, "apac")
+	if err != nil {
+		t.Fatalf("Workspace: %v", err)
+	}
+	month := time.Now().UTC().Format("2006-01")
+	totals := UsageTotals{ID: usageID(USAGE_SCOPE_MONTH, month, ""), Scope: USAGE_SCOPE_MONTH, Period: month}
+	totals.CostUSD = 2
+	if err := putRecordJSON(s.ctx, store, USAGE_COLLECTION, totals.ID, &totals); err != nil {
+		t.Fatalf("putRecordJSON: %v", err)
+	}
+
+	if _, err := s.reserveBudget("jane", 1); !errors.Is(err, ErrBudgetExceeded) {
+		t.Fatalf("reserveBudget = %v, want ErrBudgetExceeded", err)
+	}
+	if _, opened := s.workspaces.opened()["apac"]; opened {
+		t.Fatal("reserveBudget opened workspace apac")
+	}
+}
+
+func TestForWorkspaceOpensOnce(t *testing.T) {
+	s := newTestAuthServer(t)
+
+	var wg sync.WaitGroup
+	servers := make([]*CacheServer, 8)
+	for i := range servers {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ws, err := s.forWorkspace("emea")
+			if err != nil {
+				t.Errorf("forWorkspace: %v", err)
+			}
+			servers[i] = ws
+		}(i)
+	}
+	wg.Wait()
+	for _, ws := range servers[1:] {
+		if ws != servers[0] {
+			t.Fatal("forWorkspace opened the workspace more than once")
+		}
+	}
+}
+
+func TestReserveBudgetHoldsEstimatedCost(t *testing.T) {
+	s := newTestAuthServer(t)
+	s.config.Generation.Budget.MonthlyUSD = 1
+	// One call so far, so every further call is estimated at $0.25
+	s.recordUsage("jane", "", TokenUsage{Calls: 1, CostUSD: 0.25})
+
+	first, err := s.reserveBudget("jane", 1)
+	if err != nil {
+		t.Fatalf("first reserveBudget: %v", err)
+	}
+	if _, err := s.reserveBudget("sam", 3); !errors.Is(err, ErrBudgetExceeded) {
+		t.Fatalf("reserveBudget for 3 variants = %v, want ErrBudgetExceeded", err)
+	}
+	second, err := s.reserveBudget("sam", 2)
+	if err != nil {
+		t.Fatalf("reserveBudget for 2 variants: %v", err)
+	}
+	if _, err := s.reserveBudget("lena", 1); !errors.Is(err, ErrBudgetExceeded) {
+		t.Fatalf("reserveBudget past the reserved budget = %v, want ErrBudgetExceeded", err)
+	}
+
+	second.release()
+	second.release()
+	if _, err := s.reserveBudget("lena", 1); err != nil {
+		t.Fatalf("reserveBudget after a release: %v", err)
+	}
+	first.release()
+}
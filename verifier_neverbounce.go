@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// NeverBounceVerifier calls the NeverBounce single-check API with the key kept
+// in server configuration, never in the extension.
+type NeverBounceVerifier struct {
+	apiKey   string
+	endpoint string
+	client   *http.Client
+}
+
+type neverBounceResponse struct {
+	Status        string `json:"status"`
+	Result        string `json:"result"`
+	Message       string `json:"message"`
+	ExecutionTime int64  `json:"execution_time"`
+}
+
+func NewNeverBounceVerifier(cfg NeverBounceConfig) *NeverBounceVerifier {
+	return &NeverBounceVerifier{
+		apiKey:   cfg.APIKey,
+		endpoint: cfg.Endpoint,
+		client:   &http.Client{Timeout: time.Duration(cfg.Timeout)},
+	}
+}
+
+func (n *NeverBounceVerifier) Name() string {
+	return VERIFIER_NEVERBOUNCE
+}
+
+func (n *NeverBounceVerifier) Verify(ctx context.Context, email string) (*VerificationResult, error) {
+	form := url.Values{}
+	form.Set("key", n.apiKey)
+	form.Set("email", email)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	started := time.Now()
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach NeverBounce: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read NeverBounce response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("NeverBounce returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var parsed neverBounceResponse
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return nil, fmt.Errorf("failed to parse NeverBounce response: %v", err)
+	}
+	if parsed.Status != "success" {
+		return nil, fmt.Errorf("NeverBounce error (%s): %s", parsed.Status, parsed.Message)
+	}
+
+	status := strings.ToLower(parsed.Result)
+	if !containsString(validEmailStatuses, status) {
+		status = EMAIL_STATUS_UNKNOWN
+	}
+
+	duration := parsed.ExecutionTime
+	if duration == 0 {
+		duration = time.Since(started).Milliseconds()
+	}
+
+	return &VerificationResult{
+		Email:    email,
+		Status:   status,
+		Provider: VERIFIER_NEVERBOUNCE,
+		Duration: duration,
+	}, nil
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MXResolver is the part of net.Resolver the SMTP verifier needs, so tests can
+// substitute a fake DNS.
+type MXResolver interface {
+	LookupMX(ctx context.Context, name string) ([]*net.MX, error)
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// SMTPVerifier checks addresses itself instead of paying a third party: syntax,
+// disposable domains, MX lookup, then an SMTP conversation that stops after
+// RCPT TO. A second RCPT TO for a random address detects catch-all domains.
+type SMTPVerifier struct {
+	heloName   string
+	mailFrom   string
+	port       int
+	timeout    time.Duration
+	resolver   MXResolver
+	dial       func(ctx context.Context, network, addr string) (net.Conn, error)
+	disposable map[string]bool
+	roles      map[string]bool
+}
+
+func NewSMTPVerifier(cfg SMTPVerifierConfig) *SMTPVerifier {
+	timeout := time.Duration(cfg.Timeout)
+	dialer := &net.Dialer{Timeout: timeout}
+
+	resolver := net.DefaultResolver
+	if cfg.DNSServer != "" {
+		// Send every DNS query to the configured server, e.g. a local fake in tests
+		resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, cfg.DNSServer)
+			},
+		}
+	}
+
+	disposable := make(map[string]bool, len(disposableDomains)+len(cfg.DisposableDomains))
+	for _, domain := range disposableDomains {
+		disposable[domain] = true
+	}
+	for _, domain := range cfg.DisposableDomains {
+		disposable[strings.ToLower(strings.TrimSpace(domain))] = true
+	}
+
+	roles := make(map[string]bool, len(roleAccounts))
+	for _, local := range roleAccounts {
+		roles[local] = true
+	}
+
+	return &SMTPVerifier{
+		heloName:   cfg.HeloName,
+		mailFrom:   cfg.MailFrom,
+		port:       cfg.Port,
+		timeout:    timeout,
+		resolver:   resolver,
+		dial:       dialer.DialContext,
+		disposable: disposable,
+		roles:      roles,
+	}
+}
+
+func (v *SMTPVerifier) Name() string {
+	return VERIFIER_SMTP
+}
+
+func (v *SMTPVerifier) Verify(ctx context.Context, email string) (*VerificationResult, error) {
+	started := time.Now()
+	result := &VerificationResult{Email: email, Provider: VERIFIER_SMTP}
+	defer func() {
+		result.Duration = time.Since(started).Milliseconds()
+	}()
+
+	status, reason := v.check(ctx, email, result)
+	result.Status = status
+	result.Reason = reason
+	return result, ctx.Err()
+}
+
+// check runs the verification steps in order of cost and returns the status
+// and a short reason.
+func (v *SMTPVerifier) check(ctx context.Context, email string, result *VerificationResult) (string, string) {
+	if err := validateEmailAddress(email); err != nil {
+		return EMAIL_STATUS_INVALID, "syntax"
+	}
+	at := strings.LastIndex(email, "@")
+	local, domain := email[:at], strings.ToLower(email[at+1:])
+	result.Role = v.roles[strings.ToLower(local)]
+
+	if v.disposable[domain] {
+		return EMAIL_STATUS_DISPOSABLE, "disposable domain"
+	}
+
+	hosts, err := v.lookupMailHosts(ctx, domain)
+	if err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			return EMAIL_STATUS_INVALID, "domain has no mail server"
+		}
+		return EMAIL_STATUS_UNKNOWN, fmt.Sprintf("dns: %v", err)
+	}
+	if len(hosts) == 0 {
+		return EMAIL_STATUS_INVALID, "domain does not accept mail"
+	}
+
+	// Try each MX in preference order until one gives a definite answer
+	var lastErr error
+	for _, host := range hosts {
+		status, reason, err := v.probe(ctx, host, email, domain)
+		if err == nil {
+			return status, reason
+		}
+		lastErr = err
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return EMAIL_STATUS_UNKNOWN, fmt.Sprintf("smtp: %v", lastErr)
+}
+
+// lookupMailHosts returns the domain's MX hosts by preference. A domain without
+// MX records but with an address record receives mail itself (RFC 5321); a
+// null MX (RFC 7505) means it accepts none.
+func (v *SMTPVerifier) lookupMailHosts(ctx context.Context, domain string) ([]string, error) {
+	records, err := v.resolver.LookupMX(ctx, domain)
+	if err != nil {
+		var dnsErr *net.DNSError
+		if !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+			return nil, err
+		}
+		if _, err := v.resolver.LookupHost(ctx, domain); err != nil {
+			return nil, err
+		}
+		return []string{domain}, nil
+	}
+
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Pref < records[j].Pref
+	})
+
+	var hosts []string
+	for _, record := range records {
+		host := strings.TrimSuffix(record.Host, ".")
+		if host == "" {
+			return nil, nil
+		}
+		hosts = append(hosts, host)
+	}
+	return hosts, nil
+}
+
+// probe asks one mail server about email and a random address at the same
+// domain. An error means the server gave no usable answer and the next MX
+// should be tried.
+func (v *SMTPVerifier) probe(ctx context.Context, host, email, domain string) (string, string, error) {
+	ctx, cancel := context.WithTimeout(ctx, v.timeout)
+	defer cancel()
+
+	conn, err := v.dial(ctx, "tcp", net.JoinHostPort(host, strconv.Itoa(v.port)))
+	if err != nil {
+		return "", "", err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return "", "", err
+	}
+	defer client.Close()
+
+	if err := client.Hello(v.heloName); err != nil {
+		return "", "", err
+	}
+	if err := client.Mail(v.mailFrom); err != nil {
+		return "", "", err
+	}
+
+	accepted, err := rcptAccepted(client, email)
+	if err != nil {
+		return "", "", err
+	}
+	if !accepted {
+		client.Quit()
+		return EMAIL_STATUS_INVALID, "mailbox rejected", nil
+	}
+
+	random := make([]byte, 8)
+	rand.Read(random)
+	probe := "verify-" + hex.EncodeToString(random) + "@" + domain
+	catchall, err := rcptAccepted(client, probe)
+	client.Quit()
+	if err != nil {
+		// The real address was accepted; only the catch-all test is inconclusive
+		return EMAIL_STATUS_VALID, "mailbox accepted", nil
+	}
+	if catchall {
+		return EMAIL_STATUS_CATCHALL, "domain accepts any address", nil
+	}
+	return EMAIL_STATUS_VALID, "mailbox accepted", nil
+}
+
+// rcptAccepted reports whether the server accepts a recipient. Permanent 55x
+// rejections are a definite no; temporary failures (greylisting, rate limits)
+// are returned as errors.
+func rcptAccepted(client *smtp.Client, address string) (bool, error) {
+	err := client.Rcpt(address)
+	if err == nil {
+		return true, nil
+	}
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) && protoErr.Code >= 550 && protoErr.Code <= 553 {
+		return false, nil
+	}
+	return false, err
+}
+
+// disposableDomains are common throwaway-mailbox providers. More can be added
+// with verification.smtp.disposableDomains.
+var disposableDomains = []string{
+	"10minutemail.com",
+	"33mail.com",
+	"dispostable.com",
+	"emailondeck.com",
+	"fakeinbox.com",
+	"getnada.com",
+	"guerrillamail.com",
+	"guerrillamail.net",
+	"maildrop.cc",
+	"mailinator.com",
+	"mailnesia.com",
+	"mintemail.com",
+	"mohmal.com",
+	"sharklasers.com",
+	"spamgourmet.com",
+	"temp-mail.org",
+	"tempmail.com",
+	"tempmailo.com",
+	"throwawaymail.com",
+	"trashmail.com",
+	"yopmail.com",
+}
+
+// roleAccounts are shared mailboxes that rarely belong to the lead themselves.
+var roleAccounts = []string{
+	"admin", "billing", "careers", "contact", "help", "hello", "hi", "hr",
+	"info", "jobs", "marketing", "noreply", "no-reply", "office", "postmaster",
+	"press", "sales", "security", "support", "team", "webmaster",
+}
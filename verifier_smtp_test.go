@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeResolver answers MX and host lookups from maps; unknown names are NXDOMAIN.
+type fakeResolver struct {
+	mx    map[string][]*net.MX
+	hosts map[string][]string
+}
+
+func (r *fakeResolver) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	if records, ok := r.mx[name]; ok {
+		return records, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+}
+
+func (r *fakeResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	if addrs, ok := r.hosts[host]; ok {
+		return addrs, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
+
+// fakeSMTPServer is an in-process mail server. rcpt returns the reply line for
+// each RCPT TO address; silent makes it accept connections and never greet.
+type fakeSMTPServer struct {
+	listener net.Listener
+	rcpt     func(address string) string
+	silent   bool
+}
+
+func startFakeSMTPServer(t *testing.T, rcpt func(address string) string) *fakeSMTPServer {
+	return startFakeSMTPServerWith(t, &fakeSMTPServer{rcpt: rcpt})
+}
+
+func startFakeSMTPServerWith(t *testing.T, server *fakeSMTPServer) *fakeSMTPServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	server.listener = listener
+	t.Cleanup(func() { listener.Close() })
+	go server.serve()
+	return server
+}
+
+func (s *fakeSMTPServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeSMTPServer) handle(conn net.Conn) {
+	defer conn.Close()
+	if s.silent {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		bufio.NewReader(conn).ReadString('\n')
+		return
+	}
+
+	reader := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+	reply("220 mx.test ESMTP")
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			reply("250 mx.test")
+		case strings.HasPrefix(command, "MAIL FROM:"):
+			reply("250 OK")
+		case strings.HasPrefix(command, "RCPT TO:"):
+			address := strings.Trim(strings.TrimSpace(line)[len("RCPT TO:"):], "<> ")
+			reply(s.rcpt(strings.ToLower(address)))
+		case strings.HasPrefix(command, "QUIT"):
+			reply("221 Bye")
+			return
+		default:
+			reply("502 Command not implemented")
+		}
+	}
+}
+
+// newTestSMTPVerifier points every SMTP connection at server, whatever the MX host.
+func newTestSMTPVerifier(server *fakeSMTPServer, resolver MXResolver, timeout time.Duration) *SMTPVerifier {
+	v := NewSMTPVerifier(SMTPVerifierConfig{HeloName: "verifier.test", Port: 25, Timeout: Duration(timeout)})
+	v.resolver = resolver
+	dialer := &net.Dialer{}
+	v.dial = func(ctx context.Context, network, _ string) (net.Conn, error) {
+		return dialer.DialContext(ctx, network, server.listener.Addr().String())
+	}
+	return v
+}
+
+func acmeResolver() *fakeResolver {
+	return &fakeResolver{
+		mx: map[string][]*net.MX{
+			"acme.test":    {{Host: "mx2.acme.test.", Pref: 20}, {Host: "mx1.acme.test.", Pref: 10}},
+			"nullmx.test":  {{Host: ".", Pref: 0}},
+			"emptymx.test": {},
+		},
+		hosts: map[string][]string{
+			"direct.test": {"192.0.2.1"},
+		},
+	}
+}
+
+func TestSMTPVerifierRCPT(t *testing.T) {
+	tests := []struct {
+		name   string
+		email  string
+		rcpt   func(address string) string
+		status string
+	}{
+		{
+			name:  "accepted mailbox",
+			email: "jane@acme.test",
+			rcpt: func(address string) string {
+				if address == "jane@acme.test" {
+					return "250 OK"
+				}
+				return "550 No such user"
+			},
+			status: EMAIL_STATUS_VALID,
+		},
+		{
+			name:   "rejected mailbox",
+			email:  "nobody@acme.test",
+			rcpt:   func(string) string { return "550 5.1.1 No such user" },
+			status: EMAIL_STATUS_INVALID,
+		},
+		{
+			name:   "catch-all domain",
+			email:  "jane@acme.test",
+			rcpt:   func(string) string { return "250 OK" },
+			status: EMAIL_STATUS_CATCHALL,
+		},
+		{
+			name:   "greylisted",
+			email:  "jane@acme.test",
+			rcpt:   func(string) string { return "451 4.7.1 Try again later" },
+			status: EMAIL_STATUS_UNKNOWN,
+		},
+		{
+			name:  "catch-all probe greylisted",
+			email: "jane@acme.test",
+			rcpt: func(address string) string {
+				if address == "jane@acme.test" {
+					return "250 OK"
+				}
+				return "450 Mailbox busy"
+			},
+			status: EMAIL_STATUS_VALID,
+		},
+		{
+			name:   "address record without MX",
+			email:  "jane@direct.test",
+			rcpt:   func(string) string { return "550 No such user" },
+			status: EMAIL_STATUS_INVALID,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := startFakeSMTPServer(t, tt.rcpt)
+			v := newTestSMTPVerifier(server, acmeResolver(), 2*time.Second)
+
+			result, err := v.Verify(context.Background(), tt.email)
+			if err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+			if result.Status != tt.status {
+				t.Fatalf("status = %s (%s), want %s", result.Status, result.Reason, tt.status)
+			}
+			if result.Provider != VERIFIER_SMTP {
+				t.Fatalf("provider = %s, want %s", result.Provider, VERIFIER_SMTP)
+			}
+		})
+	}
+}
+
+func TestSMTPVerifierTimeout(t *testing.T) {
+	server := startFakeSMTPServerWith(t, &fakeSMTPServer{silent: true})
+	v := newTestSMTPVerifier(server, acmeResolver(), 200*time.Millisecond)
+
+	started := time.Now()
+	result, err := v.Verify(context.Background(), "jane@acme.test")
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if result.Status != EMAIL_STATUS_UNKNOWN {
+		t.Fatalf("status = %s (%s), want %s", result.Status, result.Reason, EMAIL_STATUS_UNKNOWN)
+	}
+	// Both MX hosts are tried, each bounded by the timeout
+	if elapsed := time.Since(started); elapsed > 2*time.Second {
+		t.Fatalf("Verify took %s, want it bounded by the per-host timeout", elapsed)
+	}
+}
+
+func TestSMTPVerifierWithoutConnecting(t *testing.T) {
+	tests := []struct {
+		email  string
+		status string
+	}{
+		{"not-an-address", EMAIL_STATUS_INVALID},
+		{"jane@mailinator.com", EMAIL_STATUS_DISPOSABLE},
+		{"jane@missing.test", EMAIL_STATUS_INVALID},
+		{"jane@nullmx.test", EMAIL_STATUS_INVALID},
+		{"jane@emptymx.test", EMAIL_STATUS_INVALID},
+	}
+
+	server := startFakeSMTPServer(t, func(string) string {
+		t.Error("no SMTP connection expected")
+		return "250 OK"
+	})
+	v := newTestSMTPVerifier(server, acmeResolver(), time.Second)
+
+	for _, tt := range tests {
+		t.Run(tt.email, func(t *testing.T) {
+			result, err := v.Verify(context.Background(), tt.email)
+			if err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+			if result.Status != tt.status {
+				t.Fatalf("status = %s (%s), want %s", result.Status, result.Reason, tt.status)
+			}
+		})
+	}
+}
+
+func TestSMTPVerifierRoleAccount(t *testing.T) {
+	server := startFakeSMTPServer(t, func(address string) string {
+		if strings.HasPrefix(address, "sales@") {
+			return "250 OK"
+		}
+		return "550 No such user"
+	})
+	v := newTestSMTPVerifier(server, acmeResolver(), time.Second)
+
+	result, err := v.Verify(context.Background(), "sales@acme.test")
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if result.Status != EMAIL_STATUS_VALID || !result.Role {
+		t.Fatalf("result = %+v, want a valid role account", result)
+	}
+}
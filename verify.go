@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	VERIFIER_NEVERBOUNCE = "neverbounce"
+	VERIFIER_SMTP        = "smtp"
+	VERIFIER_FAKE        = "fake"
+)
+
+// EmailVerifier checks whether an address can receive mail. Implementations
+// return one of the EMAIL_STATUS_* values.
+type EmailVerifier interface {
+	Name() string
+	Verify(ctx context.Context, email string) (*VerificationResult, error)
+}
+
+type VerificationResult struct {
+	Email    string `json:"email"`
+	Status   string `json:"result"`
+	Provider string `json:"provider"`
+	// Duration is how long the provider took, in milliseconds.
+	Duration int64 `json:"executionTime"`
+	// Reason explains the status when the provider gives one.
+	Reason string `json:"reason,omitempty"`
+	// Role is set for shared mailboxes such as info@ or sales@.
+	Role bool `json:"role,omitempty"`
+}
+
+type VerifyResponse struct {
+	Success  bool   `json:"success"`
+	Email    string `json:"email,omitempty"`
+	Result   string `json:"result,omitempty"`
+	Provider string `json:"provider,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+	Role     bool   `json:"role,omitempty"`
+	Cached   bool   `json:"cached"`
+	CacheAge int64  `json:"cacheAge,omitempty"`
+	Lead     *Lead  `json:"lead,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// NewEmailVerifier builds the provider selected by cfg.Verification.Provider.
+func NewEmailVerifier(cfg *Config) (EmailVerifier, error) {
+	switch cfg.Verification.Provider {
+	case VERIFIER_NEVERBOUNCE:
+		return NewNeverBounceVerifier(cfg.Verification.NeverBounce), nil
+	case VERIFIER_SMTP:
+		return NewSMTPVerifier(cfg.Verification.SMTP), nil
+	case VERIFIER_FAKE:
+		return NewFakeVerifier(nil), nil
+	default:
+		return nil, fmt.Errorf("unknown verification provider %q", cfg.Verification.Provider)
+	}
+}
+
+// verifyEmail answers from the lead cache when it already holds a status for the
+// address, otherwise asks the provider and caches the result together with any
+// lead details sent in the body. Pass force=true to skip the cache.
+func (s *CacheServer) verifyEmail(c *gin.Context) {
+	email := strings.ToLower(strings.TrimSpace(c.Param("email")))
+	if err := validateEmailAddress(email); err != nil {
+		c.JSON(http.StatusBadRequest, VerifyResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	var lead Lead
+	if err := c.ShouldBindJSON(&lead); err != nil && !errors.Is(err, io.EOF) {
+		log.Printf("Invalid JSON for verification of %s: %v", email, err)
+		c.JSON(http.StatusBadRequest, VerifyResponse{
+			Success: false,
+			Error:   "Invalid JSON in request body",
+		})
+		return
+	}
+	if err := lead.Validate(email); err != nil {
+		c.JSON(http.StatusBadRequest, VerifyResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Invalid lead: %v", err),
+		})
+		return
+	}
+
+	force := c.Query("force") == "true"
+	cached, result, err := s.verifyAndCache(c.Request.Context(), email, lead, force, requestUser(c))
+	if err != nil {
+		log.Printf("❌ Verification failed for %s: %v", email, err)
+		c.JSON(http.StatusBadGateway, VerifyResponse{
+			Success: false,
+			Email:   email,
+			Error:   fmt.Sprintf("Verification failed: %v", err),
+		})
+		return
+	}
+
+	response := VerifyResponse{
+		Success:  true,
+		Email:    email,
+		Result:   cached.LeadData.EmailStatus,
+		Cached:   result == nil,
+		Lead:     &cached.LeadData,
+		Provider: s.verifier.Name(),
+	}
+	if result == nil {
+		response.Provider = ""
+		response.CacheAge = time.Now().UnixMilli() - cached.Timestamp
+	} else {
+		response.Reason = result.Reason
+		response.Role = result.Role
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// finalEmailStatuses are the verification outcomes worth caching for good.
+// Anything else, such as unknown after a timeout or a greylisting 4xx, is
+// checked again on the next request.
+var finalEmailStatuses = []string{
+	EMAIL_STATUS_VALID,
+	EMAIL_STATUS_INVALID,
+	EMAIL_STATUS_CATCHALL,
+	EMAIL_STATUS_DISPOSABLE,
+}
+
+// verifyAndCache returns the cached lead when it already has a final status (and
+// a nil result), otherwise runs the verifier and stores the outcome via saveLead on
+// behalf of user. Lead details in lead are merged over anything already stored.
+func (s *CacheServer) verifyAndCache(ctx context.Context, email string, lead Lead, force bool, user string) (*CachedData, *VerificationResult, error) {
+	existing, err := s.store.GetLead(s.ctx, email)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, nil, fmt.Errorf("failed to read cache: %v", err)
+	}
+
+	if existing != nil && containsString(finalEmailStatuses, existing.LeadData.EmailStatus) && !force {
+		log.Printf("Cache hit for verification of %s: %s", email, existing.LeadData.EmailStatus)
+		return existing, nil, nil
+	}
+
+	result, err := s.verifier.Verify(ctx, email)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	merged := lead
+	if existing != nil {
+		merged = mergeLead(existing.LeadData, lead)
+	}
+	merged.EmailStatus = result.Status
+	merged.VerifiedAt = time.Now().UnixMilli()
+
+	saved, err := s.saveLead(email, merged, user)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to cache verification result: %v", err)
+	}
+
+	log.Printf("✅ Verified %s via %s: %s (%dms)", email, result.Provider, result.Status, result.Duration)
+	return saved, result, nil
+}
+
+// mergeLead overlays the non-empty fields of update onto base.
+func mergeLead(base, update Lead) Lead {
+	merged := base
+	for _, field := range []struct {
+		dst *string
+		src string
+	}{
+		{&merged.FirstName, update.FirstName},
+		{&merged.LastName, update.LastName},
+		{&merged.Title, update.Title},
+		{&merged.CompanyName, update.CompanyName},
+		{&merged.Domain, update.Domain},
+		{&merged.EmailStatus, update.EmailStatus},
+		{&merged.List, update.List},
+		{&merged.SourceURL, update.SourceURL},
+		{&merged.ProfileSnippet, update.ProfileSnippet},
+		{&merged.Notes, update.Notes},
+	} {
+		if field.src != "" {
+			*field.dst = field.src
+		}
+	}
+	if len(update.CustomFields) > 0 {
+		fields := make(map[string]interface{}, len(base.CustomFields)+len(update.CustomFields))
+		for k, v := range base.CustomFields {
+			fields[k] = v
+		}
+		for k, v := range update.CustomFields {
+			fields[k] = v
+		}
+		merged.CustomFields = fields
+		// Each field stays where the update put it
+		merged.topLevel = make(map[string]bool, len(base.topLevel)+len(update.topLevel))
+		for k := range base.topLevel {
+			if _, updated := update.CustomFields[k]; !updated {
+				merged.topLevel[k] = true
+			}
+		}
+		for k := range update.topLevel {
+			merged.topLevel[k] = true
+		}
+	}
+	return merged
+}
+
+// FakeVerifier answers without any network access, for tests and offline demos.
+// Addresses listed in Results get that status; otherwise a local part starting
+// with a status name (e.g. "invalid.user@" or "catchall+1@") yields that status
+// and everything else is valid.
+type FakeVerifier struct {
+	Results map[string]string
+}
+
+func NewFakeVerifier(results map[string]string) *FakeVerifier {
+	return &FakeVerifier{Results: results}
+}
+
+func (f *FakeVerifier) Name() string {
+	return VERIFIER_FAKE
+}
+
+func (f *FakeVerifier) Verify(ctx context.Context, email string) (*VerificationResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	status, listed := f.Results[email]
+	if !listed {
+		status = EMAIL_STATUS_VALID
+		prefix := strings.FieldsFunc(email, func(r rune) bool {
+			return r == '.' || r == '+' || r == '@'
+		})
+		if len(prefix) > 0 && containsString(validEmailStatuses, prefix[0]) {
+			status = prefix[0]
+		}
+	}
+
+	return &VerificationResult{
+		Email:    email,
+		Status:   status,
+		Provider: VERIFIER_FAKE,
+	}, nil
+}
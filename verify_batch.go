@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const JOB_TYPE_VERIFY_BATCH = "verify_batch"
+
+// VerifyBatchRequest names the addresses to verify: explicit emails, every lead
+// of a list, or both.
+type VerifyBatchRequest struct {
+	Emails []string `json:"emails"`
+	// List adds every cached lead whose listLeadBelongsTo matches.
+	List string `json:"list"`
+	// Lead holds details stored with every address, as for POST /verify/:email.
+	Lead  Lead `json:"lead"`
+	Force bool `json:"force"`
+}
+
+// VerifyBatchResult is recorded per email in the job.
+type VerifyBatchResult struct {
+	Result string `json:"result"`
+	Cached bool   `json:"cached"`
+	Reason string `json:"reason,omitempty"`
+	Role   bool   `json:"role,omitempty"`
+}
+
+// batchEmails resolves the request into a de-duplicated list of addresses.
+func (s *CacheServer) batchEmails(request *VerifyBatchRequest) ([]string, error) {
+	seen := make(map[string]bool)
+	var emails, invalid []string
+	add := func(email string) {
+		email = strings.ToLower(strings.TrimSpace(email))
+		if email == "" || seen[email] {
+			return
+		}
+		seen[email] = true
+		if validateEmailAddress(email) != nil {
+			invalid = append(invalid, email)
+			return
+		}
+		emails = append(emails, email)
+	}
+
+	for _, email := range request.Emails {
+		add(email)
+	}
+
+	if list := strings.TrimSpace(request.List); list != "" {
+		leads, err := s.store.ListLeads(s.ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read leads: %v", err)
+		}
+		for _, cached := range leads {
+			if cached.LeadData.List == list {
+				add(cached.Email)
+			}
+		}
+	}
+
+	if len(invalid) > 0 {
+		return nil, fmt.Errorf("invalid email addresses: %s", strings.Join(invalid, ", "))
+	}
+	return emails, nil
+}
+
+// verifyBatch queues a background job that verifies each address exactly like
+// POST /verify/:email, a few at a time. Poll GET /jobs/:id for progress.
+func (s *CacheServer) verifyBatch(c *gin.Context) {
+	var request VerifyBatchRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, JobResponse{
+			Success: false,
+			Error:   "Invalid JSON in request body",
+		})
+		return
+	}
+
+	emails, err := s.batchEmails(&request)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, JobResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+	if len(emails) == 0 {
+		c.JSON(http.StatusBadRequest, JobResponse{
+			Success: false,
+			Error:   "No emails to verify (pass emails or a list with cached leads)",
+		})
+		return
+	}
+	if max := s.config.Verification.BatchMaxEmails; len(emails) > max {
+		c.JSON(http.StatusBadRequest, JobResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Too many emails: %d (limit %d)", len(emails), max),
+		})
+		return
+	}
+
+	lead := request.Lead
+	lead.Email = ""
+	if err := lead.Validate(""); err != nil {
+		c.JSON(http.StatusBadRequest, JobResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Invalid lead: %v", err),
+		})
+		return
+	}
+
+	user := requestUser(c)
+	job, err := s.jobs.Submit(JOB_TYPE_VERIFY_BATCH, emails, s.config.Verification.BatchConcurrency,
+		func(ctx context.Context, email string) (interface{}, error) {
+			cached, result, err := s.verifyAndCache(ctx, email, lead, request.Force, user)
+			if err != nil {
+				return nil, err
+			}
+			out := VerifyBatchResult{
+				Result: cached.LeadData.EmailStatus,
+				Cached: result == nil,
+			}
+			if result != nil {
+				out.Reason = result.Reason
+				out.Role = result.Role
+			}
+			return out, nil
+		})
+	if err != nil {
+		log.Printf("Error starting verification job: %v", err)
+		c.JSON(http.StatusInternalServerError, JobResponse{
+			Success: false,
+			Error:   "Failed to start verification job",
+		})
+		return
+	}
+
+	log.Printf("📋 Queued verification job %s for %d emails", job.ID, len(emails))
+	c.JSON(http.StatusAccepted, JobResponse{
+		Success: true,
+		Job:     job,
+	})
+}
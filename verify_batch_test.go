@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stallingVerifier never answers: each verification reports its address on
+// started and waits for the context to end.
+type stallingVerifier struct {
+	*FakeVerifier
+	started chan string
+}
+
+func (v *stallingVerifier) Verify(ctx context.Context, email string) (*VerificationResult, error) {
+	v.started <- email
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func serveInWorkspace(s *CacheServer, method, path, workspace, body string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, path, strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	if workspace != "" {
+		request.Header.Set("X-Workspace", workspace)
+	}
+	recorder := httptest.NewRecorder()
+	s.router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func submitVerifyBatch(t *testing.T, s *CacheServer, workspace, body string) string {
+	t.Helper()
+	recorder := serveInWorkspace(s, http.MethodPost, "/verify/batch", workspace, body)
+	if recorder.Code != http.StatusAccepted {
+		t.Fatalf("POST /verify/batch = %d: %s", recorder.Code, recorder.Body)
+	}
+	var response JobResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	return response.Job.ID
+}
+
+// waitForJob polls GET /jobs/:id until the job has finished.
+func waitForJob(t *testing.T, s *CacheServer, workspace, id string) *Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		recorder := serveInWorkspace(s, http.MethodGet, "/jobs/"+id, workspace, "")
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("GET /jobs/%s = %d: %s", id, recorder.Code, recorder.Body)
+		}
+		var response JobResponse
+		if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+			t.Fatalf("decode job: %v", err)
+		}
+		if status := response.Job.Status; status != JOB_STATUS_QUEUED && status != JOB_STATUS_RUNNING {
+			return response.Job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %s still %s", id, response.Job.Status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func newTestBatchServer(t *testing.T) *CacheServer {
+	t.Helper()
+	s := newTestAuthServer(t)
+	s.config.Auth.Enabled = false
+	s.config.Workspaces = map[string]WorkspaceConfig{"emea": {}}
+	t.Cleanup(func() { s.shutdownJobs(context.Background()) })
+	return s
+}
+
+func TestVerifyBatchCachesEveryLead(t *testing.T) {
+	s := newTestBatchServer(t)
+	body := `{"emails":["jane@acme.com","Invalid.sam@acme.com","catchall+1@acme.com","jane@acme.com"],"lead":{"companyName":"Acme","listLeadBelongsTo":"q1"}}`
+
+	job := waitForJob(t, s, "", submitVerifyBatch(t, s, "", body))
+	if job.Status != JOB_STATUS_COMPLETED || job.Total != 3 || job.Done != 3 || job.Failed != 0 || job.Progress != 100 {
+		t.Fatalf("job = %+v, want 3 of 3 done", job)
+	}
+
+	want := map[string]string{
+		"jane@acme.com":        EMAIL_STATUS_VALID,
+		"invalid.sam@acme.com": EMAIL_STATUS_INVALID,
+		"catchall+1@acme.com":  EMAIL_STATUS_CATCHALL,
+	}
+	for _, item := range job.Items {
+		result, _ := item.Result.(map[string]interface{})
+		if item.Status != JOB_ITEM_DONE || result["result"] != want[item.Key] || result["cached"] != false {
+			t.Errorf("item %s = %+v, want a fresh %s", item.Key, item, want[item.Key])
+		}
+	}
+	for email, status := range want {
+		cached, err := s.store.GetLead(s.ctx, email)
+		if err != nil {
+			t.Fatalf("GetLead %s: %v", email, err)
+		}
+		if cached.LeadData.EmailStatus != status || cached.LeadData.CompanyName != "Acme" || cached.LeadData.List != "q1" {
+			t.Errorf("cached %s = %+v", email, cached.LeadData)
+		}
+	}
+
+	// The list now resolves to the cached leads, which are not verified again
+	job = waitForJob(t, s, "", submitVerifyBatch(t, s, "", `{"list":"q1"}`))
+	if job.Status != JOB_STATUS_COMPLETED || job.Total != 3 || job.Done != 3 {
+		t.Fatalf("list job = %+v", job)
+	}
+	for _, item := range job.Items {
+		if result, _ := item.Result.(map[string]interface{}); result["cached"] != true {
+			t.Errorf("item %s = %+v, want the cached result", item.Key, item)
+		}
+	}
+}
+
+func TestVerifyBatchStaysInItsWorkspace(t *testing.T) {
+	s := newTestBatchServer(t)
+
+	id := submitVerifyBatch(t, s, "emea", `{"emails":["jane@acme.com"],"lead":{"listLeadBelongsTo":"q1"}}`)
+	if job := waitForJob(t, s, "emea", id); job.Status != JOB_STATUS_COMPLETED || job.Done != 1 {
+		t.Fatalf("job = %+v", job)
+	}
+	if recorder := serveInWorkspace(s, http.MethodGet, "/jobs/"+id, "", ""); recorder.Code != http.StatusNotFound {
+		t.Fatalf("GET /jobs/%s from the default workspace = %d, want 404", id, recorder.Code)
+	}
+
+	emea, err := s.forWorkspace("emea")
+	if err != nil {
+		t.Fatalf("forWorkspace: %v", err)
+	}
+	if _, err := emea.store.GetLead(s.ctx, "jane@acme.com"); err != nil {
+		t.Fatalf("lead not cached in emea: %v", err)
+	}
+	if _, err := s.store.GetLead(s.ctx, "jane@acme.com"); err == nil {
+		t.Fatal("lead verified in emea was cached in the default workspace")
+	}
+
+	// A list only picks up the leads of the request's workspace
+	recorder := serveInWorkspace(s, http.MethodPost, "/verify/batch", "", `{"list":"q1"}`)
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("POST /verify/batch for a list of another workspace = %d: %s", recorder.Code, recorder.Body)
+	}
+}
+
+func TestVerifyBatchShutdownCancelsJob(t *testing.T) {
+	s := newTestBatchServer(t)
+	s.config.Verification.BatchConcurrency = 1
+	verifier := &stallingVerifier{
+		FakeVerifier: &FakeVerifier{},
+		started:      make(chan string, 3),
+	}
+	s.verifier = verifier
+
+	id := submitVerifyBatch(t, s, "", `{"emails":["a@acme.com","b@acme.com","c@acme.com"]}`)
+	<-verifier.started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	s.shutdownJobs(ctx)
+
+	var job Job
+	if err := getRecordJSON(context.Background(), s.store, JOB_COLLECTION, id, &job); err != nil {
+		t.Fatalf("saved job: %v", err)
+	}
+	if job.Status != JOB_STATUS_CANCELLED || job.Done != 1 || job.Failed != 1 || job.Error == "" {
+		t.Fatalf("job after shutdown = %+v, want cancelled after the item in flight", job)
+	}
+	if job.Items[1].Status != JOB_ITEM_PENDING || job.Items[2].Status != JOB_ITEM_PENDING {
+		t.Fatalf("items after shutdown = %+v, want the rest pending", job.Items)
+	}
+	if leads, err := s.store.ListLeads(s.ctx); err != nil || len(leads) != 0 {
+		t.Fatalf("leads after a cancelled batch = %d, %v; want none", len(leads), err)
+	}
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// DEFAULT_WORKSPACE keeps the configured key prefixes unchanged, so data
+	// from before workspaces, and from the extension and Python scripts, is in it.
+	DEFAULT_WORKSPACE = "default"
+	// WORKSPACE_KEY_PREFIX starts the keys of every other workspace
+	WORKSPACE_KEY_PREFIX = "ws:"
+
+	// workspaceContext holds the request's workspace name on the gin context
+	workspaceContext = "workspace"
+	// workspaceServerContext holds the *CacheServer of that workspace
+	workspaceServerContext = "workspaceServer"
+
+	workspaceNameRule = "workspace names are 1 to 32 lowercase letters, digits, - or _"
+)
+
+var workspaceNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+func validWorkspaceName(name string) bool {
+	return workspaceNamePattern.MatchString(name)
+}
+
+// workspacePrefix goes in front of every key, index and bucket name of a
+// workspace other than the default one.
+func workspacePrefix(name string) string {
+	return WORKSPACE_KEY_PREFIX + name + ":"
+}
+
+// workspaceServers holds the server of each workspace opened since startup.
+type workspaceServers struct {
+	mu      sync.Mutex
+	servers map[string]*workspaceServer
+	// root is the server NewCacheServer made, whose store is the default
+	// workspace's and also keeps the API keys of every workspace
+	root *CacheServer
+}
+
+// workspaceServer is one workspace being opened or open. ready is closed once
+// server or err is set, so a slow open only holds up requests for that workspace.
+type workspaceServer struct {
+	ready  chan struct{}
+	server *CacheServer
+	err    error
+}
+
+func newWorkspaceServers() *workspaceServers {
+	return &workspaceServers{servers: make(map[string]*workspaceServer)}
+}
+
+// opened returns the servers of the workspaces that finished opening.
+func (w *workspaceServers) opened() map[string]*CacheServer {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	servers := make(map[string]*CacheServer, len(w.servers))
+	for name, entry := range w.servers {
+		select {
+		case <-entry.ready:
+			if entry.err == nil {
+				servers[name] = entry.server
+			}
+		default:
+		}
+	}
+	return servers
+}
+
+// forWorkspace returns a copy of the root server whose store, settings and
+// jobs belong to the named workspace. Providers, generation slots and
+// in-flight generations stay shared. Each workspace is opened once; requests
+// for it wait for that, others do not. A failed open is retried next time.
+func (s *CacheServer) forWorkspace(name string) (*CacheServer, error) {
+	s.workspaces.mu.Lock()
+	entry, exists := s.workspaces.servers[name]
+	if !exists {
+		entry = &workspaceServer{ready: make(chan struct{})}
+		s.workspaces.servers[name] = entry
+	}
+	s.workspaces.mu.Unlock()
+
+	if !exists {
+		entry.server, entry.err = s.workspaces.root.openWorkspace(name)
+		if entry.err != nil {
+			s.workspaces.mu.Lock()
+			delete(s.workspaces.servers, name)
+			s.workspaces.mu.Unlock()
+		}
+		close(entry.ready)
+	}
+	<-entry.ready
+	return entry.server, entry.err
+}
+
+// openWorkspace builds the server of the named workspace from the root one.
+func (s *CacheServer) openWorkspace(name string) (*CacheServer, error) {
+	ws := *s
+	ws.workspace = name
+	ws.config = s.config.forWorkspace(name)
+	if name == DEFAULT_WORKSPACE {
+		return &ws, nil
+	}
+
+	store, err := s.store.Workspace(s.ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	ws.store = store
+	ws.jobs = NewJobManager(store)
+
+	if err := ws.seedPromptTemplates(); err != nil {
+		return nil, fmt.Errorf("failed to seed prompt templates: %v", err)
+	}
+	if err := ws.rebuildDomainPatterns(); err != nil {
+		log.Printf("⚠️ Failed to learn email patterns in workspace %s: %v", name, err)
+	}
+	log.Printf("🗂️ Opened workspace %s", name)
+	return &ws, nil
+}
+
+// knownWorkspace reports whether name may be opened: the default workspace,
+// one configured under workspaces, or one that API keys have been issued for.
+// Workspaces opened before are known without looking at the keys again.
+func (s *CacheServer) knownWorkspace(name string) (bool, error) {
+	if name == DEFAULT_WORKSPACE {
+		return true, nil
+	}
+	if _, ok := s.config.Workspaces[name]; ok {
+		return true, nil
+	}
+	s.workspaces.mu.Lock()
+	_, opened := s.workspaces.servers[name]
+	s.workspaces.mu.Unlock()
+	if opened {
+		return true, nil
+	}
+	keys, err := listAPIKeys(s.ctx, s.workspaces.root.store, name)
+	if err != nil {
+		return false, err
+	}
+	return len(keys) > 0, nil
+}
+
+// knownWorkspaces lists every workspace knownWorkspace accepts, sorted.
+func (s *CacheServer) knownWorkspaces() ([]string, error) {
+	root := s.workspaces.root
+	keys, err := listAPIKeys(root.ctx, root.store, "")
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{DEFAULT_WORKSPACE: true}
+	for name := range root.config.Workspaces {
+		seen[name] = true
+	}
+	for _, key := range keys {
+		seen[key.workspace()] = true
+	}
+	for name := range s.workspaces.opened() {
+		seen[name] = true
+	}
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// forWorkspace returns cfg with the named workspace's settings applied.
+func (cfg *Config) forWorkspace(name string) *Config {
+	settings, ok := cfg.Workspaces[name]
+	if !ok {
+		return cfg
+	}
+	out := *cfg
+	if settings.Template != "" {
+		out.Generation.Template = settings.Template
+	}
+	if len(settings.Variables) > 0 {
+		variables := make(map[string]string, len(cfg.Generation.Variables)+len(settings.Variables))
+		for k, v := range cfg.Generation.Variables {
+			variables[k] = v
+		}
+		for k, v := range settings.Variables {
+			variables[k] = v
+		}
+		out.Generation.Variables = variables
+	}
+	return &out
+}
+
+// resolveWorkspace picks the request's workspace: the API key's when auth is
+// enabled, otherwise the X-Workspace header, otherwise the default one. A key
+// sent with the header of another workspace is refused, and so is a header
+// naming a workspace that is neither configured nor has keys, so a typo does
+// not quietly start an empty workspace.
+func (s *CacheServer) resolveWorkspace(c *gin.Context) {
+	if publicPaths[c.Request.URL.Path] {
+		c.Next()
+		return
+	}
+
+	requested := strings.ToLower(strings.TrimSpace(c.GetHeader("X-Workspace")))
+	name := requested
+	key := authenticatedKey(c)
+	if key != nil {
+		name = key.workspace()
+		if requested != "" && requested != name {
+			log.Printf("🚫 Forbidden: %s tried workspace %s with a key for %s", requestUser(c), requested, name)
+			c.AbortWithStatusJSON(http.StatusForbidden, CacheResponse{
+				Success: false,
+				Error:   fmt.Sprintf("This API key belongs to workspace %s", name),
+			})
+			return
+		}
+	}
+	if name == "" {
+		name = DEFAULT_WORKSPACE
+	}
+	if !validWorkspaceName(name) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, CacheResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Invalid workspace %q: %s", name, workspaceNameRule),
+		})
+		return
+	}
+	// A key's own workspace is known, since the key was issued for it
+	if key == nil {
+		known, err := s.knownWorkspace(name)
+		if err != nil {
+			log.Printf("Error checking workspace %s: %v", name, err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, CacheResponse{
+				Success: false,
+				Error:   "Failed to open workspace",
+			})
+			return
+		}
+		if !known {
+			c.AbortWithStatusJSON(http.StatusNotFound, CacheResponse{
+				Success: false,
+				Error:   fmt.Sprintf("Unknown workspace %q: add it under workspaces in the config or issue a key for it", name),
+			})
+			return
+		}
+	}
+
+	ws, err := s.forWorkspace(name)
+	if err != nil {
+		log.Printf("Error opening workspace %s: %v", name, err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, CacheResponse{
+			Success: false,
+			Error:   "Failed to open workspace",
+		})
+		return
+	}
+	c.Set(workspaceContext, name)
+	c.Set(workspaceServerContext, ws)
+	c.Header("X-Workspace", name)
+	c.Next()
+}
+
+// scoped runs handler on the server of the request's workspace.
+func (s *CacheServer) scoped(handler func(*CacheServer, *gin.Context)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ws := s
+		if value, ok := c.Get(workspaceServerContext); ok {
+			ws = value.(*CacheServer)
+		}
+		handler(ws, c)
+	}
+}
+
+// requestWorkspace is the workspace chosen by resolveWorkspace.
+func requestWorkspace(c *gin.Context) string {
+	if name := c.GetString(workspaceContext); name != "" {
+		return name
+	}
+	return DEFAULT_WORKSPACE
+}
+
+// shutdownJobs stops the background jobs of every workspace.
+func (s *CacheServer) shutdownJobs(ctx context.Context) {
+	s.jobs.Shutdown(ctx)
+	for _, ws := range s.workspaces.opened() {
+		if ws.jobs != s.jobs {
+			ws.jobs.Shutdown(ctx)
+		}
+	}
+}